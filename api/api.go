@@ -1,7 +1,6 @@
 package api
 
 import (
-	"context"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -14,11 +13,12 @@ import (
 	"time"
 
 	"github.com/gorilla/mux"
+	"github.com/kimitzu/kimitzu-services/health"
 	"github.com/kimitzu/kimitzu-services/location"
 	"github.com/nokusukun/particles/roggy"
 
+	"github.com/kimitzu/kimitzu-services/rest"
 	"github.com/kimitzu/kimitzu-services/servicestore"
-	"github.com/kimitzu/kimitzu-services/voyager"
 
 	"github.com/kimitzu/kimitzu-services/models"
 )
@@ -29,6 +29,8 @@ var (
 
 const (
 	TIMEOUT = time.Second * 30
+
+	maxPresenceIDs = 100
 )
 
 type APIListResult struct {
@@ -36,13 +38,17 @@ type APIListResult struct {
 	Limit     int           `json:"limit"`
 	NextStart int           `json:"nextStart"`
 	Data      []interface{} `json:"data"`
+
+	// NextCursor fetches the next page consistently even while the index is being updated
+	NextCursor string `json:"nextCursor,omitempty"`
+
+	// FilterErrors lists the documents that failed to evaluate against the filters
+	FilterErrors []servicestore.FilterError `json:"filterErrors,omitempty"`
+	// Explain is only set when the query asks for it
+	Explain *servicestore.Explain `json:"explain,omitempty"`
 }
 
 func setupResponse(w *http.ResponseWriter, req *http.Request) bool {
-	(*w).Header().Set("Access-Control-Allow-Origin", req.Header.Get("origin"))
-	(*w).Header().Set("Access-Control-Allow-Methods", "POST, GET, PATCH, PUT, DELETE, OPTIONS")
-	(*w).Header().Set("Access-Control-Allow-Headers", "Accept, Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization, Origin, X-Requested-With")
-	(*w).Header().Set("Access-Control-Allow-Credentials", "true")
 	(*w).Header().Set("Content-Type", "application/json")
 	if req.Method == "OPTIONS" {
 		(*w).WriteHeader(http.StatusOK)
@@ -52,8 +58,7 @@ func setupResponse(w *http.ResponseWriter, req *http.Request) bool {
 }
 
 func HTTPFlushAll(w http.ResponseWriter, r *http.Request) {
-	store.Listings.FlushSE()
-	store.PeerData.FlushSE()
+	flush()
 	_, _ = fmt.Fprint(w, `{"result": "ok"}`)
 }
 
@@ -62,13 +67,12 @@ func HTTPPeerGetListings(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	result := store.Listings.Search("")
-	jsn, err := result.ExportJSONArray()
-	if err == nil {
-		_, _ = fmt.Fprint(w, jsn)
-	} else {
-		_, _ = fmt.Fprint(w, `{"error": "notFound"}`)
+	jsn, err := exportAll(store.Listings.Search(""))
+	if err != nil {
+		legacyError(w, err)
+		return
 	}
+	_, _ = w.Write(jsn)
 }
 
 func HTTPPeerGet(w http.ResponseWriter, r *http.Request) {
@@ -76,79 +80,12 @@ func HTTPPeerGet(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	qpeerid := r.URL.Query().Get("id")
-
-	if qpeerid == "" {
-		if voyager.MyPeerID == "" {
-			qpeerid = voyager.GetSelfPeerID()
-		} else {
-			qpeerid = voyager.MyPeerID
-		}
-	}
-
-	ctx, cancel := context.WithTimeout(context.Background(), TIMEOUT)
-	success := make(chan struct{})
-
-	force := r.URL.Query().Get("force")
-	docID, exists := store.PMap[qpeerid]
-	toReturn := `{"error": "retrieve timeout"}`
-	message := ""
-	errCode := 500
-
-	go func() {
-		if exists && docID != "" && force != "true" {
-			doc, err := store.PeerData.Get(docID)
-			if err != nil {
-				toReturn = fmt.Sprintf(`{"error": "failedToRetrievePeer", "details": "%v"}`, err)
-			} else {
-				toReturn = string(doc.Content)
-			}
-		} else {
-			var peerObjID string
-			peerObj, err := voyager.DigestPeer(qpeerid, store)
-			if err != nil {
-				store.SafePMapModify(func() {
-					store.PMap[qpeerid] = ""
-				})
-				message = "failed"
-			} else {
-				peerObjID, err = store.PeerData.Insert(peerObj.ID, peerObj)
-				if err != nil {
-					message = "failed"
-					toReturn = `{"error": "` + message + `"}`
-				}
-			}
-
-			// If nothing fails
-			if message != "failed" {
-				store.PMap[qpeerid] = peerObjID
-				store.Listings.Commit()
-				store.PeerData.Commit()
-
-				peerObjJSON, err := json.Marshal(peerObj)
-				if err != nil {
-					toReturn = `{"error": "` + err.Error() + `"}`
-				}
-				toReturn = string(peerObjJSON)
-			} else {
-				toReturn = `{"error": "Not found and failed to digest"}`
-				errCode = 404
-			}
-		}
-		if strings.Contains(toReturn, "error") {
-			cancel()
-		} else {
-			success <- struct{}{}
-		}
-	}()
-
-	select {
-	case <-success:
-		_, _ = fmt.Fprint(w, toReturn)
-	case <-ctx.Done():
-		http.Error(w, toReturn, errCode)
+	peer, err := getPeer(r.Context(), r.URL.Query().Get("id"), r.URL.Query().Get("force") == "true")
+	if err != nil {
+		legacyError(w, err)
+		return
 	}
-
+	_ = json.NewEncoder(w).Encode(peer)
 }
 
 func HTTPPeers(w http.ResponseWriter, r *http.Request) {
@@ -156,122 +93,45 @@ func HTTPPeers(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	peers := store.PeerData.Search("")
-	data, _ := peers.ExportJSONArray()
-	_, _ = fmt.Fprint(w, string(data))
+	data, err := exportAll(store.PeerData.Search(""))
+	if err != nil {
+		legacyError(w, err)
+		return
+	}
+	_, _ = w.Write(data)
 }
 
+// HTTPPeerAdd always answers 200 with a "success" or "failed" result, /v1/peers reports the failures.
 func HTTPPeerAdd(w http.ResponseWriter, r *http.Request) {
 	if retOK := setupResponse(&w, r); retOK {
 		return
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), time.Second*30)
-	success := make(chan struct{})
 	message := "success"
-
-	go func() {
-		peerID := r.URL.Query().Get("id")
-		peerObj, err := voyager.DigestPeer(peerID, store)
-		if err != nil {
-			// log.Error(err)
-			// store.PMap[peerID] = ""
-			store.PMapSet(peerID, "")
-			message = "failed"
-			cancel()
-		}
-		peerObjID, err := store.PeerData.Insert(peerObj.ID, peerObj)
-		if err != nil {
-			// panic(err)
-			message = "failed"
-			cancel()
-		}
-
-		if message != "failed" {
-			//store.PMap[peerID] = peerObjID
-			store.PMapSet(peerID, peerObjID)
-			go store.Listings.FlushSE()
-			store.Listings.Commit()
-			store.PeerData.Commit()
-		}
-		success <- struct{}{}
-	}()
-
-	select {
-	case <-success:
-		_, _ = fmt.Fprint(w, "{\"result\": \""+message+"\"}")
-	case <-ctx.Done():
-		_, _ = fmt.Fprint(w, "{\"result\": \"failed\"}")
+	if _, err := crawlPeer(r.Context(), r.URL.Query().Get("id")); err != nil {
+		message = "failed"
 	}
+	_, _ = fmt.Fprint(w, "{\"result\": \""+message+"\"}")
 }
 
 func HTTPPeerSearch(w http.ResponseWriter, r *http.Request) {
 	if retOK := setupResponse(&w, r); retOK {
 		return
 	}
-	b, err := ioutil.ReadAll(r.Body)
-	defer r.Body.Close()
-	if err != nil {
-		http.Error(w, err.Error(), 500)
-		return
-	}
-
-	if store.PeerData.Size() == 0 {
-		http.Error(w, `{"error": "empty database"}`, 204)
-		return
-	}
 
-	params := &models.AdvancedSearchQuery{}
-	err = json.Unmarshal(b, &params)
-	if err != nil {
-		http.Error(w, fmt.Sprintf(`{"error": "Failed to decode body", "goerror": "%v"}`, err), 500)
+	params, ok := legacySearchParams(w, r, store.PeerData.Size())
+	if !ok {
 		return
 	}
 
 	//log.Verbose("[/peer/search] Parameter [query=" + params.Query + "]")
 
-	results := store.PeerData.Search(params.Query)
-
-	if len(params.Filters) != 0 {
-		for _, filter := range params.Filters {
-			// log.Debug("Running filter: " + filter)
-			results.Filter(filter)
-		}
-	}
-
-	if params.Sort != "" {
-		results.Sort(params.Sort)
-	}
-
-	if params.Limit != 0 {
-		results.Limit(params.Start, params.Limit)
-	}
-
-	if len(params.Transforms) != 0 {
-		d, _ := json.Marshal(params.Transforms)
-		results.Transform(string(d))
-	}
-
-	nextStart := params.Start + params.Limit
-	if nextStart >= results.Count {
-		nextStart = -1
-	}
-
-	arr := []interface{}{}
-	for _, doc := range results.Documents {
-		i := new(interface{})
-		json.Unmarshal(doc.Content, &i)
-		arr = append(arr, i)
-	}
-
-	listreturn := APIListResult{
-		Count:     results.Count,
-		Limit:     params.Limit,
-		NextStart: nextStart,
-		Data:      arr,
+	results, err := searchPeers(r.Context(), params)
+	if err != nil {
+		legacyError(w, err)
+		return
 	}
-	retStr, _ := json.Marshal(listreturn)
-	fmt.Fprint(w, string(retStr))
+	_ = json.NewEncoder(w).Encode(results)
 }
 
 func HTTPListing(w http.ResponseWriter, r *http.Request) {
@@ -279,21 +139,12 @@ func HTTPListing(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	hash := r.URL.Query().Get("hash")
-	results := store.Listings.Search(hash)
-
-	if len(results.Documents) == 0 {
-		results = store.Listings.Search("").Filter(fmt.Sprintf("doc.hash == \"%v\"", hash))
-	}
-
-	if len(results.Documents) == 0 {
-		http.Error(w, "{\"error\": \"No results\"}", 404)
+	listing, err := getListing(r.URL.Query().Get("hash"))
+	if err != nil {
+		legacyError(w, err)
 		return
 	}
-
-	listing, _ := json.Marshal(results.Documents[0].ExportI())
-	_, _ = fmt.Fprintf(w, string(listing))
-	return
+	_ = json.NewEncoder(w).Encode(listing)
 }
 
 // Kazaam Specs https://github.com/qntfy/kazaam
@@ -303,7 +154,14 @@ func HTTPListing(w http.ResponseWriter, r *http.Request) {
 * 	"filters": [
 * 		"contains(doc.slug, \"golden\")"	// Gval expression
 * 	],
+* 	"where": {"and": [						// Structured filter, see models.FilterNode
+* 		{"field": "item.price", "lte": 5000},
+* 		{"in": {"field": "metadata.acceptedCurrencies", "values": ["BTC"]}}
+* 	]},
 * 	"limit": 5,
+* 	"near": {"lat": 10.6969, "lng": 122.5644, "radiusMeters": 5000},
+* 	"order": "distance",					// Closest first, hits carry a "distance" in meters
+* 	"explain": true,						// Documents left and time spent after each stage
 * 	"transforms": [{						// Kazaam Spec
 * 		"operation": "shift",
 * 		"spec": {
@@ -320,71 +178,116 @@ func HTTPListingSearch(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	params, ok := legacySearchParams(w, r, store.Listings.Size())
+	if !ok {
+		return
+	}
+
+	results, err := searchListings(r.Context(), params)
+	if err != nil {
+		legacyError(w, err)
+		return
+	}
+	_ = json.NewEncoder(w).Encode(results)
+}
+
+// legacySearchParams decodes the query of the legacy search routes, which answer
+// 204 when the store is empty and 500 when the body can't be decoded.
+func legacySearchParams(w http.ResponseWriter, r *http.Request, size int) (*models.AdvancedSearchQuery, bool) {
 	b, err := ioutil.ReadAll(r.Body)
 	defer r.Body.Close()
 	if err != nil {
 		http.Error(w, err.Error(), 500)
-		return
+		return nil, false
 	}
 
-	if store.Listings.Size() == 0 {
-		http.Error(w, `{"error": "empty database"}`, 204)
-		return
+	if size == 0 {
+		w.WriteHeader(http.StatusNoContent)
+		return nil, false
 	}
 
 	params := &models.AdvancedSearchQuery{}
 	err = json.Unmarshal(b, &params)
 	if err != nil {
-		http.Error(w, fmt.Sprintf(`{"error": "Failed to decode body", "goerror": "%v"}`, err), 500)
-		return
+		w.WriteHeader(500)
+		_ = json.NewEncoder(w).Encode(map[string]string{"error": "Failed to decode body", "goerror": err.Error()})
+		return nil, false
 	}
+	return params, true
+}
 
-	results := store.Listings.Search(params.Query)
-
-	if results.Count == 0 && params.Generous {
-		results = store.Listings.Search("")
+// legacyError writes err in the shape the legacy routes use, {"error": code}
+// or the QueryError itself for queries that failed.
+func legacyError(w http.ResponseWriter, err error) {
+	e := rest.AsError(err)
+	var body interface{} = ErrorResponse{Error: e.Code, Message: e.Message}
+	if qerr, ok := e.Details.(*servicestore.QueryError); ok {
+		body = qerr
 	}
 
-	if len(params.Filters) != 0 {
-		for _, filter := range params.Filters {
-			//log.Debug("Running filter: " + filter)
-			results.Filter(filter)
-		}
-	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(e.Status)
+	_ = json.NewEncoder(w).Encode(body)
+}
 
-	if params.Sort != "" {
-		results.Sort(params.Sort)
+// HTTPSearchSuggest returns autocomplete entries for `q` from the indexed
+// listing titles, tags, categories and vendor names.
+func HTTPSearchSuggest(w http.ResponseWriter, r *http.Request) {
+	if retOK := setupResponse(&w, r); retOK {
+		return
 	}
 
-	if params.Limit != 0 {
-		results.Limit(params.Start, params.Limit)
-	}
+	q := r.URL.Query().Get("q")
+	limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+
+	_ = json.NewEncoder(w).Encode(store.Suggest(q, limit))
+}
+
+// TaxonomyNode is a service category along with the amount of listings under it.
+type TaxonomyNode struct {
+	Code     string          `json:"code"`
+	Name     string          `json:"name"`
+	Count    int             `json:"count"`
+	Children []*TaxonomyNode `json:"children,omitempty"`
+}
+
+// TaxonomyResult is the part of the service taxonomy being browsed.
+type TaxonomyResult struct {
+	Version      int64           `json:"version"`
+	Source       string          `json:"source"`
+	Unclassified int             `json:"unclassified"`
+	Path         []*TaxonomyNode `json:"path"`
+	Nodes        []*TaxonomyNode `json:"nodes"`
+}
 
-	if len(params.Transforms) != 0 {
-		d, _ := json.Marshal(params.Transforms)
-		results.Transform(string(d))
+// HTTPTaxonomy browses the service taxonomy with the listing counts of each category. The whole
+// tree is returned unless `code`, or a `classification` like "Home Services > Plumbing", picks a node.
+func HTTPTaxonomy(w http.ResponseWriter, r *http.Request) {
+	if retOK := setupResponse(&w, r); retOK {
+		return
 	}
 
-	nextStart := params.Start + params.Limit
-	if nextStart >= results.Count {
-		nextStart = -1
+	result, err := browseTaxonomy(r.URL.Query().Get("code"), r.URL.Query().Get("classification"))
+	if err != nil {
+		legacyError(w, err)
+		return
 	}
+	_ = json.NewEncoder(w).Encode(result)
+}
 
-	var arr []interface{}
-	for _, doc := range results.Documents {
-		i := new(interface{})
-		_ = json.Unmarshal(doc.Content, &i)
-		arr = append(arr, i)
+// HTTPPresence returns the cached online status of the comma separated ?ids=,
+// peers whose status is stale are checked in the background.
+func HTTPPresence(w http.ResponseWriter, r *http.Request) {
+	if retOK := setupResponse(&w, r); retOK {
+		return
 	}
 
-	listReturn := APIListResult{
-		Count:     results.Count,
-		Limit:     params.Limit,
-		NextStart: nextStart,
-		Data:      arr,
+	result, err := presence(r.URL.Query().Get("ids"))
+	if err != nil {
+		legacyError(w, err)
+		return
 	}
-	retStr, _ := json.Marshal(listReturn)
-	fmt.Fprint(w, string(retStr))
+	_ = json.NewEncoder(w).Encode(result)
 }
 
 func HTTPMedia(w http.ResponseWriter, r *http.Request) {
@@ -392,14 +295,19 @@ func HTTPMedia(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// The images folder sits in the data folder next to the TLS key and the API tokens
 	id := r.URL.Query().Get("id")
+	if id == "" || strings.ContainsAny(id, `/\`) || strings.Contains(id, "..") {
+		legacyError(w, rest.Errorf(http.StatusBadRequest, rest.CodeBadRequest, "invalid media id"))
+		return
+	}
 	image, err := os.Open(path.Join(store.StorePath, "images", id))
 
 	if err != nil {
 		// If media is not found in data/images, fallback to ipfs
 		resp, err2 := http.Get("http://localhost:8100/ob/images/" + id)
 		if err2 != nil {
-			http.Error(w, `{"error": "Media not found"}`, 404)
+			legacyError(w, rest.Errorf(http.StatusNotFound, rest.CodeNotFound, "Media not found"))
 			return
 		}
 		w.Header().Set("Content-Type", resp.Header.Get("Content-Type"))
@@ -417,20 +325,20 @@ func HTTPInfo(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	type VersionInfo struct {
-		OBVersion             string `json:"obDaemon"`
-		KimitzuServiceVersion string `json:"kimitzuDaemon"`
-	}
-
-	info, _ := GetInfo()
-	versionInfo := VersionInfo{OBVersion: info.OBVersion, KimitzuServiceVersion: info.KimitzuServiceVersion}
-
-	json.NewEncoder(w).Encode(versionInfo)
+	_ = json.NewEncoder(w).Encode(versionInfo())
 }
 
+// AppendAPIService registers the routes on a ServeMux, serve it through
+// RequireAuth(DefaultAuthPolicy)(mux) to enforce authentication.
 func AppendAPIService(mux *http.ServeMux) {
 	mux.HandleFunc("/kimitzu/location/query", location.HTTPLocationQueryHandler)
 	mux.HandleFunc("/kimitzu/location/codesfrom", location.HTTPLocationCodesfromHandler)
+	mux.HandleFunc("/kimitzu/location/nearest", location.HTTPLocationNearestHandler)
+	mux.HandleFunc("/kimitzu/location/bbox", location.HTTPLocationBoxHandler)
+	mux.HandleFunc("/kimitzu/location/reverse", location.HTTPLocationReverseHandler)
+	mux.HandleFunc("/kimitzu/location/pluscode", location.HTTPLocationPlusCodeHandler)
+	mux.HandleFunc("/kimitzu/location/info", location.HTTPLocationInfoHandler)
+	mux.HandleFunc("/kimitzu/location/import", location.HTTPLocationImportHandler)
 
 	mux.HandleFunc("/kimitzu/peers/listings", HTTPPeerGetListings)
 	mux.HandleFunc("/kimitzu/peer/get", HTTPPeerGet)
@@ -440,8 +348,16 @@ func AppendAPIService(mux *http.ServeMux) {
 
 	mux.HandleFunc("/kimitzu/listing", HTTPListing)
 	mux.HandleFunc("/kimitzu/search", HTTPListingSearch)
+	mux.HandleFunc("/kimitzu/search/suggest", HTTPSearchSuggest)
+	mux.HandleFunc("/kimitzu/taxonomy", HTTPTaxonomy)
+	mux.HandleFunc("/kimitzu/presence", HTTPPresence)
+	mux.HandleFunc("/kimitzu/tokens", HTTPTokens)
 
 	mux.HandleFunc("/kimitzu/media", HTTPMedia)
+	mux.HandleFunc("/graphql", HTTPGraphQL)
+	mux.HandleFunc("/openapi.json", HTTPOpenAPI)
+	mux.HandleFunc("/healthz", health.HTTPHealthz)
+	mux.HandleFunc("/readyz", HTTPReadyz)
 }
 
 func AttachStore(store_ *servicestore.MainManagedStorage) {
@@ -453,6 +369,12 @@ func AttachAPI(log *roggy.LogPrinter, router *mux.Router) {
 
 	router.HandleFunc("/kimitzu/location/query", location.HTTPLocationQueryHandler)
 	router.HandleFunc("/kimitzu/location/codesfrom", location.HTTPLocationCodesfromHandler)
+	router.HandleFunc("/kimitzu/location/nearest", location.HTTPLocationNearestHandler)
+	router.HandleFunc("/kimitzu/location/bbox", location.HTTPLocationBoxHandler)
+	router.HandleFunc("/kimitzu/location/reverse", location.HTTPLocationReverseHandler)
+	router.HandleFunc("/kimitzu/location/pluscode", location.HTTPLocationPlusCodeHandler)
+	router.HandleFunc("/kimitzu/location/info", location.HTTPLocationInfoHandler)
+	router.HandleFunc("/kimitzu/location/import", location.HTTPLocationImportHandler)
 
 	router.HandleFunc("/kimitzu/peers/listings", HTTPPeerGetListings)
 	router.HandleFunc("/kimitzu/peer/get", HTTPPeerGet)
@@ -462,14 +384,24 @@ func AttachAPI(log *roggy.LogPrinter, router *mux.Router) {
 
 	router.HandleFunc("/kimitzu/listing", HTTPListing)
 	router.HandleFunc("/kimitzu/search", HTTPListingSearch)
+	router.HandleFunc("/kimitzu/search/suggest", HTTPSearchSuggest)
+	router.HandleFunc("/kimitzu/taxonomy", HTTPTaxonomy)
+	router.HandleFunc("/kimitzu/presence", HTTPPresence)
+	router.HandleFunc("/kimitzu/tokens", HTTPTokens)
 
 	router.HandleFunc("/kimitzu/media", HTTPMedia)
+	router.HandleFunc("/graphql", HTTPGraphQL)
+	router.HandleFunc("/openapi.json", HTTPOpenAPI)
+	router.HandleFunc("/healthz", health.HTTPHealthz)
+	router.HandleFunc("/readyz", HTTPReadyz)
 
 	router.HandleFunc("/authenticate", Authenticate)
 
 	router.HandleFunc("/debug/flush", HTTPFlushAll)
 	router.HandleFunc("/info/version", HTTPInfo)
 
+	AttachV1(router)
+
 	//log.Info("Serving at 0.0.0.0:8109")
 	//http.ListenAndServe(":8109", nil)
 }
@@ -0,0 +1,44 @@
+package api
+
+import (
+	"io/ioutil"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path"
+	"testing"
+)
+
+func TestMediaTraversal(t *testing.T) {
+	store_, detach := attachTestStore(t)
+	defer detach()
+
+	files := map[string]string{
+		"images/QmImage": "image",
+		"tls/key.pem":    "key",
+		"tokens.json":    "tokens",
+	}
+	for name, content := range files {
+		file := path.Join(store_.StorePath, name)
+		if err := os.MkdirAll(path.Dir(file), 0700); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(file, []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	w := httptest.NewRecorder()
+	HTTPMedia(w, httptest.NewRequest("GET", "/kimitzu/media?id=QmImage", nil))
+	if w.Code != 200 || w.Body.String() != "image" {
+		t.Errorf("expected the image, got %v %q", w.Code, w.Body.String())
+	}
+
+	for _, id := range []string{"../tls/key.pem", "../tokens.json", `..\tokens.json`, "..", "images/../../tokens.json", ""} {
+		w := httptest.NewRecorder()
+		HTTPMedia(w, httptest.NewRequest("GET", "/kimitzu/media?id="+url.QueryEscape(id), nil))
+		if w.Code != 400 {
+			t.Errorf("%q: got %v %q, want 400", id, w.Code, w.Body.String())
+		}
+	}
+}
@@ -34,11 +34,19 @@ type KimitzuInfoP struct {
 }
 
 func GetInfo() (KimitzuInfoP, error) {
-	res, err := grequests.Get("http://127.0.0.1:8100/kimitzu/info", &grequests.RequestOptions{RequestTimeout: time.Second * 10})
+	info, err := getInfo(time.Second * 10)
 	if err != nil {
 		fmt.Println("Error", err)
 		return KimitzuInfoP{}, fmt.Errorf("Can't resolve node, probably offline")
 	}
+	return info, nil
+}
+
+func getInfo(timeout time.Duration) (KimitzuInfoP, error) {
+	res, err := grequests.Get("http://127.0.0.1:8100/kimitzu/info", &grequests.RequestOptions{RequestTimeout: timeout})
+	if err != nil {
+		return KimitzuInfoP{}, err
+	}
 
 	info := KimitzuInfoP{}
 	info.KimitzuServiceVersion = ServiceConfig.Version
@@ -0,0 +1,807 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+
+	graphql "github.com/graph-gophers/graphql-go"
+
+	"github.com/kimitzu/kimitzu-services/models"
+	"github.com/kimitzu/kimitzu-services/p2p"
+	"github.com/kimitzu/kimitzu-services/rest"
+	"github.com/kimitzu/kimitzu-services/servicestore"
+)
+
+// graphQLMaxDepth bounds the nesting of queries, listing → vendor → listings → ratings → source is 5.
+const graphQLMaxDepth = 8
+
+const graphQLSchemaText = `
+schema {
+	query: Query
+}
+
+# Any JSON value
+scalar JSON
+
+type Query {
+	# A listing by hash
+	listing(hash: String!): Listing
+	# Searches the listings like /kimitzu/search
+	listings(search: Search): ListingPage!
+	# A peer, the node's own when id is left out
+	peer(id: String): Peer
+	# Searches the peers like /kimitzu/peer/search
+	peers(search: Search): PeerPage!
+	# The ratings given to a peer and its listings, or to one listing with "peerID@slug"
+	ratings(id: String!): [Rating!]!
+}
+
+# The fields of AdvancedSearchQuery, see the search documentation
+input Search {
+	query: String
+	filters: [String!]
+	where: JSON
+	sort: String
+	order: String
+	limit: Int
+	start: Int
+	cursor: String
+	near: Near
+	currency: String
+	minPrice: Float
+	maxPrice: Float
+	category: String
+	rateMethod: String
+	fuzzy: Boolean
+	onlineOnly: Boolean
+}
+
+input Near {
+	lat: Float!
+	lng: Float!
+	radiusMeters: Float!
+}
+
+type ListingPage {
+	count: Int!
+	nextStart: Int!
+	nextCursor: String
+	listings: [Listing!]!
+}
+
+type PeerPage {
+	count: Int!
+	nextStart: Int!
+	nextCursor: String
+	peers: [Peer!]!
+}
+
+type Listing {
+	hash: String!
+	slug: String!
+	title: String!
+	description: String!
+	categories: [String!]!
+	tags: [String!]!
+	classification: String!
+	price: Price!
+	location: Location!
+	averageRating: Int!
+	ratingCount: Int!
+	vendorID: String!
+	vendor: Peer
+	ratings: [Rating!]!
+	# The listing as indexed, with what the search added like convertedPrice
+	document: JSON!
+}
+
+type Price {
+	amount: Float!
+	currency: String!
+	rateMethod: String!
+}
+
+type Location {
+	latitude: String!
+	longitude: String!
+	plusCode: String!
+	addressOne: String!
+	addressTwo: String!
+	city: String!
+	state: String!
+	country: String!
+	zipCode: String!
+}
+
+type Peer {
+	id: String!
+	name: String!
+	handle: String!
+	lastPing: Float!
+	profile: JSON!
+	listings: [Listing!]!
+	ratings: [Rating!]!
+}
+
+type Rating {
+	type: String!
+	sourceID: String!
+	destination: String!
+	source: Peer
+	content: JSON
+}
+`
+
+var graphQLSchema = graphql.MustParseSchema(graphQLSchemaText, &graphQuery{}, graphql.MaxDepth(graphQLMaxDepth))
+
+var ratingManager *p2p.RatingManager
+
+// AttachRatings gives the GraphQL endpoint the ratings database.
+func AttachRatings(manager *p2p.RatingManager) {
+	ratingManager = manager
+}
+
+// GraphQLRequest is a GraphQL query.
+type GraphQLRequest struct {
+	Query         string                 `json:"query"`
+	OperationName string                 `json:"operationName"`
+	Variables     map[string]interface{} `json:"variables"`
+}
+
+// HTTPGraphQL runs a query against the listings, peers and ratings.
+func HTTPGraphQL(w http.ResponseWriter, r *http.Request) {
+	if retOK := setupResponse(&w, r); retOK {
+		return
+	}
+	if r.Method != "POST" {
+		legacyError(w, rest.Errorf(http.StatusMethodNotAllowed, rest.CodeMethodNotAllowed, "queries are sent with POST"))
+		return
+	}
+
+	request := GraphQLRequest{}
+	if err := rest.Decode(r, &request); err != nil {
+		legacyError(w, err)
+		return
+	}
+
+	ctx := context.WithValue(r.Context(), graphLoaderKey{}, newGraphLoader())
+	_ = json.NewEncoder(w).Encode(graphQLSchema.Exec(ctx, request.Query, request.OperationName, request.Variables))
+}
+
+// graphJSON is the JSON scalar.
+type graphJSON struct {
+	value interface{}
+}
+
+func (graphJSON) ImplementsGraphQLType(name string) bool {
+	return name == "JSON"
+}
+
+func (j *graphJSON) UnmarshalGraphQL(input interface{}) error {
+	j.value = input
+	return nil
+}
+
+func (j graphJSON) MarshalJSON() ([]byte, error) {
+	return json.Marshal(j.value)
+}
+
+type graphNear struct {
+	Lat          float64
+	Lng          float64
+	RadiusMeters float64
+}
+
+type graphSearch struct {
+	Query      *string
+	Filters    *[]string
+	Where      *graphJSON
+	Sort       *string
+	Order      *string
+	Limit      *int32
+	Start      *int32
+	Cursor     *string
+	Near       *graphNear
+	Currency   *string
+	MinPrice   *float64
+	MaxPrice   *float64
+	Category   *string
+	RateMethod *string
+	Fuzzy      *bool
+	OnlineOnly *bool
+}
+
+// params converts the arguments to a search query, s may be nil.
+func (s *graphSearch) params() (*models.AdvancedSearchQuery, error) {
+	params := &models.AdvancedSearchQuery{}
+	if s == nil {
+		return params, nil
+	}
+
+	str := func(s *string) string {
+		if s == nil {
+			return ""
+		}
+		return *s
+	}
+	params.Query, params.Sort, params.Order, params.Cursor = str(s.Query), str(s.Sort), str(s.Order), str(s.Cursor)
+	params.Currency, params.Category, params.RateMethod = str(s.Currency), str(s.Category), str(s.RateMethod)
+	params.MinPrice, params.MaxPrice = s.MinPrice, s.MaxPrice
+	if s.Filters != nil {
+		params.Filters = *s.Filters
+	}
+	if s.Limit != nil {
+		params.Limit = int(*s.Limit)
+	}
+	if s.Start != nil {
+		params.Start = int(*s.Start)
+	}
+	if s.Near != nil {
+		params.Near = &models.NearQuery{Lat: s.Near.Lat, Lng: s.Near.Lng, RadiusMeters: s.Near.RadiusMeters}
+	}
+	params.Fuzzy = s.Fuzzy != nil && *s.Fuzzy
+	params.OnlineOnly = s.OnlineOnly != nil && *s.OnlineOnly
+
+	if s.Where != nil {
+		params.Where = &models.FilterNode{}
+		if err := decodeDocument(s.Where.value, params.Where); err != nil {
+			return nil, rest.Errorf(http.StatusBadRequest, rest.CodeBadRequest, "invalid where: %v", err)
+		}
+	}
+	return params, nil
+}
+
+type graphQuery struct{}
+
+func (q *graphQuery) Listing(ctx context.Context, args struct{ Hash string }) (*listingResolver, error) {
+	found, err := getListing(args.Hash)
+	if err != nil {
+		if e, ok := err.(*rest.Error); ok && e.Code == rest.CodeNotFound {
+			return nil, nil
+		}
+		return nil, err
+	}
+	listings, err := newListingBatch(loaderOf(ctx), []interface{}{found})
+	if err != nil {
+		return nil, err
+	}
+	return listings[0], nil
+}
+
+func (q *graphQuery) Listings(ctx context.Context, args struct{ Search *graphSearch }) (*listingPage, error) {
+	params, err := args.Search.params()
+	if err != nil {
+		return nil, err
+	}
+	result, err := searchListings(ctx, params)
+	if err != nil {
+		return nil, err
+	}
+	listings, err := newListingBatch(loaderOf(ctx), result.Data)
+	if err != nil {
+		return nil, err
+	}
+	return &listingPage{graphPage{result}, listings}, nil
+}
+
+func (q *graphQuery) Peer(ctx context.Context, args struct{ ID *string }) (*peerResolver, error) {
+	id := ""
+	if args.ID != nil {
+		id = *args.ID
+	}
+	found, err := getPeer(ctx, id, false)
+	if err != nil {
+		if e, ok := err.(*rest.Error); ok && e.Code == rest.CodeNotFound {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	peer := &models.Peer{}
+	if err := decodeDocument(found, peer); err != nil {
+		return nil, err
+	}
+	return newPeerBatch(loaderOf(ctx), []*models.Peer{peer})[0], nil
+}
+
+func (q *graphQuery) Peers(ctx context.Context, args struct{ Search *graphSearch }) (*peerPage, error) {
+	params, err := args.Search.params()
+	if err != nil {
+		return nil, err
+	}
+	result, err := searchPeers(ctx, params)
+	if err != nil {
+		return nil, err
+	}
+
+	peers := make([]*models.Peer, len(result.Data))
+	for i, doc := range result.Data {
+		peers[i] = &models.Peer{}
+		if err := decodeDocument(doc, peers[i]); err != nil {
+			return nil, err
+		}
+	}
+	return &peerPage{graphPage{result}, newPeerBatch(loaderOf(ctx), peers)}, nil
+}
+
+func (q *graphQuery) Ratings(ctx context.Context, args struct{ ID string }) ([]*ratingResolver, error) {
+	loader := loaderOf(ctx)
+	found, err := loader.loadRatings([]string{args.ID})
+	if err != nil {
+		return nil, err
+	}
+	return nonNilRatings(newRatingBatch(loader, found)[args.ID]), nil
+}
+
+type graphPage struct {
+	result *APIListResult
+}
+
+func (p graphPage) Count() int32 {
+	return int32(p.result.Count)
+}
+
+func (p graphPage) NextStart() int32 {
+	return int32(p.result.NextStart)
+}
+
+func (p graphPage) NextCursor() *string {
+	if p.result.NextCursor == "" {
+		return nil
+	}
+	return &p.result.NextCursor
+}
+
+type listingPage struct {
+	graphPage
+	listings []*listingResolver
+}
+
+func (p *listingPage) Listings() []*listingResolver {
+	return p.listings
+}
+
+type peerPage struct {
+	graphPage
+	peers []*peerResolver
+}
+
+func (p *peerPage) Peers() []*peerResolver {
+	return p.peers
+}
+
+type listingResolver struct {
+	listing  *models.ListingClass
+	document map[string]interface{}
+	batch    *listingBatch
+}
+
+func (l *listingResolver) Hash() string           { return l.listing.Hash }
+func (l *listingResolver) Slug() string           { return l.listing.Slug }
+func (l *listingResolver) Title() string          { return l.listing.Item.Title }
+func (l *listingResolver) Description() string    { return l.listing.Item.Description }
+func (l *listingResolver) Categories() []string   { return nonNilStrings(l.listing.Item.Categories) }
+func (l *listingResolver) Tags() []string         { return nonNilStrings(l.listing.Item.Tags) }
+func (l *listingResolver) Classification() string { return l.listing.Metadata.ServiceClassification }
+func (l *listingResolver) AverageRating() int32   { return int32(l.listing.AverageRating) }
+func (l *listingResolver) RatingCount() int32     { return int32(l.listing.RatingCount) }
+func (l *listingResolver) VendorID() string       { return servicestore.VendorPeer(l.document) }
+func (l *listingResolver) Document() graphJSON    { return graphJSON{l.document} }
+
+func (l *listingResolver) Price() *priceResolver {
+	return &priceResolver{&l.listing.Pricing}
+}
+
+func (l *listingResolver) Location() *locationResolver {
+	return &locationResolver{&l.listing.Location}
+}
+
+func (l *listingResolver) Vendor() *peerResolver {
+	return l.batch.vendor(l.VendorID())
+}
+
+// Ratings are the ratings of the listing, its destination in the ratings is "vendorID@slug".
+func (l *listingResolver) Ratings() ([]*ratingResolver, error) {
+	return l.batch.ratingsOf(l.VendorID() + "@" + l.listing.Slug)
+}
+
+type priceResolver struct {
+	price *models.ListingPrice
+}
+
+func (p *priceResolver) Amount() float64    { return p.price.Amount }
+func (p *priceResolver) Currency() string   { return p.price.Currency }
+func (p *priceResolver) RateMethod() string { return p.price.RateMethod }
+
+type locationResolver struct {
+	location *models.Location
+}
+
+func (l *locationResolver) Latitude() string   { return l.location.Latitude }
+func (l *locationResolver) Longitude() string  { return l.location.Longitude }
+func (l *locationResolver) PlusCode() string   { return l.location.PlusCode }
+func (l *locationResolver) AddressOne() string { return l.location.AddressOne }
+func (l *locationResolver) AddressTwo() string { return l.location.AddressTwo }
+func (l *locationResolver) City() string       { return l.location.City }
+func (l *locationResolver) State() string      { return l.location.State }
+func (l *locationResolver) Country() string    { return l.location.Country }
+func (l *locationResolver) ZipCode() string    { return l.location.ZipCode }
+
+type peerResolver struct {
+	peer  *models.Peer
+	batch *peerBatch
+}
+
+func (p *peerResolver) ID() string         { return p.peer.ID }
+func (p *peerResolver) LastPing() float64  { return float64(p.peer.LastPing) }
+func (p *peerResolver) Profile() graphJSON { return graphJSON{p.peer.RawMap} }
+func (p *peerResolver) Name() string       { return p.profileString("name") }
+func (p *peerResolver) Handle() string     { return p.profileString("handle") }
+
+func (p *peerResolver) profileString(field string) string {
+	s, _ := p.peer.RawMap[field].(string)
+	return s
+}
+
+func (p *peerResolver) Listings() ([]*listingResolver, error) {
+	return p.batch.listingsOf(p.peer.ID)
+}
+
+func (p *peerResolver) Ratings() ([]*ratingResolver, error) {
+	return p.batch.ratingsOf(p.peer.ID)
+}
+
+type ratingResolver struct {
+	rating *p2p.Rating
+	batch  *ratingBatch
+}
+
+func (r *ratingResolver) Type() string        { return r.rating.Type }
+func (r *ratingResolver) SourceID() string    { return r.rating.Source }
+func (r *ratingResolver) Destination() string { return r.rating.Destination }
+
+func (r *ratingResolver) Content() *graphJSON {
+	if r.rating.Content == nil {
+		return nil
+	}
+	return &graphJSON{r.rating.Content}
+}
+
+func (r *ratingResolver) Source() *peerResolver {
+	return r.batch.source(r.rating.Source)
+}
+
+// listingBatch holds the listings resolved together, the vendors and
+// ratings of all of them are loaded once the first one is asked for.
+type listingBatch struct {
+	loader   *graphLoader
+	listings []*listingResolver
+
+	vendors  sync.Once
+	vendorOf map[string]*peerResolver
+
+	ratings    sync.Once
+	ratingsFor map[string][]*ratingResolver
+	ratingsErr error
+}
+
+func newListingBatch(loader *graphLoader, docs []interface{}) ([]*listingResolver, error) {
+	batch := &listingBatch{loader: loader, listings: make([]*listingResolver, len(docs))}
+	for i, doc := range docs {
+		listing := &listingResolver{listing: &models.ListingClass{}, batch: batch}
+		if err := decodeDocument(doc, listing.listing); err != nil {
+			return nil, err
+		}
+		if err := decodeDocument(doc, &listing.document); err != nil {
+			return nil, err
+		}
+		batch.listings[i] = listing
+	}
+	return batch.listings, nil
+}
+
+func (b *listingBatch) vendor(id string) *peerResolver {
+	b.vendors.Do(func() {
+		ids := make([]string, len(b.listings))
+		for i, listing := range b.listings {
+			ids[i] = listing.VendorID()
+		}
+		b.vendorOf = peersByID(newPeerBatch(b.loader, b.loader.loadPeers(ids)))
+	})
+	return b.vendorOf[id]
+}
+
+func (b *listingBatch) ratingsOf(destination string) ([]*ratingResolver, error) {
+	b.ratings.Do(func() {
+		destinations := make([]string, len(b.listings))
+		for i, listing := range b.listings {
+			destinations[i] = listing.VendorID() + "@" + listing.listing.Slug
+		}
+		var found map[string][]*p2p.Rating
+		found, b.ratingsErr = b.loader.loadRatings(destinations)
+		b.ratingsFor = newRatingBatch(b.loader, found)
+	})
+	return nonNilRatings(b.ratingsFor[destination]), b.ratingsErr
+}
+
+// peerBatch holds the peers resolved together, the listings and ratings of all of them are loaded at once.
+type peerBatch struct {
+	loader *graphLoader
+	peers  []*peerResolver
+
+	listings    sync.Once
+	listingsFor map[string][]*listingResolver
+	listingsErr error
+
+	ratings    sync.Once
+	ratingsFor map[string][]*ratingResolver
+	ratingsErr error
+}
+
+func newPeerBatch(loader *graphLoader, peers []*models.Peer) []*peerResolver {
+	batch := &peerBatch{loader: loader, peers: make([]*peerResolver, len(peers))}
+	for i, peer := range peers {
+		batch.peers[i] = &peerResolver{peer: peer, batch: batch}
+	}
+	return batch.peers
+}
+
+func peersByID(peers []*peerResolver) map[string]*peerResolver {
+	byID := make(map[string]*peerResolver, len(peers))
+	for _, peer := range peers {
+		byID[peer.peer.ID] = peer
+	}
+	return byID
+}
+
+func (b *peerBatch) ids() []string {
+	ids := make([]string, len(b.peers))
+	for i, peer := range b.peers {
+		ids[i] = peer.peer.ID
+	}
+	return ids
+}
+
+func (b *peerBatch) listingsOf(id string) ([]*listingResolver, error) {
+	b.listings.Do(func() {
+		found := b.loader.loadListings(b.ids())
+
+		// The listings of every peer share a batch so their vendors and ratings load together too
+		docs := []interface{}{}
+		for _, peer := range b.peers {
+			docs = append(docs, found[peer.peer.ID]...)
+		}
+		var listings []*listingResolver
+		listings, b.listingsErr = newListingBatch(b.loader, docs)
+
+		b.listingsFor = make(map[string][]*listingResolver)
+		for _, listing := range listings {
+			b.listingsFor[listing.VendorID()] = append(b.listingsFor[listing.VendorID()], listing)
+		}
+	})
+	listings := b.listingsFor[id]
+	if listings == nil {
+		listings = []*listingResolver{}
+	}
+	return listings, b.listingsErr
+}
+
+func (b *peerBatch) ratingsOf(id string) ([]*ratingResolver, error) {
+	b.ratings.Do(func() {
+		var found map[string][]*p2p.Rating
+		found, b.ratingsErr = b.loader.loadRatings(b.ids())
+		b.ratingsFor = newRatingBatch(b.loader, found)
+	})
+	return nonNilRatings(b.ratingsFor[id]), b.ratingsErr
+}
+
+// ratingBatch holds the ratings resolved together, the peers that gave them are loaded at once.
+type ratingBatch struct {
+	loader  *graphLoader
+	ratings []*ratingResolver
+
+	sources  sync.Once
+	sourceOf map[string]*peerResolver
+}
+
+// newRatingBatch returns the resolvers of the ratings of each destination, all in one batch.
+func newRatingBatch(loader *graphLoader, found map[string][]*p2p.Rating) map[string][]*ratingResolver {
+	batch := &ratingBatch{loader: loader}
+	resolvers := make(map[string][]*ratingResolver, len(found))
+	for destination, ratings := range found {
+		resolvers[destination] = []*ratingResolver{}
+		for _, rating := range ratings {
+			resolver := &ratingResolver{rating: rating, batch: batch}
+			batch.ratings = append(batch.ratings, resolver)
+			resolvers[destination] = append(resolvers[destination], resolver)
+		}
+	}
+	return resolvers
+}
+
+func (b *ratingBatch) source(id string) *peerResolver {
+	b.sources.Do(func() {
+		ids := make([]string, len(b.ratings))
+		for i, rating := range b.ratings {
+			ids[i] = rating.rating.Source
+		}
+		b.sourceOf = peersByID(newPeerBatch(b.loader, b.loader.loadPeers(ids)))
+	})
+	return b.sourceOf[id]
+}
+
+type graphLoaderKey struct{}
+
+// graphLoader caches the reads of one GraphQL request, every peer, the listings
+// of every vendor and the ratings of every destination are read once.
+type graphLoader struct {
+	lock     sync.Mutex
+	peers    map[string]*models.Peer
+	listings map[string][]interface{}
+	ratings  map[string][]*p2p.Rating
+}
+
+func newGraphLoader() *graphLoader {
+	return &graphLoader{
+		peers:    make(map[string]*models.Peer),
+		listings: make(map[string][]interface{}),
+		ratings:  make(map[string][]*p2p.Rating),
+	}
+}
+
+func loaderOf(ctx context.Context) *graphLoader {
+	if loader, ok := ctx.Value(graphLoaderKey{}).(*graphLoader); ok {
+		return loader
+	}
+	return newGraphLoader()
+}
+
+// loadPeers returns the indexed peers among ids, the peers that aren't indexed are left out.
+func (l *graphLoader) loadPeers(ids []string) []*models.Peer {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	missing := []string{}
+	for _, id := range ids {
+		if _, loaded := l.peers[id]; !loaded && id != "" {
+			l.peers[id] = nil
+			missing = append(missing, id)
+		}
+	}
+
+	if len(missing) != 0 {
+		for id, peer := range readPeers(missing) {
+			l.peers[id] = peer
+		}
+	}
+
+	peers := []*models.Peer{}
+	seen := make(map[string]bool)
+	for _, id := range ids {
+		if peer := l.peers[id]; peer != nil && !seen[id] {
+			seen[id] = true
+			peers = append(peers, peer)
+		}
+	}
+	return peers
+}
+
+// readPeers reads the indexed peers among ids from the store, it's swapped out by the tests.
+var readPeers = readStorePeers
+
+func readStorePeers(ids []string) map[string]*models.Peer {
+	docIDs := make([]string, len(ids))
+	store.PMapLock.RLock()
+	for i, id := range ids {
+		docIDs[i] = store.PMap[id]
+	}
+	store.PMapLock.RUnlock()
+
+	peers := make(map[string]*models.Peer)
+	for i, id := range ids {
+		if docIDs[i] == "" {
+			continue
+		}
+		doc, err := store.PeerData.Get(docIDs[i])
+		if err != nil {
+			continue
+		}
+		peer := &models.Peer{}
+		if err := doc.Export(peer); err == nil {
+			peers[id] = peer
+		}
+	}
+	return peers
+}
+
+// loadListings returns the listings of each of peerIDs, read in one pass over the listings.
+func (l *graphLoader) loadListings(peerIDs []string) map[string][]interface{} {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	missing := make(map[string]bool)
+	for _, id := range peerIDs {
+		if _, loaded := l.listings[id]; !loaded {
+			l.listings[id] = []interface{}{}
+			missing[id] = true
+		}
+	}
+
+	if len(missing) != 0 {
+		for _, doc := range store.Listings.Search("").Documents {
+			hit := doc.ExportI()
+			if id := servicestore.VendorPeer(hit); missing[id] {
+				l.listings[id] = append(l.listings[id], hit)
+			}
+		}
+	}
+
+	found := make(map[string][]interface{}, len(peerIDs))
+	for _, id := range peerIDs {
+		found[id] = l.listings[id]
+	}
+	return found
+}
+
+// loadRatings returns the ratings given to each of destinations, read in one transaction.
+func (l *graphLoader) loadRatings(destinations []string) (map[string][]*p2p.Rating, error) {
+	if ratingManager == nil {
+		return nil, rest.Errorf(http.StatusServiceUnavailable, rest.CodeUnavailable, "the ratings aren't available")
+	}
+
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	missing := []string{}
+	for _, destination := range destinations {
+		if _, loaded := l.ratings[destination]; !loaded {
+			missing = append(missing, destination)
+		}
+	}
+
+	if len(missing) != 0 {
+		found, err := ratingsOf(missing)
+		if err != nil {
+			return nil, rest.Errorf(http.StatusInternalServerError, rest.CodeInternal, "failed to read the ratings: %v", err)
+		}
+		for destination, ratings := range found {
+			l.ratings[destination] = ratings
+		}
+	}
+
+	found := make(map[string][]*p2p.Rating, len(destinations))
+	for _, destination := range destinations {
+		found[destination] = l.ratings[destination]
+	}
+	return found, nil
+}
+
+// ratingsOf reads the ratings of destinations from the ratings database, it's swapped out by the tests.
+var ratingsOf = func(destinations []string) (map[string][]*p2p.Rating, error) {
+	return ratingManager.RatingsOf(destinations)
+}
+
+// decodeDocument converts a document of the stores to v.
+func decodeDocument(doc interface{}, v interface{}) error {
+	b, err := json.Marshal(doc)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, v)
+}
+
+func nonNilStrings(s []string) []string {
+	if s == nil {
+		return []string{}
+	}
+	return s
+}
+
+func nonNilRatings(ratings []*ratingResolver) []*ratingResolver {
+	if ratings == nil {
+		return []*ratingResolver{}
+	}
+	return ratings
+}
@@ -0,0 +1,153 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"sort"
+	"testing"
+
+	"github.com/kimitzu/kimitzu-services/models"
+	"github.com/kimitzu/kimitzu-services/p2p"
+)
+
+func TestGraphQLQueries(t *testing.T) {
+	queries := []string{
+		`{ listings(search: {query: "plumber", limit: 10, near: {lat: 14.5, lng: 121, radiusMeters: 5000}}) {
+			count nextCursor
+			listings { hash title price { amount currency } location { city } vendor { name ratings { type source { id } } } }
+		} }`,
+		`{ peer(id: "QmPeer") { id listings { slug ratings { content } } } ratings(id: "QmPeer@plumbing") { destination } }`,
+		`{ peers(search: {where: {field: "profile.name", eq: "Nokusu"}}) { peers { id profile } } }`,
+	}
+	for _, query := range queries {
+		if errs := graphQLSchema.Validate(query); len(errs) != 0 {
+			t.Errorf("%v: %v", query, errs)
+		}
+	}
+
+	tooDeep := `{ listings { listings { vendor { listings { vendor { listings { vendor { listings { hash } } } } } } } } }`
+	if errs := graphQLSchema.Validate(tooDeep); len(errs) == 0 {
+		t.Error("a query nested deeper than the limit was accepted")
+	}
+}
+
+func TestGraphSearchParams(t *testing.T) {
+	query, limit, onlineOnly := "plumber", int32(5), true
+	where := &graphJSON{}
+	if err := where.UnmarshalGraphQL(map[string]interface{}{"field": "item.price", "lte": 5000}); err != nil {
+		t.Fatal(err)
+	}
+
+	params, err := (&graphSearch{
+		Query:      &query,
+		Limit:      &limit,
+		OnlineOnly: &onlineOnly,
+		Where:      where,
+		Near:       &graphNear{Lat: 1, Lng: 2, RadiusMeters: 3},
+	}).params()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if params.Query != query || params.Limit != 5 || !params.OnlineOnly || params.Near.RadiusMeters != 3 {
+		t.Errorf("unexpected params %+v", params)
+	}
+	if params.Where == nil || params.Where.Field != "item.price" || params.Where.Lte != 5000.0 {
+		t.Errorf("unexpected where %+v", params.Where)
+	}
+
+	var none *graphSearch
+	if params, err := none.params(); err != nil || params.Query != "" {
+		t.Errorf("unexpected params %+v, %v", params, err)
+	}
+}
+
+func TestGraphQLBatching(t *testing.T) {
+	store_, detach := attachTestStore(t)
+	defer detach()
+
+	dir, err := ioutil.TempDir("", "ratings")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	ratings, err := p2p.InitializeRatingManager(path.Join(dir, "ratings.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ratings.Close()
+	previous := ratingManager
+	AttachRatings(ratings)
+	defer AttachRatings(previous)
+
+	vendors := []string{"QmVendorA", "QmVendorB", "QmVendorC"}
+	for _, vendor := range vendors {
+		peer := &models.Peer{ID: vendor, RawMap: map[string]interface{}{"name": vendor}}
+		docID, err := store_.PeerData.Insert(vendor, peer)
+		if err != nil {
+			t.Fatal(err)
+		}
+		store_.PMapSet(vendor, docID)
+		for i := 0; i < 2; i++ {
+			insertListing(t, store_, fmt.Sprintf("%v-%v", vendor, i), vendor)
+		}
+		if err := ratings.InsertRating(&p2p.Rating{Type: "vendor", Source: "QmBuyer", Destination: vendor}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	peerReads, ratingReads := [][]string{}, [][]string{}
+	defer func(peers func([]string) map[string]*models.Peer, ratings func([]string) (map[string][]*p2p.Rating, error)) {
+		readPeers, ratingsOf = peers, ratings
+	}(readPeers, ratingsOf)
+	readPeers = func(ids []string) map[string]*models.Peer {
+		peerReads = append(peerReads, ids)
+		return readStorePeers(ids)
+	}
+	ratingsOf = func(destinations []string) (map[string][]*p2p.Rating, error) {
+		ratingReads = append(ratingReads, destinations)
+		return ratings.RatingsOf(destinations)
+	}
+
+	ctx := context.WithValue(context.Background(), graphLoaderKey{}, newGraphLoader())
+	response := graphQLSchema.Exec(ctx, `{ listings(search: {limit: 10}) { listings { hash vendor { id ratings { type } } } } }`, "", nil)
+	if len(response.Errors) != 0 {
+		t.Fatal(response.Errors)
+	}
+
+	result := struct {
+		Listings struct {
+			Listings []struct {
+				Hash   string
+				Vendor struct {
+					ID      string
+					Ratings []struct{ Type string }
+				}
+			}
+		}
+	}{}
+	if err := decodeDocument(response.Data, &result); err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Listings.Listings) != 6 {
+		t.Fatalf("expected 6 listings, got %v", len(result.Listings.Listings))
+	}
+	for _, listing := range result.Listings.Listings {
+		if listing.Vendor.ID == "" || len(listing.Vendor.Ratings) != 1 {
+			t.Errorf("%v: unexpected vendor %+v", listing.Hash, listing.Vendor)
+		}
+	}
+
+	if len(peerReads) != 1 || len(ratingReads) != 1 {
+		t.Fatalf("expected the vendors and their ratings to be read once, got %v and %v", peerReads, ratingReads)
+	}
+	if len(peerReads[0]) != len(vendors) {
+		t.Errorf("expected the %v vendors to be read, got %v", len(vendors), peerReads[0])
+	}
+	sort.Strings(ratingReads[0])
+	if fmt.Sprint(ratingReads[0]) != fmt.Sprint(vendors) {
+		t.Errorf("expected the ratings of %v, got %v", vendors, ratingReads[0])
+	}
+}
@@ -0,0 +1,342 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/structpb"
+
+	"github.com/kimitzu/kimitzu-services/models"
+	"github.com/kimitzu/kimitzu-services/p2p"
+	"github.com/kimitzu/kimitzu-services/rest"
+	"github.com/kimitzu/kimitzu-services/rpc"
+	"github.com/kimitzu/kimitzu-services/tokens"
+)
+
+// rpcScopes are the token scopes of the gRPC methods, the read ones are open with OpenReads.
+var rpcScopes = map[string]string{
+	rpc.MethodSearchListings: tokens.ScopeRead,
+	rpc.MethodSearchPeers:    tokens.ScopeRead,
+	rpc.MethodGetPeer:        tokens.ScopeRead,
+	rpc.MethodSeekRatings:    tokens.ScopeRead,
+	rpc.MethodAddPeer:        tokens.ScopeAdmin,
+	rpc.MethodPublishRating:  tokens.ScopeRatings,
+}
+
+// rpcCodes maps the error codes of the HTTP API to gRPC codes.
+var rpcCodes = map[string]codes.Code{
+	rest.CodeBadRequest:       codes.InvalidArgument,
+	rest.CodeInvalidQuery:     codes.InvalidArgument,
+	rest.CodeNotFound:         codes.NotFound,
+	rest.CodeUnauthorized:     codes.Unauthenticated,
+	rest.CodeForbidden:        codes.PermissionDenied,
+	rest.CodeUnavailable:      codes.Unavailable,
+	rest.CodeUpstreamFailure:  codes.Unavailable,
+	rest.CodeTimeout:          codes.DeadlineExceeded,
+	rest.CodeInternal:         codes.Internal,
+	rest.CodeMethodNotAllowed: codes.Unimplemented,
+}
+
+// RPCServer serves the gRPC service from the same store and ratings as the HTTP API.
+type RPCServer struct {
+	rpc.UnimplementedServicesServer
+	ratings *p2p.RatingManager
+}
+
+// NewGRPCServer returns a gRPC server of the service. Callers authenticate with an API token
+// in the authorization metadata, reads don't need one if policy.OpenReads is set.
+func NewGRPCServer(policy AuthPolicy, ratings *p2p.RatingManager) *grpc.Server {
+	server := grpc.NewServer(
+		grpc.UnaryInterceptor(func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+			if err := authorizeRPC(ctx, info.FullMethod, policy.OpenReads); err != nil {
+				return nil, rpcError(err)
+			}
+			resp, err := handler(ctx, req)
+			return resp, rpcError(err)
+		}),
+		grpc.StreamInterceptor(func(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+			if err := authorizeRPC(stream.Context(), info.FullMethod, policy.OpenReads); err != nil {
+				return rpcError(err)
+			}
+			return rpcError(handler(srv, stream))
+		}),
+	)
+	rpc.RegisterServicesServer(server, &RPCServer{ratings: ratings})
+	return server
+}
+
+func (s *RPCServer) SearchListings(ctx context.Context, in *rpc.SearchRequest) (*rpc.SearchResult, error) {
+	params, err := searchQuery(in)
+	if err != nil {
+		return nil, err
+	}
+	result, err := searchListings(ctx, params)
+	if err != nil {
+		return nil, err
+	}
+	return searchResult(result)
+}
+
+func (s *RPCServer) SearchPeers(ctx context.Context, in *rpc.SearchRequest) (*rpc.SearchResult, error) {
+	params, err := searchQuery(in)
+	if err != nil {
+		return nil, err
+	}
+	result, err := searchPeers(ctx, params)
+	if err != nil {
+		return nil, err
+	}
+	return searchResult(result)
+}
+
+func (s *RPCServer) GetPeer(ctx context.Context, in *rpc.PeerRequest) (*rpc.Peer, error) {
+	found, err := getPeer(ctx, in.Id, in.Force)
+	if err != nil {
+		return nil, err
+	}
+	peer, ok := found.(*models.Peer)
+	if !ok {
+		peer = &models.Peer{}
+		if err := json.Unmarshal(found.(json.RawMessage), peer); err != nil {
+			return nil, rest.Errorf(http.StatusInternalServerError, rest.CodeInternal, "failed to decode the peer: %v", err)
+		}
+	}
+	return rpcPeer(peer)
+}
+
+func (s *RPCServer) AddPeer(ctx context.Context, in *rpc.PeerRequest) (*rpc.Peer, error) {
+	if in.Id == "" {
+		return nil, rest.Errorf(http.StatusBadRequest, rest.CodeBadRequest, "id is required")
+	}
+	peer, err := crawlPeer(ctx, in.Id)
+	if err != nil {
+		return nil, err
+	}
+	return rpcPeer(peer)
+}
+
+func (s *RPCServer) PublishRating(ctx context.Context, in *rpc.PublishRequest) (*rpc.PublishResult, error) {
+	if in.Contract == nil {
+		return nil, rest.Errorf(http.StatusBadRequest, rest.CodeBadRequest, "contract is required")
+	}
+	contract := &models.Contract{}
+	if err := rpc.DecodeStruct(in.Contract, contract); err != nil {
+		return nil, rest.Errorf(http.StatusBadRequest, rest.CodeBadRequest, "invalid contract: %v", err)
+	}
+	sat := p2p.Sat
+	if sat == nil {
+		return nil, p2pUnavailable
+	}
+
+	rating, err := s.ratings.IngestRating(in.Type, contract)
+	if err != nil {
+		return nil, rest.Errorf(http.StatusBadRequest, rest.CodeBadRequest, "%v", err)
+	}
+
+	stored, err := rpcRating(rating)
+	if err != nil {
+		return nil, err
+	}
+	result := &rpc.PublishResult{Rating: stored}
+	if err := p2p.BroadcastRating(sat, rating); err != nil {
+		result.BroadcastError = err.Error()
+	}
+	return result, nil
+}
+
+// SeekRatings streams the ratings as the peers answer, until all of them did or the caller goes away.
+func (s *RPCServer) SeekRatings(in *rpc.SeekRequest, stream rpc.Services_SeekRatingsServer) error {
+	if in.Ids == "" {
+		return rest.Errorf(http.StatusBadRequest, rest.CodeBadRequest, "ids is required")
+	}
+	sat := p2p.Sat
+	if sat == nil {
+		return p2pUnavailable
+	}
+
+	rs, err := sat.Seek("get_rating", p2p.RatingRequest{Identity: in.Ids})
+	if err != nil {
+		return rest.Errorf(http.StatusBadGateway, rest.CodeUpstreamFailure, "failed to broadcast: %v", err)
+	}
+	// The satellite closes the stream once every peer answered, it is drained if the caller leaves first
+	defer func() {
+		go func() {
+			for range rs.Stream {
+			}
+		}()
+	}()
+
+	for {
+		select {
+		case inbound, ok := <-rs.Stream:
+			if !ok {
+				return nil
+			}
+			rating, err := rpcRating(inbound.As(&p2p.Rating{}).(*p2p.Rating))
+			if err != nil {
+				return err
+			}
+			if err := stream.Send(rating); err != nil {
+				return err
+			}
+		case <-stream.Context().Done():
+			return stream.Context().Err()
+		}
+	}
+}
+
+var p2pUnavailable = rest.Errorf(http.StatusServiceUnavailable, rest.CodeUnavailable, "the p2p network isn't ready")
+
+// searchQuery converts a search request to the query of the HTTP API.
+func searchQuery(in *rpc.SearchRequest) (*models.AdvancedSearchQuery, error) {
+	params := &models.AdvancedSearchQuery{
+		Query:            in.Query,
+		Filters:          in.Filters,
+		Limit:            int(in.Limit),
+		Start:            int(in.Start),
+		Sort:             in.Sort,
+		Generous:         in.Generous,
+		Fuzzy:            in.Fuzzy,
+		Order:            in.Order,
+		Currency:         in.Currency,
+		MinPrice:         in.MinPrice,
+		MaxPrice:         in.MaxPrice,
+		Category:         in.Category,
+		RateMethod:       in.RateMethod,
+		Hours:            in.Hours,
+		Units:            in.Units,
+		Expand:           in.Expand,
+		VendorProjection: in.VendorProjection,
+		OnlineOnly:       in.OnlineOnly,
+		Explain:          in.Explain,
+		Cursor:           in.Cursor,
+	}
+	for _, transform := range in.Transforms {
+		params.Transforms = append(params.Transforms, transform.AsInterface())
+	}
+	if in.Near != nil {
+		params.Near = &models.NearQuery{Lat: in.Near.Lat, Lng: in.Near.Lng, RadiusMeters: in.Near.RadiusMeters}
+	}
+	if in.Where != nil {
+		params.Where = &models.FilterNode{}
+		if err := rpc.DecodeStruct(in.Where, params.Where); err != nil {
+			return nil, rest.Errorf(http.StatusBadRequest, rest.CodeBadRequest, "invalid where: %v", err)
+		}
+	}
+	return params, nil
+}
+
+// searchResult converts a page of the HTTP API.
+func searchResult(result *APIListResult) (*rpc.SearchResult, error) {
+	out := &rpc.SearchResult{
+		Count:      int32(result.Count),
+		Limit:      int32(result.Limit),
+		NextStart:  int32(result.NextStart),
+		NextCursor: result.NextCursor,
+		Data:       make([]*structpb.Struct, len(result.Data)),
+	}
+	for i, document := range result.Data {
+		data, err := rpc.NewStruct(document)
+		if err != nil {
+			return nil, rest.Errorf(http.StatusInternalServerError, rest.CodeInternal, "failed to export the documents: %v", err)
+		}
+		out.Data[i] = data
+	}
+	for _, e := range result.FilterErrors {
+		out.FilterErrors = append(out.FilterErrors, &rpc.FilterError{Filter: e.Filter, Message: e.Message})
+	}
+	if result.Explain != nil {
+		explain, err := rpc.NewStruct(result.Explain)
+		if err != nil {
+			return nil, rest.Errorf(http.StatusInternalServerError, rest.CodeInternal, "failed to export the explanation: %v", err)
+		}
+		out.Explain = explain
+	}
+	return out, nil
+}
+
+func rpcPeer(peer *models.Peer) (*rpc.Peer, error) {
+	profile, err := rpc.NewStruct(peer.RawMap)
+	if err != nil {
+		return nil, rest.Errorf(http.StatusInternalServerError, rest.CodeInternal, "failed to export the peer: %v", err)
+	}
+	fields, err := rpc.NewStruct(peer.Fields)
+	if err != nil {
+		return nil, rest.Errorf(http.StatusInternalServerError, rest.CodeInternal, "failed to export the peer: %v", err)
+	}
+	return &rpc.Peer{Id: peer.ID, Profile: profile, LastPing: peer.LastPing, Fields: fields}, nil
+}
+
+func rpcRating(rating *p2p.Rating) (*rpc.Rating, error) {
+	content, err := rpc.NewValue(rating.Content)
+	if err != nil {
+		return nil, rest.Errorf(http.StatusInternalServerError, rest.CodeInternal, "failed to export the rating: %v", err)
+	}
+	out := &rpc.Rating{
+		Type:          rating.Type,
+		Source:        rating.Source,
+		SourcePk:      &rpc.Pubkeys{Identity: rating.SourcePK.Identity, Bitcoin: rating.SourcePK.Bitcoin},
+		Destination:   rating.Destination,
+		DestinationPk: &rpc.Pubkeys{Identity: rating.DestinationPK.Identity, Bitcoin: rating.DestinationPK.Bitcoin},
+		Content:       content,
+	}
+	for _, signature := range rating.Signatures {
+		out.Signatures = append(out.Signatures, &rpc.Signature{Section: signature.Section, SignatureBytes: signature.SignatureBytes})
+	}
+	return out, nil
+}
+
+// authorizeRPC checks the API token of a call to method.
+func authorizeRPC(ctx context.Context, method string, openReads bool) error {
+	scope, exists := rpcScopes[method]
+	if !exists {
+		scope = tokens.ScopeAdmin
+	}
+	if openReads && scope == tokens.ScopeRead {
+		return nil
+	}
+
+	md, _ := metadata.FromIncomingContext(ctx)
+	raw := ""
+	if values := md.Get("authorization"); len(values) != 0 {
+		raw = strings.TrimPrefix(values[0], "Bearer ")
+	}
+	if !strings.HasPrefix(raw, tokens.Prefix) {
+		return rest.Errorf(http.StatusUnauthorized, rest.CodeUnauthorized, "an API token is required")
+	}
+	if apiTokens == nil {
+		return rest.Errorf(http.StatusUnauthorized, rest.CodeUnauthorized, "API tokens aren't enabled")
+	}
+
+	token, err := apiTokens.Verify(raw)
+	if err != nil {
+		return rest.Errorf(http.StatusUnauthorized, rest.CodeUnauthorized, "%v", err)
+	}
+	if !token.Allows(scope) {
+		return rest.Errorf(http.StatusForbidden, rest.CodeForbidden, "the token lacks the %v scope", scope)
+	}
+	return nil
+}
+
+// rpcError converts the errors of the API to gRPC statuses, errors that already are one are kept.
+func rpcError(err error) error {
+	if err == nil {
+		return nil
+	}
+	if _, ok := status.FromError(err); ok {
+		return err
+	}
+
+	e := rest.AsError(err)
+	code, exists := rpcCodes[e.Code]
+	if !exists {
+		code = codes.Unknown
+	}
+	return status.Error(code, e.Message)
+}
@@ -0,0 +1,107 @@
+package api
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"testing"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/structpb"
+
+	"github.com/kimitzu/kimitzu-services/p2p"
+	"github.com/kimitzu/kimitzu-services/rest"
+	"github.com/kimitzu/kimitzu-services/rpc"
+	"github.com/kimitzu/kimitzu-services/tokens"
+)
+
+func TestAuthorizeRPC(t *testing.T) {
+	dir, err := ioutil.TempDir("", "api")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	store_, err := tokens.Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	AttachTokens(store_)
+	defer AttachTokens(nil)
+
+	_, read, err := store_.Issue("read", []string{tokens.ScopeRead}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		method, token string
+		openReads     bool
+		code          codes.Code
+	}{
+		{rpc.MethodSearchListings, "", true, codes.OK},
+		{rpc.MethodSearchListings, "", false, codes.Unauthenticated},
+		{rpc.MethodSeekRatings, read, false, codes.OK},
+		{rpc.MethodPublishRating, read, true, codes.PermissionDenied},
+		{rpc.MethodAddPeer, "", true, codes.Unauthenticated},
+		{rpc.MethodAddPeer, tokens.Prefix + "00.00", true, codes.Unauthenticated},
+	}
+	for _, c := range cases {
+		ctx := context.Background()
+		if c.token != "" {
+			ctx = metadata.NewIncomingContext(ctx, metadata.Pairs("authorization", "Bearer "+c.token))
+		}
+		if code := status.Code(rpcError(authorizeRPC(ctx, c.method, c.openReads))); code != c.code {
+			t.Errorf("%v with %q: got %v, want %v", c.method, c.token, code, c.code)
+		}
+	}
+}
+
+func TestRPCError(t *testing.T) {
+	err := rpcError(rest.Errorf(http.StatusGatewayTimeout, rest.CodeTimeout, "timed out"))
+	if s, _ := status.FromError(err); s.Code() != codes.DeadlineExceeded || s.Message() != "timed out" {
+		t.Errorf("unexpected status %v", s)
+	}
+	if rpcError(nil) != nil {
+		t.Error("nil isn't an error")
+	}
+}
+
+func TestSearchQuery(t *testing.T) {
+	where, err := rpc.NewStruct(map[string]interface{}{"field": "item.price", "lte": 5000})
+	if err != nil {
+		t.Fatal(err)
+	}
+	minPrice := 10.0
+	params, err := searchQuery(&rpc.SearchRequest{
+		Query:      "plumber",
+		Limit:      5,
+		MinPrice:   &minPrice,
+		Near:       &rpc.Near{Lat: 1, Lng: 2, RadiusMeters: 3},
+		Where:      where,
+		Transforms: []*structpb.Value{structpb.NewStringValue("$.hash")},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if params.Query != "plumber" || params.Limit != 5 || *params.MinPrice != 10 || params.MaxPrice != nil || params.Near.RadiusMeters != 3 {
+		t.Errorf("unexpected params %+v", params)
+	}
+	if params.Where == nil || params.Where.Field != "item.price" || params.Where.Lte != 5000.0 {
+		t.Errorf("unexpected where %+v", params.Where)
+	}
+	if len(params.Transforms) != 1 || params.Transforms[0] != "$.hash" {
+		t.Errorf("unexpected transforms %v", params.Transforms)
+	}
+
+	rating, err := rpcRating(&p2p.Rating{Type: "vendor", Source: "QmBuyer", Content: map[string]interface{}{"overall": 5}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rating.Source != "QmBuyer" || rating.Content.GetStructValue().Fields["overall"].GetNumberValue() != 5 {
+		t.Errorf("unexpected rating %v", rating)
+	}
+}
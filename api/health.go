@@ -0,0 +1,58 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/levigross/grequests"
+
+	"github.com/kimitzu/kimitzu-services/health"
+)
+
+// nodeCheckTimeout is how long each request of the node check waits for the node.
+const nodeCheckTimeout = time.Second * 2
+
+var healthChecks = health.NewChecks()
+
+// AttachHealth sets the checks reported by /readyz.
+func AttachHealth(checks *health.Checks) {
+	healthChecks = checks
+}
+
+// HTTPReadyz reports the status of every component, the details and errors of the
+// components are only given to authenticated callers.
+func HTTPReadyz(w http.ResponseWriter, r *http.Request) {
+	if !authenticated(r) {
+		healthChecks.HTTPReadyzSummary(w, r)
+		return
+	}
+	healthChecks.HTTPReadyz(w, r)
+}
+
+// NodeHealthCheck reports the OpenBazaar node down when it can't be reached
+// or when it turns down the requests of the daemon.
+func NodeHealthCheck() health.Check {
+	return health.Check{Name: "openbazaar", Required: true, Probe: probeNode}
+}
+
+func probeNode(ctx context.Context) (health.Details, error) {
+	info, err := getInfo(nodeCheckTimeout)
+	if err != nil {
+		return nil, fmt.Errorf("the node can't be reached: %v", err)
+	}
+	details := health.Details{"obVersion": info.OBVersion, "authenticationEnabled": info.Authenticated}
+
+	// The crawler reads the profiles of the node without credentials
+	res, err := grequests.Get("http://127.0.0.1:8100/ob/profile", &grequests.RequestOptions{RequestTimeout: nodeCheckTimeout})
+	if err != nil {
+		return details, fmt.Errorf("the node's API can't be reached: %v", err)
+	}
+	if res.StatusCode == http.StatusUnauthorized || res.StatusCode == http.StatusForbidden {
+		details["authenticated"] = false
+		return details, fmt.Errorf("the node rejected the requests of the daemon")
+	}
+	details["authenticated"] = true
+	return details, nil
+}
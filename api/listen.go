@@ -0,0 +1,196 @@
+package api
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path"
+	"time"
+)
+
+const (
+	// DefaultListen only accepts connections from the local machine.
+	DefaultListen = "127.0.0.1:8109"
+
+	tlsFolder        = "tls"
+	selfSignedCert   = "cert.pem"
+	selfSignedKey    = "key.pem"
+	selfSignedValid  = time.Hour * 24 * 365
+	selfSignedRenew  = time.Hour * 24 * 7
+	selfSignedIssuer = "Kimitzu Services"
+)
+
+// ListenConfig describes where the API is served. Address is skipped when empty, TLS is used
+// with CertFile and KeyFile, or with a certificate generated in DataPath when SelfSigned is set.
+// Socket is the path of a Unix domain socket to serve on as well.
+type ListenConfig struct {
+	Address    string
+	CertFile   string
+	KeyFile    string
+	SelfSigned bool
+	Socket     string
+	DataPath   string
+}
+
+// TLS returns whether the TCP listener uses TLS.
+func (c *ListenConfig) TLS() bool {
+	return c.SelfSigned || c.CertFile != ""
+}
+
+// Listen opens the listeners of conf.
+func Listen(conf ListenConfig) ([]net.Listener, error) {
+	listeners := []net.Listener{}
+	closeAll := func() {
+		for _, l := range listeners {
+			l.Close()
+		}
+	}
+
+	if conf.Address != "" {
+		l, err := net.Listen("tcp", conf.Address)
+		if err != nil {
+			return nil, err
+		}
+		listeners = append(listeners, l)
+
+		if conf.TLS() {
+			certFile, keyFile := conf.CertFile, conf.KeyFile
+			if conf.CertFile == "" {
+				certFile, keyFile, err = EnsureSelfSignedCert(conf.DataPath)
+				if err != nil {
+					closeAll()
+					return nil, err
+				}
+			}
+
+			cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+			if err != nil {
+				closeAll()
+				return nil, fmt.Errorf("failed to load the TLS certificate: %v", err)
+			}
+			listeners[0] = tls.NewListener(l, &tls.Config{
+				Certificates: []tls.Certificate{cert},
+				MinVersion:   tls.VersionTLS12,
+				// gRPC clients only connect once HTTP/2 is negotiated
+				NextProtos: []string{"h2", "http/1.1"},
+			})
+		}
+	}
+
+	if conf.Socket != "" {
+		// A socket left behind by a previous run would make Listen fail
+		if info, err := os.Stat(conf.Socket); err == nil && info.Mode()&os.ModeSocket != 0 {
+			os.Remove(conf.Socket)
+		}
+		l, err := net.Listen("unix", conf.Socket)
+		if err != nil {
+			closeAll()
+			return nil, err
+		}
+		listeners = append(listeners, l)
+		if err := os.Chmod(conf.Socket, 0600); err != nil {
+			closeAll()
+			return nil, err
+		}
+	}
+
+	if len(listeners) == 0 {
+		return nil, fmt.Errorf("no address or socket to serve the API on")
+	}
+	return listeners, nil
+}
+
+// Serve serves server on every listener, returning once one of them fails.
+func Serve(server *http.Server, listeners []net.Listener) error {
+	errs := make(chan error, len(listeners))
+	for _, l := range listeners {
+		go func(l net.Listener) {
+			errs <- server.Serve(l)
+		}(l)
+	}
+	return <-errs
+}
+
+// EnsureSelfSignedCert returns the self-signed certificate stored in dataPath,
+// a new one is generated when there is none or it's about to expire.
+func EnsureSelfSignedCert(dataPath string) (certFile, keyFile string, err error) {
+	folder := path.Join(dataPath, tlsFolder)
+	certFile = path.Join(folder, selfSignedCert)
+	keyFile = path.Join(folder, selfSignedKey)
+
+	if b, err := ioutil.ReadFile(certFile); err == nil {
+		if block, _ := pem.Decode(b); block != nil {
+			cert, err := x509.ParseCertificate(block.Bytes)
+			if err == nil && time.Until(cert.NotAfter) > selfSignedRenew {
+				if _, err := os.Stat(keyFile); err == nil {
+					return certFile, keyFile, nil
+				}
+			}
+		}
+	}
+
+	if err := os.MkdirAll(folder, 0700); err != nil {
+		return "", "", err
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return "", "", err
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return "", "", err
+	}
+
+	now := time.Now()
+	template := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{Organization: []string{selfSignedIssuer}, CommonName: "localhost"},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.Add(selfSignedValid),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		DNSNames:              []string{"localhost"},
+		IPAddresses:           []net.IP{net.IPv4(127, 0, 0, 1), net.IPv6loopback},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return "", "", err
+	}
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return "", "", err
+	}
+
+	if err := ioutil.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}), 0600); err != nil {
+		return "", "", err
+	}
+	if err := ioutil.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0644); err != nil {
+		return "", "", err
+	}
+	return certFile, keyFile, nil
+}
+
+// IsLoopback returns whether address only accepts connections from the local machine.
+func IsLoopback(address string) bool {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return false
+	}
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
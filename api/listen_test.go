@@ -0,0 +1,55 @@
+package api
+
+import (
+	"crypto/tls"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+)
+
+func TestSelfSignedCert(t *testing.T) {
+	dir, err := ioutil.TempDir("", "api")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	certFile, keyFile, err := EnsureSelfSignedCert(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tls.LoadX509KeyPair(certFile, keyFile); err != nil {
+		t.Fatal(err)
+	}
+
+	// The certificate is reused while it's valid
+	before, _ := ioutil.ReadFile(certFile)
+	if _, _, err := EnsureSelfSignedCert(dir); err != nil {
+		t.Fatal(err)
+	}
+	after, _ := ioutil.ReadFile(certFile)
+	if string(before) != string(after) {
+		t.Error("certificate was generated again")
+	}
+
+	if info, err := os.Stat(path.Join(dir, tlsFolder, selfSignedKey)); err != nil || info.Mode().Perm() != 0600 {
+		t.Errorf("key file permissions: %v, %v", info.Mode(), err)
+	}
+}
+
+func TestIsLoopback(t *testing.T) {
+	cases := map[string]bool{
+		"127.0.0.1:8109": true,
+		"localhost:8109": true,
+		"[::1]:8109":     true,
+		"0.0.0.0:8109":   false,
+		":8109":          false,
+		"10.0.0.2:8109":  false,
+	}
+	for address, loopback := range cases {
+		if IsLoopback(address) != loopback {
+			t.Errorf("IsLoopback(%v) = %v", address, !loopback)
+		}
+	}
+}
@@ -0,0 +1,310 @@
+package api
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"github.com/kimitzu/kimitzu-services/rest"
+	"github.com/kimitzu/kimitzu-services/tokens"
+)
+
+const (
+	// AuthCookieName is the cookie the OpenBazaar node hands out to authenticated clients.
+	AuthCookieName = "OpenBazaar_Auth_Cookie"
+
+	nodeAuthTTL = time.Second * 30
+)
+
+// RouteRule matches requests by path and method. A Path ending in * matches
+// every path starting with it, no Methods matches every method. Scope is what
+// an API token needs to be allowed on the route, admin if it's left empty.
+type RouteRule struct {
+	Path    string
+	Methods []string
+	Scope   string
+}
+
+// Matches returns whether r falls under the rule.
+func (rule RouteRule) Matches(r *http.Request) bool {
+	if strings.HasSuffix(rule.Path, "*") {
+		if !strings.HasPrefix(r.URL.Path, strings.TrimSuffix(rule.Path, "*")) {
+			return false
+		}
+	} else if r.URL.Path != rule.Path {
+		return false
+	}
+
+	if len(rule.Methods) == 0 {
+		return true
+	}
+	for _, method := range rule.Methods {
+		if method == r.Method {
+			return true
+		}
+	}
+	return false
+}
+
+// AuthPolicy decides which routes need credentials. Open routes never do, public routes
+// only do when OpenReads is off, every other route needs them when the node has
+// authentication enabled. Privileged routes can only be reached from the local machine
+// when it doesn't. API tokens are accepted on the routes their scopes allow regardless of the node.
+type AuthPolicy struct {
+	Open       []RouteRule
+	Public     []RouteRule
+	Privileged []RouteRule
+	OpenReads  bool
+}
+
+// DefaultAuthPolicy opens the read only routes the client browses with and
+// guards the ones that change the stores or expose the internals of the daemon.
+var DefaultAuthPolicy = AuthPolicy{
+	// Supervisors probe these without credentials, even when the node can't be reached
+	Open: []RouteRule{
+		{Path: "/healthz", Methods: []string{"GET"}},
+		{Path: "/readyz", Methods: []string{"GET"}},
+	},
+	Public: []RouteRule{
+		{Path: "/authenticate", Scope: tokens.ScopeRead},
+		{Path: "/info/version", Methods: []string{"GET"}, Scope: tokens.ScopeRead},
+		{Path: "/openapi.json", Methods: []string{"GET"}, Scope: tokens.ScopeRead},
+		{Path: "/graphql", Methods: []string{"POST"}, Scope: tokens.ScopeRead},
+
+		{Path: "/kimitzu/location/query", Scope: tokens.ScopeRead},
+		{Path: "/kimitzu/location/codesfrom", Scope: tokens.ScopeRead},
+		{Path: "/kimitzu/location/nearest", Scope: tokens.ScopeRead},
+		{Path: "/kimitzu/location/bbox", Scope: tokens.ScopeRead},
+		{Path: "/kimitzu/location/reverse", Scope: tokens.ScopeRead},
+		{Path: "/kimitzu/location/pluscode", Scope: tokens.ScopeRead},
+		{Path: "/kimitzu/location/info", Scope: tokens.ScopeRead},
+
+		{Path: "/kimitzu/peers/listings", Scope: tokens.ScopeRead},
+		{Path: "/kimitzu/peer/get", Scope: tokens.ScopeRead},
+		{Path: "/kimitzu/peers", Scope: tokens.ScopeRead},
+		{Path: "/kimitzu/peer/search", Scope: tokens.ScopeRead},
+
+		{Path: "/kimitzu/listing", Scope: tokens.ScopeRead},
+		{Path: "/kimitzu/search", Scope: tokens.ScopeRead},
+		{Path: "/kimitzu/search/suggest", Scope: tokens.ScopeRead},
+		{Path: "/kimitzu/taxonomy", Scope: tokens.ScopeRead},
+		{Path: "/kimitzu/presence", Scope: tokens.ScopeRead},
+		{Path: "/kimitzu/media", Scope: tokens.ScopeRead},
+
+		{Path: "/p2p/peers", Methods: []string{"GET"}, Scope: tokens.ScopeRead},
+		{Path: "/p2p/ratings/get/*", Scope: tokens.ScopeRead},
+		{Path: "/p2p/ratings/seek/*", Scope: tokens.ScopeRead},
+		{Path: "/p2p/ratings/seek-sync/*", Scope: tokens.ScopeRead},
+
+		{Path: "/v1/listings", Methods: []string{"GET"}, Scope: tokens.ScopeRead},
+		{Path: "/v1/listings/search", Methods: []string{"POST"}, Scope: tokens.ScopeRead},
+		{Path: "/v1/listings/*", Methods: []string{"GET"}, Scope: tokens.ScopeRead},
+		{Path: "/v1/peers", Methods: []string{"GET"}, Scope: tokens.ScopeRead},
+		{Path: "/v1/peers/search", Methods: []string{"POST"}, Scope: tokens.ScopeRead},
+		{Path: "/v1/peers/*", Methods: []string{"GET"}, Scope: tokens.ScopeRead},
+		{Path: "/v1/search/suggest", Methods: []string{"GET"}, Scope: tokens.ScopeRead},
+		{Path: "/v1/taxonomy", Methods: []string{"GET"}, Scope: tokens.ScopeRead},
+		{Path: "/v1/presence", Methods: []string{"GET"}, Scope: tokens.ScopeRead},
+		{Path: "/v1/info/version", Methods: []string{"GET"}, Scope: tokens.ScopeRead},
+	},
+	Privileged: []RouteRule{
+		{Path: "/debug/*"},
+		{Path: "/p2p/ratings/publish/*", Scope: tokens.ScopeRatings},
+		{Path: "/kimitzu/location/import"},
+		{Path: "/kimitzu/tokens"},
+		{Path: "/v1/debug/*"},
+		{Path: "/v1/tokens*"},
+	},
+	OpenReads: true,
+}
+
+func (p *AuthPolicy) public(r *http.Request) bool {
+	return matching(p.Public, r) != nil
+}
+
+func (p *AuthPolicy) privileged(r *http.Request) bool {
+	return matching(p.Privileged, r) != nil
+}
+
+// scope returns the scope an API token needs for r.
+func (p *AuthPolicy) scope(r *http.Request) string {
+	rule := matching(p.Privileged, r)
+	if rule == nil {
+		rule = matching(p.Public, r)
+	}
+	if rule == nil || rule.Scope == "" {
+		return tokens.ScopeAdmin
+	}
+	return rule.Scope
+}
+
+func matching(rules []RouteRule, r *http.Request) *RouteRule {
+	for i := range rules {
+		if rules[i].Matches(r) {
+			return &rules[i]
+		}
+	}
+	return nil
+}
+
+// nodeAuth caches the authentication settings of the OpenBazaar node.
+type nodeAuth struct {
+	lock    *sync.Mutex
+	info    KimitzuInfoP
+	known   bool
+	fetched time.Time
+}
+
+var authSettings = &nodeAuth{lock: &sync.Mutex{}}
+
+// get returns the settings of the node, known is false if the node was never reached.
+// The last known settings are kept while the node can't be reached.
+func (a *nodeAuth) get() (info KimitzuInfoP, known bool) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	if time.Since(a.fetched) > nodeAuthTTL {
+		a.fetched = time.Now()
+		if info, err := GetInfo(); err == nil {
+			a.info = info
+			a.known = true
+		}
+	}
+	return a.info, a.known
+}
+
+// RequireAuth returns a middleware enforcing policy on the routes of a router.
+func RequireAuth(policy AuthPolicy) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			// Preflight requests never carry credentials, they're answered without reaching the
+			// handlers. Other OPTIONS requests need credentials like any other method would.
+			if r.Method == "OPTIONS" && r.Header.Get("Access-Control-Request-Method") != "" {
+				w.WriteHeader(http.StatusNoContent)
+				return
+			}
+			if matching(policy.Open, r) != nil || (policy.OpenReads && policy.public(r)) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			if raw := bearerToken(r); strings.HasPrefix(raw, tokens.Prefix) {
+				if apiTokens == nil {
+					authError(w, r, rest.Errorf(http.StatusUnauthorized, rest.CodeUnauthorized, "API tokens aren't enabled"))
+					return
+				}
+				token, err := apiTokens.Verify(raw)
+				if err != nil {
+					authError(w, r, rest.Errorf(http.StatusUnauthorized, rest.CodeUnauthorized, "%v", err))
+					return
+				}
+				if scope := policy.scope(r); !token.Allows(scope) {
+					authError(w, r, rest.Errorf(http.StatusForbidden, rest.CodeForbidden, "the token lacks the %v scope", scope))
+					return
+				}
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			info, known := authSettings.get()
+			if !known {
+				authError(w, r, rest.Errorf(http.StatusServiceUnavailable, rest.CodeUnavailable, "the OpenBazaar node can't be reached to check the credentials"))
+				return
+			}
+
+			if info.Authenticated {
+				if !hasCredentials(r, info) {
+					authError(w, r, rest.Errorf(http.StatusUnauthorized, rest.CodeUnauthorized, "credentials are required"))
+					return
+				}
+			} else if policy.privileged(r) && !isLocalRequest(r) {
+				authError(w, r, rest.Errorf(http.StatusForbidden, rest.CodeForbidden, "only local requests are allowed"))
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// authenticated tells whether r carries credentials the protected routes would accept,
+// open routes may answer those requests with more.
+func authenticated(r *http.Request) bool {
+	if raw := bearerToken(r); strings.HasPrefix(raw, tokens.Prefix) {
+		if apiTokens == nil {
+			return false
+		}
+		_, err := apiTokens.Verify(raw)
+		return err == nil
+	}
+
+	info, known := authSettings.get()
+	if !known {
+		return false
+	}
+	if info.Authenticated {
+		return hasCredentials(r, info)
+	}
+	return isLocalRequest(r)
+}
+
+// authError rejects r, in the envelope for the /v1 routes.
+func authError(w http.ResponseWriter, r *http.Request, err *rest.Error) {
+	if strings.HasPrefix(r.URL.Path, "/v1/") {
+		rest.WriteError(w, r, err)
+		return
+	}
+	legacyError(w, err)
+}
+
+// hasCredentials checks the auth cookie of the node, sent either as a
+// cookie or as a bearer token, or the node's username and password.
+func hasCredentials(r *http.Request, info KimitzuInfoP) bool {
+	if info.Cookie != "" {
+		if cookie, err := r.Cookie(AuthCookieName); err == nil && secureEquals(cookie.Value, info.Cookie) {
+			return true
+		}
+
+		if secureEquals(bearerToken(r), info.Cookie) {
+			return true
+		}
+	}
+
+	if username, password, ok := r.BasicAuth(); ok {
+		h := sha256.Sum256([]byte(password))
+		return secureEquals(username, info.Username) && secureEquals(hex.EncodeToString(h[:]), info.Password)
+	}
+	return false
+}
+
+func bearerToken(r *http.Request) string {
+	header := r.Header.Get("Authorization")
+	if !strings.HasPrefix(header, "Bearer ") {
+		return ""
+	}
+	return strings.TrimPrefix(header, "Bearer ")
+}
+
+func secureEquals(a, b string) bool {
+	return subtle.ConstantTimeCompare([]byte(a), []byte(b)) == 1
+}
+
+func isLocalRequest(r *http.Request) bool {
+	// Connections over the Unix socket have no remote address
+	if r.RemoteAddr == "" || r.RemoteAddr == "@" {
+		return true
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return false
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
@@ -0,0 +1,167 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/kimitzu/kimitzu-services/health"
+	"github.com/kimitzu/kimitzu-services/tokens"
+)
+
+func TestAuthPolicy(t *testing.T) {
+	cases := []struct {
+		method, path       string
+		public, privileged bool
+	}{
+		{"POST", "/kimitzu/search", true, false},
+		{"GET", "/info/version", true, false},
+		{"POST", "/info/version", false, false},
+		{"GET", "/kimitzu/peer/add", false, false},
+		{"GET", "/debug/pprof/heap", false, true},
+		{"GET", "/debug/flush", false, true},
+		{"POST", "/p2p/ratings/publish/fulfill", false, true},
+		{"GET", "/p2p/ratings/get/Qm/1,2", true, false},
+		{"GET", "/kimitzu/peers/other", false, false},
+	}
+
+	for _, c := range cases {
+		r := httptest.NewRequest(c.method, c.path, nil)
+		if public := DefaultAuthPolicy.public(r); public != c.public {
+			t.Errorf("%v %v: public = %v, want %v", c.method, c.path, public, c.public)
+		}
+		if privileged := DefaultAuthPolicy.privileged(r); privileged != c.privileged {
+			t.Errorf("%v %v: privileged = %v, want %v", c.method, c.path, privileged, c.privileged)
+		}
+	}
+}
+
+func TestHasCredentials(t *testing.T) {
+	info := KimitzuInfoP{
+		Cookie:   "cookie",
+		Username: "user",
+		// sha256 of "pass"
+		Password: "d74ff0ee8da3b9806b18c877dbf29bbde50b5bd8e4dad7a3a725000feb82e8f1",
+	}
+
+	r := httptest.NewRequest("GET", "/debug/flush", nil)
+	if hasCredentials(r, info) {
+		t.Error("request without credentials was accepted")
+	}
+
+	r.Header.Set("Authorization", "Bearer cookie")
+	if !hasCredentials(r, info) {
+		t.Error("bearer token was rejected")
+	}
+
+	r = httptest.NewRequest("GET", "/debug/flush", nil)
+	r.SetBasicAuth("user", "pass")
+	if !hasCredentials(r, info) {
+		t.Error("basic auth was rejected")
+	}
+
+	r = httptest.NewRequest("GET", "/debug/flush", nil)
+	r.SetBasicAuth("user", "wrong")
+	if hasCredentials(r, info) {
+		t.Error("wrong password was accepted")
+	}
+}
+
+func TestTokenScopes(t *testing.T) {
+	dir, err := ioutil.TempDir("", "api")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	store_, err := tokens.Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	AttachTokens(store_)
+	defer AttachTokens(nil)
+
+	_, ratings, err := store_.Issue("ratings", []string{tokens.ScopeRatings}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	policy := DefaultAuthPolicy
+	policy.OpenReads = false
+	handler := RequireAuth(policy)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	cases := []struct {
+		method, path, token string
+		preflight           bool
+		code                int
+	}{
+		{"POST", "/p2p/ratings/publish/fulfill", ratings, false, 200},
+		{"GET", "/debug/flush", ratings, false, 403},
+		{"POST", "/kimitzu/search", ratings, false, 403},
+		{"POST", "/kimitzu/search", tokens.Prefix + "00.00", false, 401},
+		{"GET", "/readyz", "", false, 200},
+		{"OPTIONS", "/debug/flush", ratings, false, 403},
+		{"OPTIONS", "/debug/pprof/heap", ratings, false, 403},
+		{"OPTIONS", "/debug/pprof/profile", tokens.Prefix + "00.00", false, 401},
+		{"OPTIONS", "/debug/flush", "", true, 204},
+	}
+	for _, c := range cases {
+		r := httptest.NewRequest(c.method, c.path, nil)
+		r.Header.Set("Authorization", "Bearer "+c.token)
+		if c.preflight {
+			r.Header.Set("Access-Control-Request-Method", "GET")
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		if w.Code != c.code {
+			t.Errorf("%v %v: got %v, want %v", c.method, c.path, w.Code, c.code)
+		}
+	}
+}
+
+func TestReadyzDetails(t *testing.T) {
+	previous := authSettings
+	authSettings = &nodeAuth{lock: &sync.Mutex{}, info: KimitzuInfoP{Authenticated: true, Cookie: "cookie"}, known: true, fetched: time.Now()}
+	defer func() { authSettings = previous }()
+
+	checks := health.NewChecks()
+	checks.Register(health.Check{Name: "store", Required: true, Probe: func(ctx context.Context) (health.Details, error) {
+		return health.Details{"peers": 3}, nil
+	}})
+	AttachHealth(checks)
+	defer AttachHealth(health.NewChecks())
+
+	cases := []struct {
+		token    string
+		detailed bool
+	}{
+		{"", false},
+		{"wrong", false},
+		{"cookie", true},
+	}
+	for _, c := range cases {
+		r := httptest.NewRequest("GET", "/readyz", nil)
+		if c.token != "" {
+			r.Header.Set("Authorization", "Bearer "+c.token)
+		}
+		w := httptest.NewRecorder()
+		HTTPReadyz(w, r)
+
+		report := health.Report{}
+		if err := json.Unmarshal(w.Body.Bytes(), &report); err != nil {
+			t.Fatal(err)
+		}
+		if len(report.Components) != 1 || report.Components[0].Status != health.StatusUp {
+			t.Fatalf("%q: unexpected report %+v", c.token, report)
+		}
+		if detailed := report.Components[0].Details != nil; detailed != c.detailed {
+			t.Errorf("%q: details given = %v, want %v", c.token, detailed, c.detailed)
+		}
+	}
+}
@@ -0,0 +1,292 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync"
+
+	graphql "github.com/graph-gophers/graphql-go"
+
+	"github.com/kimitzu/kimitzu-services/health"
+	"github.com/kimitzu/kimitzu-services/location"
+	"github.com/kimitzu/kimitzu-services/models"
+	"github.com/kimitzu/kimitzu-services/openapi"
+	"github.com/kimitzu/kimitzu-services/p2p"
+	"github.com/kimitzu/kimitzu-services/rest"
+	"github.com/kimitzu/kimitzu-services/servicestore"
+	"github.com/kimitzu/kimitzu-services/tokens"
+	"github.com/kimitzu/kimitzu-services/voyager"
+)
+
+// ErrorResponse is the error body of the legacy routes.
+type ErrorResponse struct {
+	Error   string `json:"error"`
+	Message string `json:"message,omitempty"`
+}
+
+// Param is a query parameter of a Route.
+type Param struct {
+	Name        string
+	Description string
+	Required    bool
+}
+
+// Route documents a route of the API in the OpenAPI document. Request and Response are
+// values of the body types, Envelope wraps Response in a rest.Response.
+type Route struct {
+	Method   string
+	Path     string
+	Tag      string
+	Summary  string
+	Query    []Param
+	Request  interface{}
+	Response interface{}
+	Envelope bool
+	// ContentType of the response when it isn't JSON
+	ContentType string
+}
+
+// ratingsResult is the body of the rating lookups of p2p.AttachAPI.
+type ratingsResult struct {
+	Ratings []p2p.Rating `json:"ratings"`
+	Error   string       `json:"error"`
+}
+
+// publishResult is the body of /p2p/ratings/publish/{type}.
+type publishResult struct {
+	Error string `json:"error"`
+}
+
+var pathParams = regexp.MustCompile(`{([^}:]+)(:[^}]*)?}`)
+
+// Routes are every route of AttachAPI and p2p.AttachAPI, the OpenAPI document is built from them.
+var Routes = []Route{
+	{Method: "GET", Path: "/kimitzu/location/query", Tag: "location", Summary: "Postal codes matching every given field",
+		Query:    []Param{{Name: "zip"}, {Name: "country"}, {Name: "address", Description: "Substring of the address"}, {Name: "x"}, {Name: "y"}},
+		Response: []location.Location{}},
+	{Method: "GET", Path: "/kimitzu/location/codesfrom", Tag: "location", Summary: "Postal codes within a radius of a point",
+		Query:    []Param{{Name: "x", Required: true}, {Name: "y", Required: true}, {Name: "within", Description: "Radius in kilometers"}},
+		Response: []location.LocationDistance{}},
+	{Method: "GET", Path: "/kimitzu/location/nearest", Tag: "location", Summary: "The k postal codes closest to a point",
+		Query:    []Param{{Name: "x", Required: true}, {Name: "y", Required: true}, {Name: "k"}},
+		Response: []location.LocationDistance{}},
+	{Method: "GET", Path: "/kimitzu/location/bbox", Tag: "location", Summary: "Postal codes inside a map viewport",
+		Query:    []Param{{Name: "minX", Required: true}, {Name: "minY", Required: true}, {Name: "maxX", Required: true}, {Name: "maxY", Required: true}, {Name: "limit"}},
+		Response: []location.Location{}},
+	{Method: "GET", Path: "/kimitzu/location/reverse", Tag: "location", Summary: "Postal code closest to a point",
+		Query:    []Param{{Name: "x", Required: true}, {Name: "y", Required: true}},
+		Response: location.LocationDistance{}},
+	{Method: "GET", Path: "/kimitzu/location/pluscode", Tag: "location", Summary: "Decodes a Plus Code, or encodes a point without one",
+		Query:    []Param{{Name: "code"}, {Name: "x"}, {Name: "y"}, {Name: "length"}},
+		Response: location.PlusCodeResult{}},
+	{Method: "GET", Path: "/kimitzu/location/info", Tag: "location", Summary: "Version and coverage of the location dataset",
+		Response: location.DatasetInfo{}},
+	{Method: "POST", Path: "/kimitzu/location/import", Tag: "location", Summary: "Imports a GeoNames postal code dump",
+		Query:   []Param{{Name: "country", Description: "Only import the rows of this country code"}},
+		Request: "", Response: location.DatasetInfo{}},
+
+	{Method: "GET", Path: "/kimitzu/peers/listings", Tag: "listings", Summary: "Every indexed listing", Response: []models.ListingClass{}},
+	{Method: "GET", Path: "/kimitzu/peer/get", Tag: "peers", Summary: "A peer, crawled first if it isn't indexed",
+		Query:    []Param{{Name: "id", Description: "Peer ID, the node's own if empty"}, {Name: "force", Description: "true crawls the peer again"}},
+		Response: models.Peer{}},
+	{Method: "GET", Path: "/kimitzu/peers", Tag: "peers", Summary: "Every indexed peer", Response: []models.Peer{}},
+	{Method: "GET", Path: "/kimitzu/peer/add", Tag: "peers", Summary: "Crawls and indexes a peer",
+		Query:    []Param{{Name: "id", Required: true}},
+		Response: StatusResult{}},
+	{Method: "POST", Path: "/kimitzu/peer/search", Tag: "peers", Summary: "Searches the peers",
+		Request: models.AdvancedSearchQuery{}, Response: APIListResult{}},
+
+	{Method: "GET", Path: "/kimitzu/listing", Tag: "listings", Summary: "A listing by hash",
+		Query:    []Param{{Name: "hash", Required: true}},
+		Response: models.ListingClass{}},
+	{Method: "POST", Path: "/kimitzu/search", Tag: "listings", Summary: "Searches the listings",
+		Request: models.AdvancedSearchQuery{}, Response: APIListResult{}},
+	{Method: "GET", Path: "/kimitzu/search/suggest", Tag: "listings", Summary: "Autocomplete entries",
+		Query:    []Param{{Name: "q", Required: true}, {Name: "limit"}},
+		Response: []servicestore.Suggestion{}},
+	{Method: "GET", Path: "/kimitzu/taxonomy", Tag: "listings", Summary: "Browses the service taxonomy with listing counts",
+		Query:    []Param{{Name: "code"}, {Name: "classification", Description: `A path like "Home Services > Plumbing"`}},
+		Response: TaxonomyResult{}},
+	{Method: "GET", Path: "/kimitzu/presence", Tag: "peers", Summary: "Cached online status of peers",
+		Query:    []Param{{Name: "ids", Description: "Comma separated peer IDs", Required: true}},
+		Response: map[string]voyager.PresenceStatus{}},
+	{Method: "GET", Path: "/kimitzu/tokens", Tag: "tokens", Summary: "The API tokens", Response: []tokens.Token{}},
+	{Method: "POST", Path: "/kimitzu/tokens", Tag: "tokens", Summary: "Issues an API token", Request: TokenRequest{}, Response: IssuedToken{}},
+	{Method: "DELETE", Path: "/kimitzu/tokens", Tag: "tokens", Summary: "Revokes an API token",
+		Query:    []Param{{Name: "id", Required: true}},
+		Response: StatusResult{}},
+	{Method: "GET", Path: "/kimitzu/media", Tag: "media", Summary: "An image, from the data folder or the node",
+		Query:    []Param{{Name: "id", Required: true}},
+		Response: "", ContentType: "application/octet-stream"},
+
+	{Method: "GET", Path: "/authenticate", Tag: "auth", Summary: "Whether the node has authentication enabled", Response: map[string]bool{}},
+	{Method: "POST", Path: "/authenticate", Tag: "auth", Summary: "Checks the node's credentials and returns the auth cookie", Request: AuthPayload{}, Response: map[string]string{}},
+	{Method: "PATCH", Path: "/authenticate", Tag: "auth", Summary: "Changes the node's credentials", Request: AuthPayload{}, Response: map[string]interface{}{}},
+	{Method: "DELETE", Path: "/authenticate", Tag: "auth", Summary: "Disables the node's authentication", Request: AuthPayload{}, Response: map[string]interface{}{}},
+
+	{Method: "POST", Path: "/debug/flush", Tag: "debug", Summary: "Flushes the search engines", Response: StatusResult{}},
+	{Method: "GET", Path: "/info/version", Tag: "info", Summary: "Versions of the node and the services", Response: VersionInfo{}},
+	{Method: "POST", Path: "/graphql", Tag: "graphql", Summary: "Runs a GraphQL query over the listings, peers and ratings",
+		Request: GraphQLRequest{}, Response: graphql.Response{}},
+	{Method: "GET", Path: "/openapi.json", Tag: "info", Summary: "This document", Response: map[string]interface{}{}},
+	{Method: "GET", Path: "/healthz", Tag: "info", Summary: "Answers as long as the daemon is alive", Response: health.Report{}},
+	{Method: "GET", Path: "/readyz", Tag: "info", Summary: "Status of every component, 503 when a required one is down, details for authenticated callers", Response: health.Report{}},
+
+	{Method: "GET", Path: "/v1/listings", Tag: "v1", Summary: "Every indexed listing", Response: []models.ListingClass{}, Envelope: true},
+	{Method: "POST", Path: "/v1/listings/search", Tag: "v1", Summary: "Searches the listings", Request: models.AdvancedSearchQuery{}, Response: APIListResult{}, Envelope: true},
+	{Method: "GET", Path: "/v1/listings/{hash}", Tag: "v1", Summary: "A listing by hash", Response: models.ListingClass{}, Envelope: true},
+	{Method: "GET", Path: "/v1/peers", Tag: "v1", Summary: "Every indexed peer", Response: []models.Peer{}, Envelope: true},
+	{Method: "POST", Path: "/v1/peers", Tag: "v1", Summary: "Crawls and indexes a peer", Request: AddPeerRequest{}, Response: models.Peer{}, Envelope: true},
+	{Method: "POST", Path: "/v1/peers/search", Tag: "v1", Summary: "Searches the peers", Request: models.AdvancedSearchQuery{}, Response: APIListResult{}, Envelope: true},
+	{Method: "GET", Path: "/v1/peers/{id}", Tag: "v1", Summary: `A peer, crawled first if it isn't indexed, "self" is the node's own`,
+		Query:    []Param{{Name: "force", Description: "true crawls the peer again"}},
+		Response: models.Peer{}, Envelope: true},
+	{Method: "GET", Path: "/v1/search/suggest", Tag: "v1", Summary: "Autocomplete entries",
+		Query:    []Param{{Name: "q", Required: true}, {Name: "limit"}},
+		Response: []servicestore.Suggestion{}, Envelope: true},
+	{Method: "GET", Path: "/v1/taxonomy", Tag: "v1", Summary: "Browses the service taxonomy with listing counts",
+		Query:    []Param{{Name: "code"}, {Name: "classification"}},
+		Response: TaxonomyResult{}, Envelope: true},
+	{Method: "GET", Path: "/v1/presence", Tag: "v1", Summary: "Cached online status of peers",
+		Query:    []Param{{Name: "ids", Description: "Comma separated peer IDs", Required: true}},
+		Response: map[string]voyager.PresenceStatus{}, Envelope: true},
+	{Method: "GET", Path: "/v1/tokens", Tag: "v1", Summary: "The API tokens", Response: []tokens.Token{}, Envelope: true},
+	{Method: "POST", Path: "/v1/tokens", Tag: "v1", Summary: "Issues an API token", Request: TokenRequest{}, Response: IssuedToken{}, Envelope: true},
+	{Method: "DELETE", Path: "/v1/tokens/{id}", Tag: "v1", Summary: "Revokes an API token", Response: RevokeResult{}, Envelope: true},
+	{Method: "GET", Path: "/v1/info/version", Tag: "v1", Summary: "Versions of the node and the services", Response: VersionInfo{}, Envelope: true},
+	{Method: "POST", Path: "/v1/debug/flush", Tag: "v1", Summary: "Flushes the search engines", Response: StatusResult{}, Envelope: true},
+
+	{Method: "GET", Path: "/p2p/peers", Tag: "p2p", Summary: "IDs of the connected S/Kademlia peers", Response: []string{}},
+	{Method: "GET", Path: "/p2p/ratings/seek/{ids}", Tag: "p2p", Summary: "Websocket streaming the ratings of the comma separated ids found on the network", Response: p2p.Rating{}},
+	{Method: "POST", Path: "/p2p/ratings/publish/{type}", Tag: "p2p", Summary: `Ingests and broadcasts the rating of a contract, type is "fulfill" or "complete"`,
+		Request: models.Contract{}, Response: publishResult{}},
+	{Method: "GET", Path: "/p2p/ratings/get/{peer}/{ids}", Tag: "p2p", Summary: "Ratings of the comma separated ids held by a peer", Response: ratingsResult{}},
+	{Method: "GET", Path: "/p2p/ratings/seek-sync/{ids}", Tag: "p2p", Summary: "Ratings of the comma separated ids found on the network", Response: ratingsResult{}},
+
+	{Method: "GET", Path: "/debug/pprof/", Tag: "debug", Summary: "pprof index", Response: "", ContentType: "text/html"},
+	{Method: "GET", Path: "/debug/pprof/cmdline", Tag: "debug", Summary: "pprof command line", Response: "", ContentType: "text/plain"},
+	{Method: "GET", Path: "/debug/pprof/profile", Tag: "debug", Summary: "pprof CPU profile", Response: "", ContentType: "application/octet-stream"},
+	{Method: "GET", Path: "/debug/pprof/symbol", Tag: "debug", Summary: "pprof symbols", Response: "", ContentType: "text/plain"},
+	{Method: "GET", Path: "/debug/pprof/goroutine", Tag: "debug", Summary: "pprof goroutine profile", Response: "", ContentType: "application/octet-stream"},
+	{Method: "GET", Path: "/debug/pprof/heap", Tag: "debug", Summary: "pprof heap profile", Response: "", ContentType: "application/octet-stream"},
+	{Method: "GET", Path: "/debug/pprof/threadcreate", Tag: "debug", Summary: "pprof thread creation profile", Response: "", ContentType: "application/octet-stream"},
+	{Method: "GET", Path: "/debug/pprof/block", Tag: "debug", Summary: "pprof blocking profile", Response: "", ContentType: "application/octet-stream"},
+}
+
+// queryDocs describe the fields of a search query that need more than their name.
+var queryDocs = map[string]string{
+	"query":   "Keywords to search for, empty matches every document",
+	"filters": `gval expressions evaluated against each hit as doc, like contains(doc.slug, "golden"). Only whitelisted functions can be called, see servicestore.FilterFunctions`,
+	"transforms": "Kazaam specs (https://github.com/qntfy/kazaam) applied to each hit, like " +
+		`[{"operation": "shift", "spec": {"title": "title", "owner": "parentPeer", "price": "price.amount"}}]`,
+	"sort":   "gval expression ordering the hits",
+	"order":  `"distance" along with near, "price" or "-price", takes precedence over sort`,
+	"cursor": "nextCursor of a previous page, the rest of the query is ignored except for transforms",
+	"expand": `"vendor" embeds the vendorProjection fields of the listing's vendor in each hit`,
+}
+
+var (
+	specOnce sync.Once
+	spec     []byte
+)
+
+// OpenAPI builds the OpenAPI document of Routes.
+func OpenAPI() *openapi.Document {
+	doc := openapi.NewDocument(openapi.Info{
+		Title:       "Kimitzu Services",
+		Version:     ServiceConfig.Version,
+		Description: "Search, location and rating services of the Kimitzu client. The /v1 routes answer in a rest.Response envelope.",
+	})
+
+	for _, route := range Routes {
+		doc.Add(route.Method, route.Path, route.operation(doc))
+	}
+	for field, description := range queryDocs {
+		doc.Describe(models.AdvancedSearchQuery{}, field, description)
+	}
+	return doc
+}
+
+func (route *Route) operation(doc *openapi.Document) *openapi.Operation {
+	op := &openapi.Operation{
+		OperationID: operationID(route.Method, route.Path),
+		Summary:     route.Summary,
+		Tags:        []string{route.Tag},
+		Responses:   make(map[string]*openapi.Response),
+	}
+
+	for _, match := range pathParams.FindAllStringSubmatch(route.Path, -1) {
+		op.Parameters = append(op.Parameters, &openapi.Parameter{Name: match[1], In: "path", Required: true, Schema: &openapi.Schema{Type: "string"}})
+	}
+	for _, param := range route.Query {
+		op.Parameters = append(op.Parameters, &openapi.Parameter{
+			Name:        param.Name,
+			In:          "query",
+			Description: param.Description,
+			Required:    param.Required,
+			Schema:      &openapi.Schema{Type: "string"},
+		})
+	}
+
+	if route.Request != nil {
+		contentType := "application/json"
+		if _, raw := route.Request.(string); raw {
+			contentType = "text/plain"
+		}
+		op.RequestBody = &openapi.RequestBody{
+			Required: true,
+			Content:  map[string]*openapi.MediaType{contentType: {Schema: doc.SchemaOf(route.Request)}},
+		}
+	}
+
+	response := doc.SchemaOf(route.Response)
+	errorSchema := doc.SchemaOf(ErrorResponse{})
+	if route.Envelope {
+		response = envelope(doc, response)
+		errorSchema = envelope(doc, nil)
+	}
+
+	contentType := route.ContentType
+	if contentType == "" {
+		contentType = "application/json"
+	}
+	op.Responses["200"] = &openapi.Response{Description: "OK", Content: map[string]*openapi.MediaType{contentType: {Schema: response}}}
+	op.Responses["default"] = &openapi.Response{Description: "Error", Content: map[string]*openapi.MediaType{"application/json": {Schema: errorSchema}}}
+	return op
+}
+
+// envelope returns the schema of a rest.Response carrying data.
+func envelope(doc *openapi.Document, data *openapi.Schema) *openapi.Schema {
+	schema := &openapi.Schema{Type: "object", Properties: map[string]*openapi.Schema{
+		"requestID": {Type: "string"},
+		"error":     doc.SchemaOf(rest.Error{}),
+	}}
+	if data != nil {
+		schema.Properties["data"] = data
+	}
+	return schema
+}
+
+func operationID(method, path string) string {
+	id := strings.ToLower(method)
+	for _, part := range strings.FieldsFunc(path, func(r rune) bool {
+		return !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9')
+	}) {
+		id += strings.ToUpper(part[:1]) + part[1:]
+	}
+	return id
+}
+
+// HTTPOpenAPI serves the OpenAPI document.
+func HTTPOpenAPI(w http.ResponseWriter, r *http.Request) {
+	if retOK := setupResponse(&w, r); retOK {
+		return
+	}
+
+	specOnce.Do(func() {
+		spec, _ = json.Marshal(OpenAPI())
+	})
+	_, _ = w.Write(spec)
+}
@@ -0,0 +1,112 @@
+package api
+
+import (
+	"encoding/json"
+	"regexp"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/nokusukun/particles/roggy"
+
+	"github.com/kimitzu/kimitzu-services/p2p"
+)
+
+// TestOpenAPICoversRouter walks the routes the daemon serves and checks that
+// the OpenAPI document has an operation for each of them, and nothing else.
+func TestOpenAPICoversRouter(t *testing.T) {
+	router := mux.NewRouter()
+	AttachAPI(roggy.Printer("test"), router)
+	p2p.AttachAPI(nil, router, nil)
+
+	doc := OpenAPI()
+	served := make(map[string]map[string]bool)
+	err := router.Walk(func(route *mux.Route, router *mux.Router, ancestors []*mux.Route) error {
+		if route.GetHandler() == nil {
+			return nil
+		}
+		template, err := route.GetPathTemplate()
+		if err != nil {
+			return err
+		}
+		if served[template] == nil {
+			served[template] = make(map[string]bool)
+		}
+
+		methods, err := route.GetMethods()
+		if err != nil {
+			// Routes without methods answer any of them, one documented method is enough
+			if len(doc.Paths[template]) == 0 {
+				t.Errorf("%v isn't documented", template)
+			}
+			served[template]["*"] = true
+			return nil
+		}
+		for _, method := range methods {
+			served[template][method] = true
+			if doc.Paths[template][strings.ToLower(method)] == nil {
+				t.Errorf("%v %v isn't documented", method, template)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for path, ops := range doc.Paths {
+		for method := range ops {
+			if !served[path]["*"] && !served[path][strings.ToUpper(method)] {
+				t.Errorf("%v %v is documented but not served", strings.ToUpper(method), path)
+			}
+		}
+	}
+}
+
+func TestOpenAPIDocument(t *testing.T) {
+	doc := OpenAPI()
+
+	ids := make(map[string]string)
+	for path, ops := range doc.Paths {
+		params := pathParams.FindAllStringSubmatch(path, -1)
+		for method, op := range ops {
+			if other, exists := ids[op.OperationID]; exists {
+				t.Errorf("%v %v and %v share the operation ID %v", method, path, other, op.OperationID)
+			}
+			ids[op.OperationID] = method + " " + path
+
+			declared := 0
+			for _, param := range op.Parameters {
+				if param.In == "path" {
+					declared++
+				}
+			}
+			if declared != len(params) {
+				t.Errorf("%v %v declares %v path parameters, want %v", method, path, declared, len(params))
+			}
+		}
+	}
+
+	// Every reference resolves to a component
+	b, err := json.Marshal(doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	refs := regexp.MustCompile(`"\$ref":"#/components/schemas/([^"]+)"`).FindAllStringSubmatch(string(b), -1)
+	missing := []string{}
+	for _, ref := range refs {
+		if _, exists := doc.Components.Schemas[ref[1]]; !exists {
+			missing = append(missing, ref[1])
+		}
+	}
+	sort.Strings(missing)
+	if len(missing) != 0 {
+		t.Errorf("unresolved schemas %v", missing)
+	}
+
+	query := doc.Components.Schemas["models.AdvancedSearchQuery"]
+	if query == nil || query.Properties["transforms"] == nil || !strings.Contains(query.Properties["transforms"].Description, "Kazaam") {
+		t.Error("the search query isn't documented")
+	}
+}
@@ -0,0 +1,79 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+
+	"google.golang.org/grpc"
+)
+
+// Server serves the API, and the gRPC service when GRPC is set, as a lifecycle.Service.
+type Server struct {
+	Config  ListenConfig
+	Handler http.Handler
+
+	GRPC       *grpc.Server
+	GRPCConfig ListenConfig
+
+	http *http.Server
+	errs chan error
+}
+
+func (s *Server) Name() string {
+	return "api"
+}
+
+// Start listens and serves in the background, it returns once the listeners are open.
+func (s *Server) Start(ctx context.Context) error {
+	listeners, err := Listen(s.Config)
+	if err != nil {
+		return err
+	}
+
+	var grpcListeners []net.Listener
+	if s.GRPC != nil {
+		grpcListeners, err = Listen(s.GRPCConfig)
+		if err != nil {
+			for _, l := range listeners {
+				l.Close()
+			}
+			return fmt.Errorf("failed to listen for gRPC: %v", err)
+		}
+	}
+
+	s.errs = make(chan error, 2)
+	s.http = &http.Server{Handler: s.Handler}
+	go func() {
+		s.errs <- Serve(s.http, listeners)
+	}()
+	if s.GRPC != nil {
+		go func() {
+			s.errs <- s.GRPC.Serve(grpcListeners[0])
+		}()
+	}
+	return nil
+}
+
+// Errors receives the error of a server that stopped serving before Stop.
+func (s *Server) Errors() <-chan error {
+	return s.errs
+}
+
+// Stop stops accepting connections and waits for the requests in flight until ctx is done.
+func (s *Server) Stop(ctx context.Context) error {
+	if s.GRPC != nil {
+		stopped := make(chan struct{})
+		go func() {
+			s.GRPC.GracefulStop()
+			close(stopped)
+		}()
+		select {
+		case <-stopped:
+		case <-ctx.Done():
+			s.GRPC.Stop()
+		}
+	}
+	return s.http.Shutdown(ctx)
+}
@@ -0,0 +1,103 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/kimitzu/kimitzu-services/rest"
+	"github.com/kimitzu/kimitzu-services/tokens"
+)
+
+var apiTokens *tokens.Store
+
+// AttachTokens sets the store of the API tokens accepted by RequireAuth.
+func AttachTokens(store_ *tokens.Store) {
+	apiTokens = store_
+}
+
+// TokenRequest issues an API token, TTL is in seconds and 0 issues one that never expires.
+type TokenRequest struct {
+	Name   string   `json:"name"`
+	Scopes []string `json:"scopes"`
+	TTL    int64    `json:"ttl"`
+}
+
+// IssuedToken carries the secret of a new token, it's only ever shown once.
+type IssuedToken struct {
+	Token string        `json:"token"`
+	Info  *tokens.Token `json:"info"`
+}
+
+var tokensUnavailable = rest.Errorf(http.StatusServiceUnavailable, rest.CodeUnavailable, "the token store isn't loaded")
+
+// HTTPTokens lists the API tokens on GET, issues one on POST and revokes ?id= on DELETE.
+func HTTPTokens(w http.ResponseWriter, r *http.Request) {
+	if retOK := setupResponse(&w, r); retOK {
+		return
+	}
+
+	if apiTokens == nil {
+		legacyError(w, tokensUnavailable)
+		return
+	}
+
+	switch r.Method {
+	case "GET":
+		_ = json.NewEncoder(w).Encode(apiTokens.List())
+
+	case "POST":
+		request := TokenRequest{}
+		if err := rest.Decode(r, &request); err != nil {
+			legacyError(w, err)
+			return
+		}
+		issued, err := issueToken(request)
+		if err != nil {
+			legacyError(w, err)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(issued)
+
+	case "DELETE":
+		if err := revokeToken(r.URL.Query().Get("id")); err != nil {
+			legacyError(w, err)
+			return
+		}
+		_, _ = fmt.Fprint(w, `{"result": "ok"}`)
+
+	default:
+		legacyError(w, rest.Errorf(http.StatusMethodNotAllowed, rest.CodeMethodNotAllowed, "%v isn't allowed", r.Method))
+	}
+}
+
+func issueToken(request TokenRequest) (*IssuedToken, error) {
+	if apiTokens == nil {
+		return nil, tokensUnavailable
+	}
+	if request.TTL < 0 {
+		return nil, rest.Errorf(http.StatusBadRequest, rest.CodeBadRequest, "ttl can't be negative")
+	}
+
+	info, token, err := apiTokens.Issue(request.Name, request.Scopes, time.Duration(request.TTL)*time.Second)
+	if err != nil {
+		return nil, rest.Errorf(http.StatusBadRequest, rest.CodeBadRequest, "%v", err)
+	}
+	return &IssuedToken{Token: token, Info: info}, nil
+}
+
+func revokeToken(id string) error {
+	if apiTokens == nil {
+		return tokensUnavailable
+	}
+
+	revoked, err := apiTokens.Revoke(id)
+	if err != nil {
+		return rest.Errorf(http.StatusInternalServerError, rest.CodeInternal, "failed to revoke the token: %v", err)
+	}
+	if !revoked {
+		return rest.Errorf(http.StatusNotFound, rest.CodeNotFound, "no token %v", id)
+	}
+	return nil
+}
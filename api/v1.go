@@ -0,0 +1,383 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+
+	"github.com/kimitzu/kimitzu-services/models"
+	"github.com/kimitzu/kimitzu-services/rest"
+	"github.com/kimitzu/kimitzu-services/servicestore"
+	"github.com/kimitzu/kimitzu-services/taxonomy"
+	"github.com/kimitzu/kimitzu-services/voyager"
+)
+
+// AddPeerRequest crawls and indexes a peer.
+type AddPeerRequest struct {
+	ID string `json:"id"`
+}
+
+// VersionInfo is the version of the OpenBazaar node and of the services.
+type VersionInfo struct {
+	OBVersion             string `json:"obDaemon"`
+	KimitzuServiceVersion string `json:"kimitzuDaemon"`
+}
+
+// StatusResult is the outcome of an operation that has nothing else to return.
+type StatusResult struct {
+	Result string `json:"result"`
+}
+
+// RevokeResult is the outcome of revoking a token.
+type RevokeResult struct {
+	Revoked string `json:"revoked"`
+}
+
+// AttachV1 registers the /v1 routes, every response comes in a rest.Response envelope.
+func AttachV1(router *mux.Router) {
+	v1 := router.PathPrefix("/v1").Subrouter()
+
+	v1.Handle("/listings", rest.HandlerFunc(v1Listings)).Methods("GET")
+	v1.Handle("/listings/search", rest.HandlerFunc(v1SearchListings)).Methods("POST")
+	v1.Handle("/listings/{hash}", rest.HandlerFunc(v1Listing)).Methods("GET")
+
+	v1.Handle("/peers", rest.HandlerFunc(v1Peers)).Methods("GET")
+	v1.Handle("/peers", rest.HandlerFunc(v1AddPeer)).Methods("POST")
+	v1.Handle("/peers/search", rest.HandlerFunc(v1SearchPeers)).Methods("POST")
+	v1.Handle("/peers/{id}", rest.HandlerFunc(v1Peer)).Methods("GET")
+
+	v1.Handle("/search/suggest", rest.HandlerFunc(v1Suggest)).Methods("GET")
+	v1.Handle("/taxonomy", rest.HandlerFunc(v1Taxonomy)).Methods("GET")
+	v1.Handle("/presence", rest.HandlerFunc(v1Presence)).Methods("GET")
+
+	v1.Handle("/tokens", rest.HandlerFunc(v1Tokens)).Methods("GET")
+	v1.Handle("/tokens", rest.HandlerFunc(v1IssueToken)).Methods("POST")
+	v1.Handle("/tokens/{id}", rest.HandlerFunc(v1RevokeToken)).Methods("DELETE")
+
+	v1.Handle("/info/version", rest.HandlerFunc(v1Version)).Methods("GET")
+	v1.Handle("/debug/flush", rest.HandlerFunc(v1Flush)).Methods("POST")
+
+	v1.NotFoundHandler = rest.HandlerFunc(func(r *http.Request) (interface{}, error) {
+		return nil, rest.Errorf(http.StatusNotFound, rest.CodeNotFound, "no route %v %v", r.Method, r.URL.Path)
+	})
+	v1.MethodNotAllowedHandler = rest.HandlerFunc(func(r *http.Request) (interface{}, error) {
+		return nil, rest.Errorf(http.StatusMethodNotAllowed, rest.CodeMethodNotAllowed, "%v isn't allowed on %v", r.Method, r.URL.Path)
+	})
+}
+
+func v1Listings(r *http.Request) (interface{}, error) {
+	return exportAll(store.Listings.Search(""))
+}
+
+func v1SearchListings(r *http.Request) (interface{}, error) {
+	params := &models.AdvancedSearchQuery{}
+	if err := rest.Decode(r, params); err != nil {
+		return nil, err
+	}
+	return searchListings(r.Context(), params)
+}
+
+func v1Listing(r *http.Request) (interface{}, error) {
+	return getListing(mux.Vars(r)["hash"])
+}
+
+func v1Peers(r *http.Request) (interface{}, error) {
+	return exportAll(store.PeerData.Search(""))
+}
+
+func v1AddPeer(r *http.Request) (interface{}, error) {
+	request := AddPeerRequest{}
+	if err := rest.Decode(r, &request); err != nil {
+		return nil, err
+	}
+	if request.ID == "" {
+		return nil, rest.Errorf(http.StatusBadRequest, rest.CodeBadRequest, "id is required")
+	}
+
+	peer, err := crawlPeer(r.Context(), request.ID)
+	if err != nil {
+		return nil, err
+	}
+	return rest.WithStatus(http.StatusCreated, peer), nil
+}
+
+func v1SearchPeers(r *http.Request) (interface{}, error) {
+	params := &models.AdvancedSearchQuery{}
+	if err := rest.Decode(r, params); err != nil {
+		return nil, err
+	}
+	return searchPeers(r.Context(), params)
+}
+
+// v1Peer returns the peer {id}, "self" is the peer of the node.
+func v1Peer(r *http.Request) (interface{}, error) {
+	id := mux.Vars(r)["id"]
+	if id == "self" {
+		id = ""
+	}
+	return getPeer(r.Context(), id, r.URL.Query().Get("force") == "true")
+}
+
+func v1Suggest(r *http.Request) (interface{}, error) {
+	limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+	return store.Suggest(r.URL.Query().Get("q"), limit), nil
+}
+
+func v1Taxonomy(r *http.Request) (interface{}, error) {
+	return browseTaxonomy(r.URL.Query().Get("code"), r.URL.Query().Get("classification"))
+}
+
+func v1Presence(r *http.Request) (interface{}, error) {
+	return presence(r.URL.Query().Get("ids"))
+}
+
+func v1Tokens(r *http.Request) (interface{}, error) {
+	if apiTokens == nil {
+		return nil, tokensUnavailable
+	}
+	return apiTokens.List(), nil
+}
+
+func v1IssueToken(r *http.Request) (interface{}, error) {
+	request := TokenRequest{}
+	if err := rest.Decode(r, &request); err != nil {
+		return nil, err
+	}
+	issued, err := issueToken(request)
+	if err != nil {
+		return nil, err
+	}
+	return rest.WithStatus(http.StatusCreated, issued), nil
+}
+
+func v1RevokeToken(r *http.Request) (interface{}, error) {
+	id := mux.Vars(r)["id"]
+	if err := revokeToken(id); err != nil {
+		return nil, err
+	}
+	return RevokeResult{Revoked: id}, nil
+}
+
+func v1Version(r *http.Request) (interface{}, error) {
+	return versionInfo(), nil
+}
+
+func v1Flush(r *http.Request) (interface{}, error) {
+	flush()
+	return StatusResult{Result: "ok"}, nil
+}
+
+// exportAll returns every document of results as a JSON array.
+func exportAll(results interface {
+	ExportJSONArray() (string, error)
+}) (json.RawMessage, error) {
+	data, err := results.ExportJSONArray()
+	if err != nil {
+		return nil, rest.Errorf(http.StatusInternalServerError, rest.CodeInternal, "failed to export the documents: %v", err)
+	}
+	if data == "" {
+		data = "[]"
+	}
+	return json.RawMessage(data), nil
+}
+
+func searchListings(ctx context.Context, params *models.AdvancedSearchQuery) (*APIListResult, error) {
+	results, err := store.QueryListings(ctx, params)
+	if err != nil {
+		return nil, invalidQuery(err)
+	}
+	return listResult(results, params), nil
+}
+
+func searchPeers(ctx context.Context, params *models.AdvancedSearchQuery) (*APIListResult, error) {
+	results, err := store.QueryPeers(ctx, params)
+	if err != nil {
+		return nil, invalidQuery(err)
+	}
+	return listResult(results, params), nil
+}
+
+func listResult(results *servicestore.QueryResult, params *models.AdvancedSearchQuery) *APIListResult {
+	return &APIListResult{
+		Count:        results.Results.Count,
+		Limit:        params.Limit,
+		NextStart:    results.NextStart,
+		NextCursor:   results.NextCursor,
+		Data:         results.Data(),
+		FilterErrors: results.Filters.Errors,
+		Explain:      results.Explain,
+	}
+}
+
+// invalidQuery reports a query that failed to compile or run, the details carry the offending filters.
+// Queries that ran out of time aren't invalid and are reported as timeouts.
+func invalidQuery(err error) *rest.Error {
+	qerr, ok := err.(*servicestore.QueryError)
+	if !ok {
+		qerr = &servicestore.QueryError{Reason: err.Error()}
+	}
+	if qerr.TimedOut {
+		return &rest.Error{Status: http.StatusGatewayTimeout, Code: rest.CodeTimeout, Message: qerr.Error(), Details: qerr}
+	}
+	return &rest.Error{Status: http.StatusBadRequest, Code: rest.CodeInvalidQuery, Message: qerr.Error(), Details: qerr}
+}
+
+func getListing(hash string) (interface{}, error) {
+	results := store.Listings.Search(hash)
+	if len(results.Documents) == 0 {
+		results = store.Listings.Search("").Filter(`doc.hash == ` + strconv.Quote(hash))
+	}
+	if len(results.Documents) == 0 {
+		return nil, rest.Errorf(http.StatusNotFound, rest.CodeNotFound, "no listing %v", hash)
+	}
+	return results.Documents[0].ExportI(), nil
+}
+
+// getPeer returns the peer id, the node's own peer if id is empty. Peers that
+// aren't indexed yet, or all of them if force is set, are crawled first.
+func getPeer(ctx context.Context, id string, force bool) (interface{}, error) {
+	if id == "" {
+		if voyager.MyPeerID == "" {
+			id = voyager.GetSelfPeerID()
+		} else {
+			id = voyager.MyPeerID
+		}
+	}
+
+	store.PMapLock.RLock()
+	docID, exists := store.PMap[id]
+	store.PMapLock.RUnlock()
+
+	if exists && docID != "" && !force {
+		doc, err := store.PeerData.Get(docID)
+		if err != nil {
+			return nil, rest.Errorf(http.StatusInternalServerError, rest.CodeInternal, "failed to retrieve the peer: %v", err)
+		}
+		return json.RawMessage(doc.Content), nil
+	}
+
+	return crawlPeer(ctx, id)
+}
+
+// crawlPeer digests and indexes the peer id, giving up after TIMEOUT.
+func crawlPeer(ctx context.Context, id string) (*models.Peer, error) {
+	ctx, cancel := context.WithTimeout(ctx, TIMEOUT)
+	defer cancel()
+
+	type crawled struct {
+		peer *models.Peer
+		err  error
+	}
+	done := make(chan crawled, 1)
+
+	go func() {
+		peer, err := voyager.DigestPeer(id, store)
+		if err != nil {
+			store.PMapSet(id, "")
+			done <- crawled{nil, rest.Errorf(http.StatusNotFound, rest.CodeNotFound, "failed to retrieve peer %v: %v", id, err)}
+			return
+		}
+
+		docID, err := store.PeerData.Insert(peer.ID, peer)
+		if err != nil {
+			done <- crawled{nil, rest.Errorf(http.StatusInternalServerError, rest.CodeInternal, "failed to index peer %v: %v", id, err)}
+			return
+		}
+
+		store.PMapSet(id, docID)
+		go store.Listings.FlushSE()
+		store.Listings.Commit()
+		store.PeerData.Commit()
+		store.MarkChanged()
+		done <- crawled{peer, nil}
+	}()
+
+	select {
+	case result := <-done:
+		return result.peer, result.err
+	case <-ctx.Done():
+		return nil, rest.Errorf(http.StatusGatewayTimeout, rest.CodeTimeout, "timed out retrieving peer %v", id)
+	}
+}
+
+// browseTaxonomy returns the whole taxonomy, or the node picked by code or a classification.
+func browseTaxonomy(code, classification string) (*TaxonomyResult, error) {
+	t := taxonomy.Current()
+	counts, unclassified := store.CategoryCounts()
+
+	var convert func(nodes []*taxonomy.Node, depth int) []*TaxonomyNode
+	convert = func(nodes []*taxonomy.Node, depth int) []*TaxonomyNode {
+		result := []*TaxonomyNode{}
+		for _, node := range nodes {
+			n := &TaxonomyNode{Code: node.Code, Name: node.Name, Count: counts[node.Code]}
+			if depth != 0 {
+				n.Children = convert(node.Children, depth-1)
+			}
+			result = append(result, n)
+		}
+		return result
+	}
+
+	result := &TaxonomyResult{
+		Version:      t.Version,
+		Source:       t.Source,
+		Unclassified: unclassified,
+		Path:         []*TaxonomyNode{},
+	}
+
+	if classification != "" {
+		code, _ = t.Resolve(classification)
+		if code == "" {
+			return nil, rest.Errorf(http.StatusNotFound, rest.CodeNotFound, "no category %v", classification)
+		}
+	}
+
+	if code == "" {
+		result.Nodes = convert(t.Nodes, -1)
+		return result, nil
+	}
+
+	node, exists := t.Get(code)
+	if !exists {
+		return nil, rest.Errorf(http.StatusNotFound, rest.CodeNotFound, "no category %v", code)
+	}
+	result.Path = convert(t.Path(code), 0)
+	result.Nodes = convert(node.Children, -1)
+	return result, nil
+}
+
+// presence returns the cached online status of the comma separated ids.
+func presence(ids string) (map[string]voyager.PresenceStatus, error) {
+	peers := []string{}
+	for _, id := range strings.Split(ids, ",") {
+		if id = strings.TrimSpace(id); id != "" {
+			peers = append(peers, id)
+		}
+	}
+	if len(peers) == 0 {
+		return nil, rest.Errorf(http.StatusBadRequest, rest.CodeBadRequest, "ids is required")
+	}
+	if len(peers) > maxPresenceIDs {
+		return nil, rest.Errorf(http.StatusBadRequest, rest.CodeBadRequest, "at most %v ids can be looked up at once", maxPresenceIDs)
+	}
+
+	result := make(map[string]voyager.PresenceStatus)
+	for _, id := range peers {
+		result[id] = voyager.Presence.Status(id)
+	}
+	return result, nil
+}
+
+func versionInfo() VersionInfo {
+	info, _ := GetInfo()
+	return VersionInfo{OBVersion: info.OBVersion, KimitzuServiceVersion: info.KimitzuServiceVersion}
+}
+
+func flush() {
+	store.Listings.FlushSE()
+	store.PeerData.FlushSE()
+}
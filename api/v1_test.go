@@ -0,0 +1,76 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/kimitzu/kimitzu-services/models"
+	"github.com/kimitzu/kimitzu-services/servicestore"
+)
+
+// attachTestStore attaches an empty store in a temporary folder, the returned
+// function detaches and removes it.
+func attachTestStore(t *testing.T) (*servicestore.MainManagedStorage, func()) {
+	dir, err := ioutil.TempDir("", "api")
+	if err != nil {
+		t.Fatal(err)
+	}
+	previous := store
+	store_ := servicestore.InitializeManagedStorage(dir)
+	AttachStore(store_)
+	return store_, func() {
+		AttachStore(previous)
+		store_.Close()
+		os.RemoveAll(dir)
+	}
+}
+
+func insertListing(t *testing.T, store_ *servicestore.MainManagedStorage, hash, vendor string) {
+	listing := map[string]interface{}{
+		"hash":     hash,
+		"item":     map[string]interface{}{"title": "Listing " + hash},
+		"vendorID": map[string]interface{}{"peerID": vendor},
+	}
+	if _, err := store_.Listings.Insert(hash, listing); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSearchCursor(t *testing.T) {
+	store_, detach := attachTestStore(t)
+	defer detach()
+	for i := 0; i < 5; i++ {
+		insertListing(t, store_, fmt.Sprintf("Qm%v", i), "QmVendor")
+	}
+
+	page, err := searchListings(context.Background(), &models.AdvancedSearchQuery{Limit: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	seen := len(page.Data)
+	for pages := 1; page.NextCursor != ""; pages++ {
+		if pages > 5 {
+			t.Fatal("the cursors don't end")
+		}
+		page, err = searchListings(context.Background(), &models.AdvancedSearchQuery{Cursor: page.NextCursor})
+		if err != nil {
+			t.Fatal(err)
+		}
+		seen += len(page.Data)
+	}
+	if seen != 5 {
+		t.Errorf("paged through %v listings, want 5", seen)
+	}
+}
+
+func TestInvalidQuery(t *testing.T) {
+	if err := invalidQuery(&servicestore.QueryError{Reason: "invalidFilter"}); err.Status != 400 {
+		t.Errorf("invalid query: got %v, want 400", err.Status)
+	}
+	if err := invalidQuery(&servicestore.QueryError{Reason: "filters took too long", TimedOut: true}); err.Status != 504 {
+		t.Errorf("timed out query: got %v, want 504", err.Status)
+	}
+}
@@ -14,4 +14,20 @@ type Daemon struct {
 	DatabasePath          string
 	BootstrapNodeIdentity string
 	Testnet				  bool
+
+	ImportLocations string
+	ImportCountry   string
+	RatesFile       string
+
+	PrivateAPI bool
+
+	ApiSocket     string
+	TLSCert       string
+	TLSKey        string
+	TLSSelfSigned bool
+
+	CORSProfile string
+	CORSOrigins string
+
+	GRPCListen string
 }
@@ -0,0 +1,114 @@
+package cors
+
+import (
+	"net/http"
+	"strings"
+)
+
+const (
+	allowedMethods = "POST, GET, PATCH, PUT, DELETE, OPTIONS"
+	allowedHeaders = "Accept, Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization, Origin, X-Requested-With, X-Request-ID"
+	exposedHeaders = "X-Request-ID"
+)
+
+// Policy decides which web origins can call the API. An origin of "*" allows every
+// origin, but credentials are only allowed for the origins listed explicitly.
+type Policy struct {
+	AllowedOrigins []string
+}
+
+// ElectronOrigins are the origins the Electron client calls the API from,
+// its pages are loaded from disk and the development server.
+var ElectronOrigins = []string{"file://", "http://localhost:3000"}
+
+// BrowserOrigins are the origins the browser build of the client is served from by default.
+var BrowserOrigins = []string{"http://localhost:3000", "http://127.0.0.1:3000"}
+
+// Profiles are the named default origin lists.
+var Profiles = map[string][]string{
+	"electron": ElectronOrigins,
+	"browser":  BrowserOrigins,
+}
+
+// DefaultPolicy allows the Electron client.
+var DefaultPolicy = &Policy{AllowedOrigins: ElectronOrigins}
+
+// listed returns whether origin is explicitly allowed.
+func (p *Policy) listed(origin string) bool {
+	origin = strings.TrimSuffix(origin, "/")
+	for _, allowed := range p.AllowedOrigins {
+		if strings.EqualFold(strings.TrimSuffix(allowed, "/"), origin) {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *Policy) wildcard() bool {
+	for _, allowed := range p.AllowedOrigins {
+		if allowed == "*" {
+			return true
+		}
+	}
+	return false
+}
+
+// AllowsOrigin returns whether a request from origin is allowed. Requests without
+// an origin don't come from a web page and are always allowed.
+func (p *Policy) AllowsOrigin(origin string) bool {
+	return origin == "" || p.listed(origin) || p.wildcard()
+}
+
+// CheckOrigin is AllowsOrigin for websocket upgrades.
+func (p *Policy) CheckOrigin(r *http.Request) bool {
+	return p.AllowsOrigin(r.Header.Get("Origin"))
+}
+
+// Handler answers the preflight requests and sets the CORS headers of every response
+// of next, requests from origins that aren't allowed are rejected.
+func (p *Policy) Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		origin := r.Header.Get("Origin")
+		w.Header().Add("Vary", "Origin")
+
+		if origin != "" {
+			if !p.AllowsOrigin(origin) {
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(http.StatusForbidden)
+				_, _ = w.Write([]byte(`{"error": "originNotAllowed"}`))
+				return
+			}
+
+			if p.listed(origin) {
+				w.Header().Set("Access-Control-Allow-Origin", origin)
+				w.Header().Set("Access-Control-Allow-Credentials", "true")
+			} else {
+				w.Header().Set("Access-Control-Allow-Origin", "*")
+			}
+			w.Header().Set("Access-Control-Allow-Methods", allowedMethods)
+			w.Header().Set("Access-Control-Allow-Headers", allowedHeaders)
+			w.Header().Set("Access-Control-Expose-Headers", exposedHeaders)
+		}
+
+		if r.Method == "OPTIONS" && r.Header.Get("Access-Control-Request-Method") != "" {
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Origins returns the origins of profile followed by extra, a comma separated list.
+func Origins(profile string, extra string) ([]string, bool) {
+	origins, exists := Profiles[profile]
+	if !exists {
+		return nil, false
+	}
+	origins = append([]string{}, origins...)
+	for _, origin := range strings.Split(extra, ",") {
+		if origin = strings.TrimSpace(origin); origin != "" {
+			origins = append(origins, origin)
+		}
+	}
+	return origins, true
+}
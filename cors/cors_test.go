@@ -0,0 +1,76 @@
+package cors
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestHandler(t *testing.T) {
+	policy := &Policy{AllowedOrigins: []string{"file://", "https://app.example"}}
+	reached := false
+	handler := policy.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		reached = true
+	}))
+
+	cases := []struct {
+		method, origin string
+		preflight      bool
+		code           int
+		allowOrigin    string
+		reached        bool
+	}{
+		{"GET", "", false, 200, "", true},
+		{"POST", "file://", false, 200, "file://", true},
+		{"OPTIONS", "https://app.example/", true, 200, "https://app.example/", false},
+		{"POST", "https://evil.example", false, 403, "", false},
+		{"OPTIONS", "https://evil.example", true, 403, "", false},
+	}
+
+	for _, c := range cases {
+		reached = false
+		r := httptest.NewRequest(c.method, "/kimitzu/search", nil)
+		if c.origin != "" {
+			r.Header.Set("Origin", c.origin)
+		}
+		if c.preflight {
+			r.Header.Set("Access-Control-Request-Method", "POST")
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+
+		if w.Code != c.code {
+			t.Errorf("%v from %q: got %v, want %v", c.method, c.origin, w.Code, c.code)
+		}
+		if got := w.Header().Get("Access-Control-Allow-Origin"); got != c.allowOrigin {
+			t.Errorf("%v from %q: allowed origin %q, want %q", c.method, c.origin, got, c.allowOrigin)
+		}
+		if reached != c.reached {
+			t.Errorf("%v from %q: reached handler = %v", c.method, c.origin, reached)
+		}
+	}
+}
+
+func TestWildcard(t *testing.T) {
+	policy := &Policy{AllowedOrigins: []string{"*"}}
+	handler := policy.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	r := httptest.NewRequest("GET", "/kimitzu/search", nil)
+	r.Header.Set("Origin", "https://any.example")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+
+	if w.Header().Get("Access-Control-Allow-Origin") != "*" || w.Header().Get("Access-Control-Allow-Credentials") != "" {
+		t.Errorf("wildcard origins must not get credentials: %v", w.Header())
+	}
+}
+
+func TestOrigins(t *testing.T) {
+	origins, exists := Origins("browser", " https://a.example, ,https://b.example")
+	if !exists || len(origins) != len(BrowserOrigins)+2 {
+		t.Errorf("unexpected origins %v", origins)
+	}
+	if _, exists := Origins("mobile", ""); exists {
+		t.Error("unknown profile was accepted")
+	}
+}
@@ -0,0 +1,184 @@
+// Package health reports whether the daemon and the components it depends on are usable.
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Statuses of a component and of a report. A report is degraded when only
+// components that aren't required are down.
+const (
+	StatusUp       = "up"
+	StatusDown     = "down"
+	StatusDegraded = "degraded"
+)
+
+// DefaultTimeout is how long a check gets before its component is reported down.
+const DefaultTimeout = time.Second * 5
+
+// Details describe the state of a component in a report.
+type Details map[string]interface{}
+
+// Check probes a component. Probe returns an error when the component is down,
+// the details are reported either way.
+type Check struct {
+	Name     string
+	Required bool
+	Probe    func(ctx context.Context) (Details, error)
+}
+
+// Component is the result of a check.
+type Component struct {
+	Name     string  `json:"name"`
+	Status   string  `json:"status"`
+	Required bool    `json:"required"`
+	Error    string  `json:"error,omitempty"`
+	Details  Details `json:"details,omitempty"`
+}
+
+// Report is the result of every check.
+type Report struct {
+	Status     string      `json:"status"`
+	Components []Component `json:"components,omitempty"`
+}
+
+// Checks are the checks run to tell whether the daemon is ready.
+type Checks struct {
+	Timeout time.Duration
+
+	lock   *sync.Mutex
+	checks []Check
+}
+
+// NewChecks returns an empty set of checks.
+func NewChecks() *Checks {
+	return &Checks{Timeout: DefaultTimeout, lock: &sync.Mutex{}}
+}
+
+// Register adds checks, a check named like one already registered replaces it.
+func (c *Checks) Register(checks ...Check) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+outer:
+	for _, check := range checks {
+		for i := range c.checks {
+			if c.checks[i].Name == check.Name {
+				c.checks[i] = check
+				continue outer
+			}
+		}
+		c.checks = append(c.checks, check)
+	}
+}
+
+// Run runs the checks at the same time, in the order they were registered.
+// A check still running after Timeout reports its component down.
+func (c *Checks) Run(ctx context.Context) Report {
+	c.lock.Lock()
+	checks := append([]Check{}, c.checks...)
+	c.lock.Unlock()
+
+	ctx, cancel := context.WithTimeout(ctx, c.Timeout)
+	defer cancel()
+
+	components := make([]Component, len(checks))
+	wg := &sync.WaitGroup{}
+	for i, check := range checks {
+		wg.Add(1)
+		go func(i int, check Check) {
+			defer wg.Done()
+			components[i] = probe(ctx, check)
+		}(i, check)
+	}
+	wg.Wait()
+
+	report := Report{Status: StatusUp, Components: components}
+	for _, component := range components {
+		if component.Status == StatusUp {
+			continue
+		}
+		if component.Required {
+			report.Status = StatusDown
+			break
+		}
+		report.Status = StatusDegraded
+	}
+	return report
+}
+
+// probe runs check, giving up when ctx is done. Probes that don't watch ctx are left
+// running in the background.
+func probe(ctx context.Context, check Check) Component {
+	type result struct {
+		details Details
+		err     error
+	}
+	done := make(chan result, 1)
+	go func() {
+		details, err := check.Probe(ctx)
+		done <- result{details, err}
+	}()
+
+	component := Component{Name: check.Name, Status: StatusUp, Required: check.Required}
+	select {
+	case r := <-done:
+		component.Details = r.details
+		if r.err != nil {
+			component.Status, component.Error = StatusDown, r.err.Error()
+		}
+	case <-ctx.Done():
+		component.Status, component.Error = StatusDown, fmt.Sprintf("check timed out: %v", ctx.Err())
+	}
+	return component
+}
+
+// Summary returns the report with only the status of each component, without
+// their details and errors.
+func (r Report) Summary() Report {
+	components := make([]Component, len(r.Components))
+	for i, component := range r.Components {
+		components[i] = Component{Name: component.Name, Status: component.Status, Required: component.Required}
+	}
+	return Report{Status: r.Status, Components: components}
+}
+
+// HTTPReadyz responds with the report of the checks, with 503 Service Unavailable
+// when a required component is down.
+func (c *Checks) HTTPReadyz(w http.ResponseWriter, r *http.Request) {
+	c.readyz(w, r, true)
+}
+
+// HTTPReadyzSummary responds like HTTPReadyz with the summary of the report, for
+// callers that may not see the details of the components.
+func (c *Checks) HTTPReadyzSummary(w http.ResponseWriter, r *http.Request) {
+	c.readyz(w, r, false)
+}
+
+func (c *Checks) readyz(w http.ResponseWriter, r *http.Request, detailed bool) {
+	report := c.Run(r.Context())
+	if !detailed {
+		report = report.Summary()
+	}
+	code := http.StatusOK
+	if report.Status == StatusDown {
+		code = http.StatusServiceUnavailable
+	}
+	writeReport(w, code, report)
+}
+
+// HTTPHealthz responds as long as the process serves requests.
+func HTTPHealthz(w http.ResponseWriter, r *http.Request) {
+	writeReport(w, http.StatusOK, Report{Status: StatusUp})
+}
+
+func writeReport(w http.ResponseWriter, code int, report Report) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(report)
+}
@@ -0,0 +1,103 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func up(ctx context.Context) (Details, error) {
+	return Details{"entries": 1}, nil
+}
+
+func down(ctx context.Context) (Details, error) {
+	return nil, fmt.Errorf("not loaded")
+}
+
+func hang(ctx context.Context) (Details, error) {
+	<-ctx.Done()
+	time.Sleep(time.Millisecond * 50)
+	return nil, nil
+}
+
+func TestChecks(t *testing.T) {
+	cases := []struct {
+		name   string
+		checks []Check
+		status string
+		code   int
+	}{
+		{"none", nil, StatusUp, 200},
+		{"up", []Check{{Name: "a", Required: true, Probe: up}}, StatusUp, 200},
+		{"optional down", []Check{{Name: "a", Required: true, Probe: up}, {Name: "b", Probe: down}}, StatusDegraded, 200},
+		{"required down", []Check{{Name: "a", Required: true, Probe: down}, {Name: "b", Probe: down}}, StatusDown, 503},
+		{"timed out", []Check{{Name: "a", Required: true, Probe: hang}}, StatusDown, 503},
+	}
+
+	for _, c := range cases {
+		checks := NewChecks()
+		checks.Timeout = time.Millisecond * 20
+		checks.Register(c.checks...)
+
+		w := httptest.NewRecorder()
+		checks.HTTPReadyz(w, httptest.NewRequest("GET", "/readyz", nil))
+		if w.Code != c.code {
+			t.Errorf("%v: got %v, want %v", c.name, w.Code, c.code)
+		}
+
+		report := Report{}
+		if err := json.Unmarshal(w.Body.Bytes(), &report); err != nil {
+			t.Fatal(err)
+		}
+		if report.Status != c.status {
+			t.Errorf("%v: status %v, want %v", c.name, report.Status, c.status)
+		}
+		if len(report.Components) != len(c.checks) {
+			t.Errorf("%v: %v components, want %v", c.name, len(report.Components), len(c.checks))
+		}
+	}
+}
+
+func TestReadyzSummary(t *testing.T) {
+	checks := NewChecks()
+	checks.Register(Check{Name: "a", Required: true, Probe: up}, Check{Name: "b", Probe: down})
+
+	w := httptest.NewRecorder()
+	checks.HTTPReadyzSummary(w, httptest.NewRequest("GET", "/readyz", nil))
+
+	report := Report{}
+	if err := json.Unmarshal(w.Body.Bytes(), &report); err != nil {
+		t.Fatal(err)
+	}
+	if report.Status != StatusDegraded || len(report.Components) != 2 || report.Components[1].Status != StatusDown {
+		t.Errorf("unexpected report %+v", report)
+	}
+	for _, component := range report.Components {
+		if component.Details != nil || component.Error != "" {
+			t.Errorf("%v: the summary has details %v and error %q", component.Name, component.Details, component.Error)
+		}
+	}
+}
+
+func TestRegisterReplaces(t *testing.T) {
+	checks := NewChecks()
+	checks.Register(Check{Name: "a", Required: true, Probe: down}, Check{Name: "b", Probe: up})
+	checks.Register(Check{Name: "a", Required: true, Probe: up})
+
+	report := checks.Run(context.Background())
+	if report.Status != StatusUp || len(report.Components) != 2 || report.Components[0].Name != "a" {
+		t.Errorf("unexpected report %+v", report)
+	}
+}
+
+func TestHealthz(t *testing.T) {
+	w := httptest.NewRecorder()
+	HTTPHealthz(w, httptest.NewRequest("GET", "/healthz", nil))
+	if w.Code != http.StatusOK {
+		t.Errorf("got %v, want 200", w.Code)
+	}
+}
@@ -0,0 +1,128 @@
+// Package lifecycle starts the services of the daemon in order and stops them in reverse.
+package lifecycle
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/nokusukun/particles/roggy"
+)
+
+// Service is a part of the daemon started and stopped along with it. Start returns once the
+// service is usable, the context given to Start is cancelled when the daemon stops.
+// Stop returns once the service released what it holds, or when ctx is done.
+type Service interface {
+	Name() string
+	Start(ctx context.Context) error
+	Stop(ctx context.Context) error
+}
+
+// Func is a Service made of functions, either of them can be nil.
+type Func struct {
+	ServiceName string
+	OnStart     func(ctx context.Context) error
+	OnStop      func(ctx context.Context) error
+}
+
+func (f *Func) Name() string {
+	return f.ServiceName
+}
+
+func (f *Func) Start(ctx context.Context) error {
+	if f.OnStart == nil {
+		return nil
+	}
+	return f.OnStart(ctx)
+}
+
+func (f *Func) Stop(ctx context.Context) error {
+	if f.OnStop == nil {
+		return nil
+	}
+	return f.OnStop(ctx)
+}
+
+// Group starts services in the order they were added and stops them in reverse.
+type Group struct {
+	log      *roggy.LogPrinter
+	lock     *sync.Mutex
+	services []Service
+	started  []Service
+	cancel   context.CancelFunc
+}
+
+// NewGroup returns an empty group.
+func NewGroup(log *roggy.LogPrinter) *Group {
+	return &Group{log: log, lock: &sync.Mutex{}}
+}
+
+// Add adds services to be started after the ones already added.
+func (g *Group) Add(services ...Service) {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	g.services = append(g.services, services...)
+}
+
+// Start starts the services one after the other, they run until ctx is cancelled or
+// Stop is called. If one of them fails the ones already started are stopped and
+// its error returned.
+func (g *Group) Start(ctx context.Context) error {
+	g.lock.Lock()
+	runCtx, cancel := context.WithCancel(ctx)
+	g.cancel = cancel
+	services := g.services
+	g.lock.Unlock()
+
+	for _, service := range services {
+		g.log.Debugf("Starting %v", service.Name())
+		if err := service.Start(runCtx); err != nil {
+			err = fmt.Errorf("failed to start %v: %v", service.Name(), err)
+			g.Stop(ctx)
+			return err
+		}
+
+		g.lock.Lock()
+		g.started = append(g.started, service)
+		g.lock.Unlock()
+	}
+	return nil
+}
+
+// Stop cancels the context the services were started with and stops them
+// in reverse order, returning the first error. Services that fail to stop
+// don't keep the others from stopping.
+func (g *Group) Stop(ctx context.Context) error {
+	g.lock.Lock()
+	if g.cancel != nil {
+		g.cancel()
+	}
+	started := g.started
+	g.started = nil
+	g.lock.Unlock()
+
+	var first error
+	for i := len(started) - 1; i >= 0; i-- {
+		service := started[i]
+		g.log.Debugf("Stopping %v", service.Name())
+		if err := service.Stop(ctx); err != nil {
+			g.log.Errorf("Failed to stop %v: %v", service.Name(), err)
+			if first == nil {
+				first = fmt.Errorf("failed to stop %v: %v", service.Name(), err)
+			}
+		}
+	}
+	return first
+}
+
+// Running returns whether the service called name was started and isn't stopped.
+func (g *Group) Running(name string) bool {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	for _, service := range g.started {
+		if service.Name() == name {
+			return true
+		}
+	}
+	return false
+}
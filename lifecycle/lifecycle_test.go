@@ -0,0 +1,64 @@
+package lifecycle
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/nokusukun/particles/roggy"
+)
+
+func recorder(name string, events *[]string, startErr error) *Func {
+	return &Func{
+		ServiceName: name,
+		OnStart: func(ctx context.Context) error {
+			*events = append(*events, "start "+name)
+			return startErr
+		},
+		OnStop: func(ctx context.Context) error {
+			*events = append(*events, "stop "+name)
+			return nil
+		},
+	}
+}
+
+func TestGroup(t *testing.T) {
+	events := []string{}
+	group := NewGroup(roggy.Printer("test"))
+	group.Add(recorder("store", &events, nil), recorder("api", &events, nil))
+
+	if err := group.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if !group.Running("api") {
+		t.Error("api isn't running")
+	}
+	if err := group.Stop(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if group.Running("api") {
+		t.Error("api is still running")
+	}
+
+	want := []string{"start store", "start api", "stop api", "stop store"}
+	if !reflect.DeepEqual(events, want) {
+		t.Errorf("got %v, want %v", events, want)
+	}
+}
+
+func TestGroupStartFailure(t *testing.T) {
+	events := []string{}
+	group := NewGroup(roggy.Printer("test"))
+	group.Add(recorder("store", &events, nil), recorder("p2p", &events, fmt.Errorf("no keys")), recorder("api", &events, nil))
+
+	if err := group.Start(context.Background()); err == nil {
+		t.Fatal("the group started")
+	}
+
+	// The services started before the failure are stopped, the ones after it never start
+	want := []string{"start store", "start p2p", "stop store"}
+	if !reflect.DeepEqual(events, want) {
+		t.Errorf("got %v, want %v", events, want)
+	}
+}
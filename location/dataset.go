@@ -0,0 +1,417 @@
+package location
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gobuffalo/packr/v2"
+
+	"github.com/kimitzu/kimitzu-services/health"
+)
+
+const (
+	// BundledDatasetVersion is the version of the location data packed into the binary,
+	// datasets in the data directory are only used if they are newer than this.
+	BundledDatasetVersion int64 = 20190901000000
+
+	datasetVersionLayout = "20060102150405"
+	datasetFolder        = "location"
+	datasetFile          = "dataset.json"
+)
+
+// DatasetInfo describes the location dataset currently in use.
+type DatasetInfo struct {
+	Version   int64          `json:"version"`
+	Source    string         `json:"source"`
+	Entries   int            `json:"entries"`
+	Countries map[string]int `json:"countries"`
+}
+
+type storedDataset struct {
+	Version int64      `json:"version"`
+	Entries []Location `json:"entries"`
+}
+
+// dataset is an immutable snapshot of the location data along with its indexes,
+// imports build a new one and swap it in.
+type dataset struct {
+	info    DatasetInfo
+	entries []Location
+	index   *GeoIndex
+	byZip   map[string]int
+}
+
+var (
+	datasetLock = &sync.RWMutex{}
+	importLock  = &sync.Mutex{}
+	current     = newDataset(0, "none", []Location{})
+	dataPath    string
+	importHooks []func(DatasetInfo)
+)
+
+// MaxImportSize is the largest GeoNames dump HTTPLocationImportHandler accepts, the dump
+// of every country is about 140MB.
+var MaxImportSize int64 = 256 << 20
+
+// OnImport registers hook to be called with the new dataset after every import,
+// for the indexes resolving coordinates through the dataset.
+func OnImport(hook func(DatasetInfo)) {
+	importLock.Lock()
+	importHooks = append(importHooks, hook)
+	importLock.Unlock()
+}
+
+func newDataset(version int64, source string, entries []Location) *dataset {
+	d := &dataset{
+		info: DatasetInfo{
+			Version:   version,
+			Source:    source,
+			Entries:   len(entries),
+			Countries: make(map[string]int),
+		},
+		entries: entries,
+		index:   NewGeoIndex(locationGeoPrecision),
+		byZip:   make(map[string]int),
+	}
+
+	for i, loc := range entries {
+		d.info.Countries[loc.Country]++
+		d.byZip[zipKey(loc.Country, loc.ZipCode)] = i
+
+		x, errX := strconv.ParseFloat(loc.X, 64)
+		y, errY := strconv.ParseFloat(loc.Y, 64)
+		if errX != nil || errY != nil {
+			continue
+		}
+		d.index.Insert(strconv.Itoa(i), x, y)
+	}
+	return d
+}
+
+func (d *dataset) at(p GeoPoint) Location {
+	i, _ := strconv.Atoi(p.ID)
+	return d.entries[i]
+}
+
+func zipKey(country, zip string) string {
+	return strings.ToUpper(country) + "|" + strings.ToUpper(zip)
+}
+
+func getDataset() *dataset {
+	datasetLock.RLock()
+	defer datasetLock.RUnlock()
+	return current
+}
+
+func setDataset(d *dataset) {
+	datasetLock.Lock()
+	current = d
+	datasetLock.Unlock()
+}
+
+// Info returns the version and coverage of the location dataset in use.
+func Info() DatasetInfo {
+	return getDataset().info
+}
+
+// HealthCheck reports the location dataset down until one with entries is loaded.
+func HealthCheck() health.Check {
+	return health.Check{Name: "location", Required: true, Probe: func(ctx context.Context) (health.Details, error) {
+		info := Info()
+		details := health.Details{"version": info.Version, "source": info.Source, "entries": info.Entries}
+		if info.Entries == 0 {
+			return details, fmt.Errorf("no location dataset is loaded")
+		}
+		return details, nil
+	}}
+}
+
+// Lookup returns the coordinates of a zip code.
+func Lookup(country, zip string) (lat, lng float64, ok bool) {
+	d := getDataset()
+	i, exists := d.byZip[zipKey(country, zip)]
+	if !exists {
+		return 0, 0, false
+	}
+
+	lat, errX := strconv.ParseFloat(d.entries[i].X, 64)
+	lng, errY := strconv.ParseFloat(d.entries[i].Y, 64)
+	return lat, lng, errX == nil && errY == nil
+}
+
+// LoadDataset loads the location data from the data directory if it holds a dataset
+// newer than the bundled one, otherwise the bundled data is used.
+func LoadDataset(root string) error {
+	dataPath = root
+
+	stored, err := readStoredDataset()
+	if err == nil && stored.Version > BundledDatasetVersion {
+		setDataset(newDataset(stored.Version, datasetPath(), stored.Entries))
+		return nil
+	}
+
+	entries, err := readBundledDataset()
+	if err != nil {
+		return err
+	}
+	setDataset(newDataset(BundledDatasetVersion, "bundled", entries))
+	return nil
+}
+
+func datasetPath() string {
+	return path.Join(dataPath, datasetFolder, datasetFile)
+}
+
+func readStoredDataset() (*storedDataset, error) {
+	b, err := ioutil.ReadFile(datasetPath())
+	if err != nil {
+		return nil, err
+	}
+
+	stored := &storedDataset{}
+	err = json.Unmarshal(b, stored)
+	return stored, err
+}
+
+// readBundledDataset reads the location data packed with packr. locdat.zip holds the
+// postal codes with their addresses, zip codes only found in locationmap.json are
+// added without one.
+func readBundledDataset() ([]Location, error) {
+	box := packr.New("external2", "../external")
+	entries := []Location{}
+
+	if fStream, err := box.Find("locdat.zip"); err == nil {
+		entries, err = readLocdat(fStream)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if fStream, err := box.Find("locationmap.json"); err == nil {
+		locMap := make(map[string]map[string][]float64)
+		if err := json.Unmarshal(fStream, &locMap); err != nil {
+			return nil, fmt.Errorf("Failed to parse location map: %v", err)
+		}
+
+		known := make(map[string]bool)
+		for _, loc := range entries {
+			known[zipKey(loc.Country, loc.ZipCode)] = true
+		}
+		for country, zips := range locMap {
+			for zip, coords := range zips {
+				if known[zipKey(country, zip)] || len(coords) < 2 {
+					continue
+				}
+				entries = append(entries, Location{
+					Country: country,
+					ZipCode: zip,
+					X:       strconv.FormatFloat(coords[0], 'f', -1, 64),
+					Y:       strconv.FormatFloat(coords[1], 'f', -1, 64),
+				})
+			}
+		}
+	}
+
+	if len(entries) == 0 {
+		return nil, fmt.Errorf("No bundled location data found")
+	}
+	return entries, nil
+}
+
+func readLocdat(fStream []byte) ([]Location, error) {
+	fzip, err := zip.NewReader(bytes.NewReader(fStream), int64(len(fStream)))
+	if err != nil || len(fzip.File) == 0 {
+		return nil, fmt.Errorf("Failed reading location data[1]: %v", err)
+	}
+
+	ffile, err := fzip.File[0].Open()
+	if err != nil {
+		return nil, fmt.Errorf("Failed reading location data[2]: %v", err)
+	}
+	defer ffile.Close()
+
+	fstream, err := ioutil.ReadAll(ffile)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to read location data[3]: %v", err)
+	}
+
+	entries := []Location{}
+	if err := json.Unmarshal(fstream, &entries); err != nil {
+		return nil, fmt.Errorf("Failed to parse location data: %v", err)
+	}
+	return entries, nil
+}
+
+// ParseGeoNames reads a GeoNames postal code dump (https://download.geonames.org/export/zip/),
+// tab separated with the country code, postal code, place name, admin names and codes,
+// latitude and longitude. If country is not empty, rows of other countries are skipped.
+func ParseGeoNames(r io.Reader, country string) ([]Location, error) {
+	reader := csv.NewReader(r)
+	reader.Comma = '\t'
+	reader.FieldsPerRecord = -1
+	reader.LazyQuotes = true
+
+	entries := []Location{}
+	for line := 1; ; line++ {
+		row, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("line %v: %v", line, err)
+		}
+		if len(row) < 11 {
+			return nil, fmt.Errorf("line %v: expected at least 11 columns, got %v", line, len(row))
+		}
+		if country != "" && !strings.EqualFold(row[0], country) {
+			continue
+		}
+		if _, err := strconv.ParseFloat(row[9], 64); err != nil {
+			return nil, fmt.Errorf("line %v: invalid latitude %q", line, row[9])
+		}
+		if _, err := strconv.ParseFloat(row[10], 64); err != nil {
+			return nil, fmt.Errorf("line %v: invalid longitude %q", line, row[10])
+		}
+
+		var address []string
+		for _, col := range []int{2, 3, 4, 5, 7} {
+			if v := strings.TrimSpace(row[col]); v != "" {
+				address = append(address, v)
+			}
+		}
+
+		entries = append(entries, Location{
+			Country: strings.ToUpper(row[0]),
+			ZipCode: row[1],
+			Address: strings.Join(address, " "),
+			X:       row[9],
+			Y:       row[10],
+		})
+	}
+	return entries, nil
+}
+
+// Import replaces the entries of every country found in imported with the imported
+// ones, saves the result in the data directory as a new dataset version and starts
+// using it right away.
+func Import(imported []Location) (DatasetInfo, error) {
+	if len(imported) == 0 {
+		return DatasetInfo{}, fmt.Errorf("nothing to import")
+	}
+
+	importLock.Lock()
+	defer importLock.Unlock()
+
+	replaced := make(map[string]bool)
+	for _, loc := range imported {
+		replaced[loc.Country] = true
+	}
+
+	d := getDataset()
+	entries := make([]Location, 0, len(d.entries)+len(imported))
+	for _, loc := range d.entries {
+		if !replaced[loc.Country] {
+			entries = append(entries, loc)
+		}
+	}
+	entries = append(entries, imported...)
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].Country < entries[j].Country
+	})
+
+	version, _ := strconv.ParseInt(time.Now().UTC().Format(datasetVersionLayout), 10, 64)
+	if version <= d.info.Version {
+		version = d.info.Version + 1
+	}
+
+	if err := os.MkdirAll(path.Join(dataPath, datasetFolder), os.ModePerm); err != nil {
+		return DatasetInfo{}, err
+	}
+	b, err := json.Marshal(storedDataset{Version: version, Entries: entries})
+	if err != nil {
+		return DatasetInfo{}, err
+	}
+	// Write to a temporary file first so a failed write doesn't leave a broken dataset behind
+	tmp := datasetPath() + ".tmp"
+	if err := ioutil.WriteFile(tmp, b, 0644); err != nil {
+		return DatasetInfo{}, err
+	}
+	if err := os.Rename(tmp, datasetPath()); err != nil {
+		return DatasetInfo{}, err
+	}
+
+	next := newDataset(version, datasetPath(), entries)
+	setDataset(next)
+	for _, hook := range importHooks {
+		hook(next.info)
+	}
+	return next.info, nil
+}
+
+// ImportGeoNamesFile imports a GeoNames postal code dump from disk, used by the -import-locations flag.
+func ImportGeoNamesFile(root, file, country string) (DatasetInfo, error) {
+	if err := LoadDataset(root); err != nil {
+		return DatasetInfo{}, err
+	}
+
+	f, err := os.Open(file)
+	if err != nil {
+		return DatasetInfo{}, err
+	}
+	defer f.Close()
+
+	entries, err := ParseGeoNames(f, country)
+	if err != nil {
+		return DatasetInfo{}, err
+	}
+	return Import(entries)
+}
+
+// HTTPLocationInfoHandler returns the version and per country coverage of the location dataset.
+func HTTPLocationInfoHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(Info())
+}
+
+// HTTPLocationImportHandler imports the GeoNames postal code dump in the request body,
+// restricted to `country` if given.
+func HTTPLocationImportHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if r.Method != "POST" {
+		http.Error(w, `{"error": "POST a GeoNames postal code dump"}`, 405)
+		return
+	}
+	defer r.Body.Close()
+
+	body := http.MaxBytesReader(w, r.Body, MaxImportSize)
+	entries, err := ParseGeoNames(body, r.URL.Query().Get("country"))
+	if err != nil {
+		code := 400
+		if strings.Contains(err.Error(), "request body too large") {
+			code = 413
+		}
+		http.Error(w, fmt.Sprintf(`{"error": "Failed to parse dump", "details": %q}`, err.Error()), code)
+		return
+	}
+
+	info, err := Import(entries)
+	if err != nil {
+		http.Error(w, fmt.Sprintf(`{"error": "Failed to import", "details": %q}`, err.Error()), 500)
+		return
+	}
+	_ = json.NewEncoder(w).Encode(info)
+}
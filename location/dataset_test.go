@@ -0,0 +1,87 @@
+package location
+
+import (
+	"io/ioutil"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+const geonamesSample = "PH\t5000\tIloilo City\tWestern Visayas\t06\tProvince of Iloilo\t30\t\t\t10.6969\t122.5644\t4\n" +
+	"PH\t5001\tPavia\tWestern Visayas\t06\tProvince of Iloilo\t30\t\t\t10.7761\t122.5456\t4\n" +
+	"AU\t0846\tAdelaide River\tNorthern Territory\tNT\tDARWIN\t71000\t\t\t-13.2379\t131.1056\t4\n"
+
+func TestDatasetImport(t *testing.T) {
+	dir, err := ioutil.TempDir("", "locations")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	dataPath = dir
+	setDataset(newDataset(BundledDatasetVersion, "bundled", []Location{
+		{Country: "PH", ZipCode: "9999", X: "1", Y: "1"},
+		{Country: "JP", ZipCode: "100-0001", X: "35.6812", Y: "139.7671"},
+	}))
+
+	entries, err := ParseGeoNames(strings.NewReader(geonamesSample), "PH")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 || entries[0].Address != "Iloilo City Western Visayas 06 Province of Iloilo" {
+		t.Errorf("Unexpected parsed entries: %v", entries)
+	}
+
+	info, err := Import(entries)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Version <= BundledDatasetVersion || info.Countries["PH"] != 2 || info.Countries["JP"] != 1 {
+		t.Errorf("Unexpected dataset info after import: %+v", info)
+	}
+
+	if _, _, ok := Lookup("PH", "9999"); ok {
+		t.Error("Expected the imported country to replace the old PH entries")
+	}
+
+	// A stored dataset newer than the bundled one is picked up on load
+	setDataset(newDataset(0, "none", []Location{}))
+	if err := LoadDataset(dir); err != nil {
+		t.Fatal(err)
+	}
+	if lat, lng, ok := Lookup("ph", "5001"); !ok || lat != 10.7761 || lng != 122.5456 {
+		t.Errorf("Lookup of PH 5001 returned (%v, %v, %v)", lat, lng, ok)
+	}
+	if Info().Version != info.Version {
+		t.Errorf("Loaded dataset version %v, expected %v", Info().Version, info.Version)
+	}
+}
+
+func TestImportHandler(t *testing.T) {
+	dir, err := ioutil.TempDir("", "locations")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	dataPath = dir
+	setDataset(newDataset(BundledDatasetVersion, "bundled", []Location{}))
+
+	imported := 0
+	OnImport(func(info DatasetInfo) { imported++ })
+	defer func() { importHooks = nil }()
+
+	w := httptest.NewRecorder()
+	HTTPLocationImportHandler(w, httptest.NewRequest("POST", "/kimitzu/location/import", strings.NewReader(geonamesSample)))
+	if w.Code != 200 || imported != 1 {
+		t.Errorf("import: got %v, %v hook calls", w.Code, imported)
+	}
+
+	defer func(size int64) { MaxImportSize = size }(MaxImportSize)
+	MaxImportSize = 64
+	w = httptest.NewRecorder()
+	HTTPLocationImportHandler(w, httptest.NewRequest("POST", "/kimitzu/location/import", strings.NewReader(geonamesSample)))
+	if w.Code != 413 || imported != 1 {
+		t.Errorf("oversized import: got %v, %v hook calls", w.Code, imported)
+	}
+}
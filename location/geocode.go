@@ -0,0 +1,95 @@
+package location
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+)
+
+// Reverse returns the postal code closest to (lat, lng) along with its distance in meters.
+func Reverse(lat, lng float64) (LocationDistance, bool) {
+	d := getDataset()
+	hits := d.index.Nearest(lat, lng, 1)
+	if len(hits) == 0 {
+		return LocationDistance{}, false
+	}
+	return LocationDistance{d.at(hits[0].GeoPoint), hits[0].Distance}, true
+}
+
+// HTTPLocationReverseHandler returns the postal code and address closest to (`x`, `y`).
+func HTTPLocationReverseHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	x, errX := strconv.ParseFloat(r.URL.Query().Get("x"), 64)
+	y, errY := strconv.ParseFloat(r.URL.Query().Get("y"), 64)
+	if errX != nil || errY != nil {
+		http.Error(w, `{"error": "x and y are required"}`, 400)
+		return
+	}
+
+	result, found := Reverse(x, y)
+	if !found {
+		fmt.Fprint(w, `{"error": "notFound"}`)
+		return
+	}
+
+	jsn, _ := json.Marshal(result)
+	fmt.Fprint(w, string(jsn))
+}
+
+// PlusCodeResult is a Plus Code along with the area it covers and its center.
+type PlusCodeResult struct {
+	Code      string   `json:"code"`
+	Area      CodeArea `json:"area"`
+	CenterLat float64  `json:"x"`
+	CenterLng float64  `json:"y"`
+}
+
+// HTTPLocationPlusCodeHandler decodes `code` into its area, short codes are recovered
+// against the (`x`, `y`) reference location. Without a code, (`x`, `y`) is encoded
+// into a Plus Code of `length` digits instead.
+func HTTPLocationPlusCodeHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	q := r.URL.Query()
+	code := q.Get("code")
+	x, errX := strconv.ParseFloat(q.Get("x"), 64)
+	y, errY := strconv.ParseFloat(q.Get("y"), 64)
+	hasRef := errX == nil && errY == nil
+
+	if code == "" {
+		if !hasRef {
+			http.Error(w, `{"error": "either code or x and y are required"}`, 400)
+			return
+		}
+		length, err := strconv.Atoi(q.Get("length"))
+		if err != nil {
+			length = olcPairCodeLen
+		}
+		code, err = EncodePlusCode(x, y, length)
+		if err != nil {
+			http.Error(w, fmt.Sprintf(`{"error": "%v"}`, err), 400)
+			return
+		}
+	} else if !IsFullPlusCode(code) {
+		if !hasRef {
+			http.Error(w, `{"error": "short plus codes need a reference x and y"}`, 400)
+			return
+		}
+		var err error
+		code, err = RecoverPlusCode(code, x, y)
+		if err != nil {
+			http.Error(w, fmt.Sprintf(`{"error": "%v"}`, err), 400)
+			return
+		}
+	}
+
+	area, err := DecodePlusCode(code)
+	if err != nil {
+		http.Error(w, fmt.Sprintf(`{"error": "%v"}`, err), 400)
+		return
+	}
+
+	lat, lng := area.Center()
+	jsn, _ := json.Marshal(PlusCodeResult{Code: code, Area: area, CenterLat: lat, CenterLng: lng})
+	fmt.Fprint(w, string(jsn))
+}
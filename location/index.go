@@ -0,0 +1,266 @@
+package location
+
+import (
+	"math"
+	"sort"
+	"sync"
+)
+
+const (
+	// maxScanCells is the amount of geohash cells a query is allowed to visit,
+	// queries spanning more than that just scan every point instead.
+	maxScanCells = 4096
+)
+
+// GeoPoint is a single entry in a GeoIndex.
+type GeoPoint struct {
+	ID  string  `json:"id"`
+	Lat float64 `json:"lat"`
+	Lng float64 `json:"lng"`
+}
+
+// GeoHit is a GeoPoint matched by a query along with its distance in meters from the query origin.
+type GeoHit struct {
+	GeoPoint
+	Distance float64 `json:"distance"`
+}
+
+type bbox struct {
+	minLat, minLng, maxLat, maxLng float64
+}
+
+func (b bbox) contains(p GeoPoint) bool {
+	return p.Lat >= b.minLat && p.Lat <= b.maxLat && p.Lng >= b.minLng && p.Lng <= b.maxLng
+}
+
+// GeoIndex buckets points by their geohash so radius queries only have to
+// look at the cells that intersect the search area instead of every point.
+type GeoIndex struct {
+	lock      *sync.RWMutex
+	precision int
+	cells     map[string][]GeoPoint
+	points    map[string]GeoPoint
+}
+
+// NewGeoIndex returns an empty GeoIndex bucketing points in geohash cells of the given precision.
+func NewGeoIndex(precision int) *GeoIndex {
+	return &GeoIndex{
+		lock:      &sync.RWMutex{},
+		precision: precision,
+		cells:     make(map[string][]GeoPoint),
+		points:    make(map[string]GeoPoint),
+	}
+}
+
+// Insert adds or moves the point with the given id.
+func (g *GeoIndex) Insert(id string, lat, lng float64) {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+
+	g.remove(id)
+	p := GeoPoint{ID: id, Lat: lat, Lng: lng}
+	hash := EncodeGeohash(lat, lng, g.precision)
+	g.cells[hash] = append(g.cells[hash], p)
+	g.points[id] = p
+}
+
+// Remove deletes the point with the given id, if it exists.
+func (g *GeoIndex) Remove(id string) {
+	g.lock.Lock()
+	g.remove(id)
+	g.lock.Unlock()
+}
+
+func (g *GeoIndex) remove(id string) {
+	p, exists := g.points[id]
+	if !exists {
+		return
+	}
+	delete(g.points, id)
+
+	hash := EncodeGeohash(p.Lat, p.Lng, g.precision)
+	cell := g.cells[hash]
+	for i, c := range cell {
+		if c.ID == id {
+			cell[i] = cell[len(cell)-1]
+			cell = cell[:len(cell)-1]
+			break
+		}
+	}
+	if len(cell) == 0 {
+		delete(g.cells, hash)
+	} else {
+		g.cells[hash] = cell
+	}
+}
+
+// Get returns the point with the given id.
+func (g *GeoIndex) Get(id string) (GeoPoint, bool) {
+	g.lock.RLock()
+	defer g.lock.RUnlock()
+	p, exists := g.points[id]
+	return p, exists
+}
+
+// Len returns the amount of points in the index.
+func (g *GeoIndex) Len() int {
+	g.lock.RLock()
+	defer g.lock.RUnlock()
+	return len(g.points)
+}
+
+// Within returns every point within radius meters of (lat, lng), closest first.
+func (g *GeoIndex) Within(lat, lng, radius float64) []GeoHit {
+	g.lock.RLock()
+	defer g.lock.RUnlock()
+
+	hits := []GeoHit{}
+	for _, box := range radiusBoxes(lat, lng, radius) {
+		g.scan(box, func(p GeoPoint) {
+			if d := Distance(lat, lng, p.Lat, p.Lng); d <= radius {
+				hits = append(hits, GeoHit{p, d})
+			}
+		})
+	}
+
+	sortHits(hits)
+	return hits
+}
+
+// Nearest returns the k points closest to (lat, lng), closest first. The search
+// area starts small and is widened until it holds k points, every point within
+// the area is found so the k closest ones inside it are the k closest overall.
+func (g *GeoIndex) Nearest(lat, lng float64, k int) []GeoHit {
+	if k <= 0 {
+		return []GeoHit{}
+	}
+
+	h, _ := geohashCellSize(g.precision)
+	radius := h * math.Pi / 180 * EarthRadius
+	for {
+		hits := g.Within(lat, lng, radius)
+		if len(hits) >= k || radius >= math.Pi*EarthRadius {
+			if len(hits) > k {
+				hits = hits[:k]
+			}
+			return hits
+		}
+		radius *= 4
+	}
+}
+
+// InBox returns every point inside the box, closest to its center first so truncating
+// the result keeps the middle of the box. A box with minLng > maxLng is taken as
+// crossing the antimeridian.
+func (g *GeoIndex) InBox(minLat, minLng, maxLat, maxLng float64) []GeoPoint {
+	g.lock.RLock()
+	defer g.lock.RUnlock()
+
+	if minLng > maxLng {
+		maxLng += 360
+	}
+	centerLat, centerLng := (minLat+maxLat)/2, (minLng+maxLng)/2
+	if centerLng > 180 {
+		centerLng -= 360
+	}
+
+	hits := []GeoHit{}
+	for _, box := range splitAntimeridian(minLat, minLng, maxLat, maxLng) {
+		g.scan(box, func(p GeoPoint) {
+			hits = append(hits, GeoHit{p, Distance(centerLat, centerLng, p.Lat, p.Lng)})
+		})
+	}
+	// Ties are broken by ID so the same box always returns the same points
+	sort.Slice(hits, func(i, j int) bool {
+		if hits[i].Distance != hits[j].Distance {
+			return hits[i].Distance < hits[j].Distance
+		}
+		return hits[i].ID < hits[j].ID
+	})
+
+	points := make([]GeoPoint, len(hits))
+	for i, hit := range hits {
+		points[i] = hit.GeoPoint
+	}
+	return points
+}
+
+// scan calls fn for every point inside box. Caller must hold the lock.
+func (g *GeoIndex) scan(box bbox, fn func(GeoPoint)) {
+	h, w := geohashCellSize(g.precision)
+	rows, cols := int(math.Round(180/h)), int(math.Round(360/w))
+
+	i0, i1 := clampCell(int(math.Floor((box.minLat+90)/h)), rows), clampCell(int(math.Floor((box.maxLat+90)/h)), rows)
+	j0, j1 := clampCell(int(math.Floor((box.minLng+180)/w)), cols), clampCell(int(math.Floor((box.maxLng+180)/w)), cols)
+
+	if (i1-i0+1)*(j1-j0+1) > maxScanCells || (i1-i0+1)*(j1-j0+1) > len(g.points) {
+		for _, p := range g.points {
+			if box.contains(p) {
+				fn(p)
+			}
+		}
+		return
+	}
+
+	for i := i0; i <= i1; i++ {
+		for j := j0; j <= j1; j++ {
+			hash := EncodeGeohash(-90+(float64(i)+0.5)*h, -180+(float64(j)+0.5)*w, g.precision)
+			for _, p := range g.cells[hash] {
+				if box.contains(p) {
+					fn(p)
+				}
+			}
+		}
+	}
+}
+
+func clampCell(i, n int) int {
+	if i < 0 {
+		return 0
+	}
+	if i >= n {
+		return n - 1
+	}
+	return i
+}
+
+// radiusBoxes returns the bounding boxes covering the circle of radius meters
+// around (lat, lng), split in two when it crosses the antimeridian.
+func radiusBoxes(lat, lng, radius float64) []bbox {
+	angular := radius / EarthRadius
+	dLat := angular * 180 / math.Pi
+
+	minLat, maxLat := lat-dLat, lat+dLat
+	if minLat <= -90 || maxLat >= 90 || angular >= math.Pi/2 {
+		return []bbox{{math.Max(minLat, -90), -180, math.Min(maxLat, 90), 180}}
+	}
+
+	s := math.Sin(angular) / math.Cos(lat*math.Pi/180)
+	if s >= 1 {
+		return []bbox{{minLat, -180, maxLat, 180}}
+	}
+	dLng := math.Asin(s) * 180 / math.Pi
+
+	return splitAntimeridian(minLat, lng-dLng, maxLat, lng+dLng)
+}
+
+// splitAntimeridian normalizes a box whose longitudes may fall outside of
+// [-180, 180] into one or two boxes that don't wrap.
+func splitAntimeridian(minLat, minLng, maxLat, maxLng float64) []bbox {
+	if maxLng-minLng >= 360 {
+		return []bbox{{minLat, -180, maxLat, 180}}
+	}
+	if minLng < -180 {
+		return []bbox{{minLat, minLng + 360, maxLat, 180}, {minLat, -180, maxLat, maxLng}}
+	}
+	if maxLng > 180 {
+		return []bbox{{minLat, minLng, maxLat, 180}, {minLat, -180, maxLat, maxLng - 360}}
+	}
+	return []bbox{{minLat, minLng, maxLat, maxLng}}
+}
+
+func sortHits(hits []GeoHit) {
+	sort.Slice(hits, func(i, j int) bool {
+		return hits[i].Distance < hits[j].Distance
+	})
+}
@@ -0,0 +1,104 @@
+package location
+
+import "testing"
+
+func TestGeohashEncoding(t *testing.T) {
+	hash := EncodeGeohash(57.64911, 10.40744, 11)
+	if hash != "u4pruydqqvj" {
+		t.Errorf("Geohash of (57.64911, 10.40744) is %v, expected u4pruydqqvj", hash)
+	}
+
+	minLat, minLng, maxLat, maxLng := DecodeGeohash(hash)
+	if 57.64911 < minLat || 57.64911 > maxLat || 10.40744 < minLng || 10.40744 > maxLng {
+		t.Errorf("Decoded cell (%v, %v, %v, %v) does not contain the encoded point", minLat, minLng, maxLat, maxLng)
+	}
+}
+
+func TestGeoIndexWithin(t *testing.T) {
+	index := NewGeoIndex(4)
+	// PH, Iloilo City
+	index.Insert("iloilo", 10.6969, 122.5644)
+	// PH, Pavia
+	index.Insert("pavia", 10.7761, 122.5456)
+	// AU, Adelaide River Northern Territory NT DARWIN
+	index.Insert("darwin", -13.2379, 131.1056)
+
+	hits := index.Within(10.6969, 122.5644, 10000)
+	if len(hits) != 2 || hits[0].ID != "iloilo" || hits[1].ID != "pavia" {
+		t.Errorf("Expected iloilo and pavia within 10km of Iloilo City, got %v", hits)
+	}
+
+	index.Insert("pavia", -13.2, 131.1)
+	if hits := index.Within(10.6969, 122.5644, 10000); len(hits) != 1 {
+		t.Errorf("Expected moved point to leave the search area, got %v", hits)
+	}
+
+	index.Remove("iloilo")
+	if index.Len() != 2 {
+		t.Errorf("Index has %v points, expected 2", index.Len())
+	}
+}
+
+func TestGeoIndexAntimeridian(t *testing.T) {
+	index := NewGeoIndex(4)
+	// FJ, Suva and Taveuni sit on opposite sides of the 180th meridian
+	index.Insert("suva", -18.1416, 178.4419)
+	index.Insert("taveuni", -16.85, -179.95)
+
+	hits := index.Within(-16.9, 179.9, 100000)
+	if len(hits) != 1 || hits[0].ID != "taveuni" {
+		t.Errorf("Expected taveuni across the antimeridian, got %v", hits)
+	}
+}
+
+func TestGeoIndexNearestAndBox(t *testing.T) {
+	index := NewGeoIndex(5)
+	index.Insert("iloilo", 10.6969, 122.5644)
+	index.Insert("pavia", 10.7761, 122.5456)
+	index.Insert("darwin", -13.2379, 131.1056)
+
+	hits := index.Nearest(10.70, 122.56, 2)
+	if len(hits) != 2 || hits[0].ID != "iloilo" || hits[1].ID != "pavia" {
+		t.Errorf("Expected iloilo then pavia as the 2 nearest, got %v", hits)
+	}
+
+	if hits := index.Nearest(10.70, 122.56, 5); len(hits) != 3 {
+		t.Errorf("Expected every point when k exceeds the index size, got %v", hits)
+	}
+
+	points := index.InBox(10.7, 122.5, 10.8, 122.6)
+	if len(points) != 1 || points[0].ID != "pavia" {
+		t.Errorf("Expected only pavia inside the box, got %v", points)
+	}
+}
+
+func TestGeoIndexBoxOrder(t *testing.T) {
+	index := NewGeoIndex(5)
+	index.Insert("corner", 10.79, 122.59)
+	index.Insert("center", 10.75, 122.55)
+	index.Insert("between", 10.77, 122.57)
+	index.Insert("twin-b", 10.72, 122.55)
+	index.Insert("twin-a", 10.72, 122.55)
+
+	expected := []string{"center", "between", "twin-a", "twin-b", "corner"}
+	for i := 0; i < 10; i++ {
+		points := index.InBox(10.7, 122.5, 10.8, 122.6)
+		if len(points) != len(expected) {
+			t.Fatalf("Expected %v points, got %v", len(expected), points)
+		}
+		for j, p := range points {
+			if p.ID != expected[j] {
+				t.Fatalf("Expected %v, got %v", expected, points)
+			}
+		}
+	}
+
+	// The center of a box crossing the antimeridian is on the antimeridian
+	index = NewGeoIndex(5)
+	index.Insert("east", -17.0, 179.9)
+	index.Insert("west", -17.0, -179.8)
+	points := index.InBox(-18, 179, -16, -179.5)
+	if len(points) != 2 || points[0].ID != "east" {
+		t.Errorf("Expected east then west, got %v", points)
+	}
+}
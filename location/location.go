@@ -1,22 +1,26 @@
 package location
 
 import (
-	"archive/zip"
-	"bytes"
 	"encoding/json"
 	"fmt"
-	"io/ioutil"
 	"math"
 	"net/http"
 	"strconv"
 	"strings"
 
-	"github.com/gobuffalo/packr/v2"
     "github.com/nokusukun/particles/roggy"
 )
 
-var (
-	obj []Location
+const (
+	// EarthRadius in meters, used for all of the distance computations
+	EarthRadius = 6378100
+
+	// locationGeoPrecision is the geohash precision of the location index, cells are about 5km x 5km.
+	locationGeoPrecision = 5
+
+	defaultNearestK = 10
+	maxNearestK     = 1000
+	defaultBoxLimit = 1000
 )
 
 type Location struct {
@@ -32,45 +36,13 @@ type LocationDistance struct {
 	Dist float64  `json:"distance"`
 }
 
-func InitializeLocationService(log *roggy.LogPrinter) []Location {
-	log.Info("Initializing")
-	box := packr.New("external2", "../external")
-	fStream, err := box.Find("locdat.zip")
-	fzip, err := zip.NewReader(bytes.NewReader(fStream), int64(len(fStream)))
-	if err != nil {
-		panic(fmt.Errorf("Failed reading location data[1]: %v", err))
-	}
-
-	locdat := fzip.File[0]
-	ffile, err := locdat.Open()
-
-	if err != nil {
-		panic(fmt.Errorf("Failed reading location data[2]: %v", err))
-	}
-	defer ffile.Close()
-
-	fstream, err := ioutil.ReadAll(ffile)
-
-	if err != nil {
-		panic(fmt.Errorf("Failed to read location data[3]: %v", err))
-	}
-
-	obj := []Location{}
-	err = json.Unmarshal(fstream, &obj)
-	if err != nil {
-		panic(fmt.Errorf("Failed to parse location data: %v", err))
-	}
-	return obj
-}
-
 func HTTPLocationCodesfromHandler(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
-	w.Header().Set("Access-Control-Allow-Origin", "*")
 	x, _ := strconv.ParseFloat(r.URL.Query().Get("x"), 64)
 	y, _ := strconv.ParseFloat(r.URL.Query().Get("y"), 64)
 	within, _ := strconv.ParseFloat(r.URL.Query().Get("within"), 64)
 
-	result := getNearbyLocations(x, y, within, obj)
+	result := getNearbyLocations(x, y, within)
 
 	if len(result) != 0 {
 		jsn, _ := json.Marshal(result)
@@ -83,7 +55,6 @@ func HTTPLocationCodesfromHandler(w http.ResponseWriter, r *http.Request) {
 
 func HTTPLocationQueryHandler(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
-	w.Header().Set("Access-Control-Allow-Origin", "*")
 	zipCode := r.URL.Query().Get("zip")
 	country := r.URL.Query().Get("country")
 	address := r.URL.Query().Get("address")
@@ -91,7 +62,7 @@ func HTTPLocationQueryHandler(w http.ResponseWriter, r *http.Request) {
 	y := r.URL.Query().Get("y")
 
 	var result []Location
-	for _, loc := range obj {
+	for _, loc := range getDataset().entries {
 		var matches []bool
 		matches = append(matches, loc.ZipCode == zipCode || zipCode == "")
 		matches = append(matches, loc.Country == country || country == "")
@@ -112,23 +83,96 @@ func HTTPLocationQueryHandler(w http.ResponseWriter, r *http.Request) {
 
 }
 
-func RunLocationService(log *roggy.LogPrinter) {
-	obj = InitializeLocationService(log)
+// HTTPLocationNearestHandler returns the `k` postal codes closest to (`x`, `y`), closest first.
+func HTTPLocationNearestHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	x, errX := strconv.ParseFloat(r.URL.Query().Get("x"), 64)
+	y, errY := strconv.ParseFloat(r.URL.Query().Get("y"), 64)
+	if errX != nil || errY != nil {
+		http.Error(w, `{"error": "x and y are required"}`, 400)
+		return
+	}
+
+	k, err := strconv.Atoi(r.URL.Query().Get("k"))
+	if err != nil || k <= 0 {
+		k = defaultNearestK
+	}
+	if k > maxNearestK {
+		k = maxNearestK
+	}
+
+	d := getDataset()
+	result := toLocationDistances(d, d.index.Nearest(x, y, k))
+
+	if len(result) != 0 {
+		jsn, _ := json.Marshal(result)
+		fmt.Fprint(w, string(jsn))
+	} else {
+		fmt.Fprint(w, `{"error": "notFound"}`)
+	}
 }
 
-func getNearbyLocations(x float64, y float64, radius float64, obj []Location) []LocationDistance {
-	var result []LocationDistance
-	for _, loc := range obj {
-		tarx, _ := strconv.ParseFloat(loc.X, 64)
-		tary, _ := strconv.ParseFloat(loc.Y, 64)
-		dist := Distance(x, y, tarx, tary)
-		if dist <= radius {
-			result = append(result, LocationDistance{loc, dist})
+// HTTPLocationBoxHandler returns the postal codes inside the (`minX`, `minY`), (`maxX`, `maxY`)
+// bounding box of a map viewport, capped to the `limit` entries closest to its center.
+func HTTPLocationBoxHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	q := r.URL.Query()
+	minX, errMinX := strconv.ParseFloat(q.Get("minX"), 64)
+	minY, errMinY := strconv.ParseFloat(q.Get("minY"), 64)
+	maxX, errMaxX := strconv.ParseFloat(q.Get("maxX"), 64)
+	maxY, errMaxY := strconv.ParseFloat(q.Get("maxY"), 64)
+	if errMinX != nil || errMinY != nil || errMaxX != nil || errMaxY != nil {
+		http.Error(w, `{"error": "minX, minY, maxX and maxY are required"}`, 400)
+		return
+	}
+
+	limit, err := strconv.Atoi(q.Get("limit"))
+	if err != nil || limit <= 0 {
+		limit = defaultBoxLimit
+	}
+
+	d := getDataset()
+	result := []Location{}
+	for _, p := range d.index.InBox(minX, minY, maxX, maxY) {
+		if len(result) >= limit {
+			break
 		}
+		result = append(result, d.at(p))
+	}
+
+	if len(result) != 0 {
+		jsn, _ := json.Marshal(result)
+		fmt.Fprint(w, string(jsn))
+	} else {
+		fmt.Fprint(w, `{"error": "notFound"}`)
+	}
+}
+
+// RunLocationService loads the location dataset, preferring the one in the
+// data directory under root if it is newer than the bundled one.
+func RunLocationService(log *roggy.LogPrinter, root string) error {
+	log.Info("Initializing")
+	if err := LoadDataset(root); err != nil {
+		return err
+	}
+	info := Info()
+	log.Infof("Loaded %v locations from %v dataset version %v", info.Entries, info.Source, info.Version)
+	return nil
+}
+
+func toLocationDistances(d *dataset, hits []GeoHit) []LocationDistance {
+	result := []LocationDistance{}
+	for _, hit := range hits {
+		result = append(result, LocationDistance{d.at(hit.GeoPoint), hit.Distance})
 	}
 	return result
 }
 
+func getNearbyLocations(x float64, y float64, radius float64) []LocationDistance {
+	d := getDataset()
+	return toLocationDistances(d, d.index.Within(x, y, radius))
+}
+
 func stringInSlice(a bool, list []bool) bool {
 	for _, b := range list {
 		if b == a {
@@ -149,7 +193,7 @@ func Distance(lat1, lon1, lat2, lon2 float64) float64 {
 	la2 = lat2 * math.Pi / 180
 	lo2 = lon2 * math.Pi / 180
 
-	r = 6378100 // Earth radius in METERS
+	r = EarthRadius // Earth radius in METERS
 
 	h := hsin(la2-la1) + math.Cos(la1)*math.Cos(la2)*hsin(lo2-lo1)
 
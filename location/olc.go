@@ -0,0 +1,211 @@
+package location
+
+import (
+	"fmt"
+	"math"
+	"strings"
+)
+
+// Open Location Code (Plus Code) encoding and decoding, following the
+// reference implementation at https://github.com/google/open-location-code
+
+const (
+	olcAlphabet      = "23456789CFGHJMPQRVWX"
+	olcSeparator     = '+'
+	olcSeparatorPos  = 8
+	olcPadding       = '0'
+	olcEncodingBase  = 20
+	olcPairCodeLen   = 10
+	olcMaxCodeLen    = 15
+	olcGridCodeLen   = olcMaxCodeLen - olcPairCodeLen
+	olcGridRows      = 5
+	olcGridCols      = 4
+	olcPairPrecision = 8000
+
+	// Precision of the last digit of a 15 digit code, in units per degree
+	olcFinalLatPrecision = olcPairPrecision * 3125 // olcGridRows ^ olcGridCodeLen
+	olcFinalLngPrecision = olcPairPrecision * 1024 // olcGridCols ^ olcGridCodeLen
+)
+
+// CodeArea is the area covered by a Plus Code.
+type CodeArea struct {
+	LatLo      float64 `json:"latLo"`
+	LngLo      float64 `json:"lngLo"`
+	LatHi      float64 `json:"latHi"`
+	LngHi      float64 `json:"lngHi"`
+	CodeLength int     `json:"codeLength"`
+}
+
+// Center returns the center of the area, clipped to the valid latitudes.
+func (a CodeArea) Center() (lat, lng float64) {
+	lat = math.Min((a.LatLo+a.LatHi)/2, 90)
+	lng = math.Min((a.LngLo+a.LngHi)/2, 180)
+	return
+}
+
+// EncodePlusCode returns the Plus Code of (lat, lng) with codeLength digits,
+// 10 digits is about 14m x 14m and is what most applications use.
+func EncodePlusCode(lat, lng float64, codeLength int) (string, error) {
+	if codeLength < 2 || (codeLength < olcPairCodeLen && codeLength%2 == 1) {
+		return "", fmt.Errorf("invalid plus code length %v", codeLength)
+	}
+	if codeLength > olcMaxCodeLen {
+		codeLength = olcMaxCodeLen
+	}
+
+	latVal := int64(math.Round(lat*olcFinalLatPrecision)) + 90*olcFinalLatPrecision
+	if latVal < 0 {
+		latVal = 0
+	} else if latVal >= 180*olcFinalLatPrecision {
+		latVal = 180*olcFinalLatPrecision - 1
+	}
+
+	lngVal := int64(math.Round(lng*olcFinalLngPrecision)) + 180*olcFinalLngPrecision
+	lngVal %= 360 * olcFinalLngPrecision
+	if lngVal < 0 {
+		lngVal += 360 * olcFinalLngPrecision
+	}
+
+	digits := make([]byte, olcMaxCodeLen)
+	for i := olcMaxCodeLen - 1; i >= olcPairCodeLen; i-- {
+		digits[i] = olcAlphabet[(latVal%olcGridRows)*olcGridCols+lngVal%olcGridCols]
+		latVal /= olcGridRows
+		lngVal /= olcGridCols
+	}
+	for i := olcPairCodeLen - 2; i >= 0; i -= 2 {
+		digits[i] = olcAlphabet[latVal%olcEncodingBase]
+		digits[i+1] = olcAlphabet[lngVal%olcEncodingBase]
+		latVal /= olcEncodingBase
+		lngVal /= olcEncodingBase
+	}
+
+	code := string(digits[:codeLength])
+	if codeLength < olcSeparatorPos {
+		code += strings.Repeat(string(olcPadding), olcSeparatorPos-codeLength)
+	}
+	return code[:olcSeparatorPos] + string(olcSeparator) + code[olcSeparatorPos:], nil
+}
+
+// DecodePlusCode returns the area covered by a full Plus Code.
+func DecodePlusCode(code string) (CodeArea, error) {
+	if !IsFullPlusCode(code) {
+		return CodeArea{}, fmt.Errorf("%v is not a full plus code", code)
+	}
+
+	clean := strings.ToUpper(code)
+	clean = strings.Replace(clean, string(olcSeparator), "", 1)
+	clean = strings.TrimRight(clean, string(olcPadding))
+	if len(clean) > olcMaxCodeLen {
+		clean = clean[:olcMaxCodeLen]
+	}
+
+	latRes, lngRes := 400.0, 400.0
+	lat, lng := -90.0, -180.0
+	for i := 0; i < len(clean) && i < olcPairCodeLen; i += 2 {
+		latRes /= olcEncodingBase
+		lngRes /= olcEncodingBase
+		lat += float64(strings.IndexByte(olcAlphabet, clean[i])) * latRes
+		lng += float64(strings.IndexByte(olcAlphabet, clean[i+1])) * lngRes
+	}
+	for i := olcPairCodeLen; i < len(clean); i++ {
+		latRes /= olcGridRows
+		lngRes /= olcGridCols
+		d := strings.IndexByte(olcAlphabet, clean[i])
+		lat += float64(d/olcGridCols) * latRes
+		lng += float64(d%olcGridCols) * lngRes
+	}
+
+	return CodeArea{
+		LatLo:      lat,
+		LngLo:      lng,
+		LatHi:      lat + latRes,
+		LngHi:      lng + lngRes,
+		CodeLength: len(clean),
+	}, nil
+}
+
+// IsValidPlusCode checks whether code is a valid full or short Plus Code.
+func IsValidPlusCode(code string) bool {
+	code = strings.ToUpper(code)
+	sep := strings.IndexRune(code, olcSeparator)
+	if sep < 0 || sep != strings.LastIndexByte(code, olcSeparator) || sep > olcSeparatorPos || sep%2 == 1 {
+		return false
+	}
+
+	if pad := strings.IndexRune(code, olcPadding); pad >= 0 {
+		// Padding is only allowed on full codes, must start at an even
+		// position and must run up to the separator which ends the code.
+		if sep < olcSeparatorPos || pad == 0 || pad%2 == 1 {
+			return false
+		}
+		if strings.Trim(code[pad:sep], string(olcPadding)) != "" || sep != len(code)-1 {
+			return false
+		}
+	}
+
+	// A single digit after the separator is not allowed
+	if len(code)-sep-1 == 1 {
+		return false
+	}
+
+	for _, c := range code {
+		if c != olcSeparator && c != olcPadding && !strings.ContainsRune(olcAlphabet, c) {
+			return false
+		}
+	}
+	return true
+}
+
+// IsFullPlusCode checks whether code is a valid full Plus Code, ones that can be decoded on their own.
+func IsFullPlusCode(code string) bool {
+	if !IsValidPlusCode(code) || strings.IndexRune(code, olcSeparator) != olcSeparatorPos {
+		return false
+	}
+	code = strings.ToUpper(code)
+	// The first latitude digit can't go beyond 180 degrees, the first longitude one beyond 360
+	if strings.IndexByte(olcAlphabet, code[0])*olcEncodingBase >= 180 {
+		return false
+	}
+	if len(code) > 1 && strings.IndexByte(olcAlphabet, code[1])*olcEncodingBase >= 360 {
+		return false
+	}
+	return true
+}
+
+// RecoverPlusCode turns a short Plus Code like "8F+9V" into the full code of
+// the closest matching area to the reference location.
+func RecoverPlusCode(short string, refLat, refLng float64) (string, error) {
+	if IsFullPlusCode(short) {
+		return strings.ToUpper(short), nil
+	}
+	if !IsValidPlusCode(short) {
+		return "", fmt.Errorf("%v is not a valid plus code", short)
+	}
+
+	paddingLength := olcSeparatorPos - strings.IndexRune(short, olcSeparator)
+	resolution := math.Pow(olcEncodingBase, float64(2-paddingLength/2))
+	halfRes := resolution / 2
+
+	ref, err := EncodePlusCode(refLat, refLng, olcPairCodeLen)
+	if err != nil {
+		return "", err
+	}
+	area, err := DecodePlusCode(ref[:paddingLength] + strings.ToUpper(short))
+	if err != nil {
+		return "", err
+	}
+
+	lat, lng := area.Center()
+	if refLat+halfRes < lat && lat-resolution >= -90 {
+		lat -= resolution
+	} else if refLat-halfRes > lat && lat+resolution <= 90 {
+		lat += resolution
+	}
+	if refLng+halfRes < lng {
+		lng -= resolution
+	} else if refLng-halfRes > lng {
+		lng += resolution
+	}
+
+	return EncodePlusCode(lat, lng, area.CodeLength)
+}
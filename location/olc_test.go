@@ -0,0 +1,44 @@
+package location
+
+import "testing"
+
+func TestPlusCodeEncoding(t *testing.T) {
+	code, err := EncodePlusCode(47.365590, 8.524997, 10)
+	if err != nil || code != "8FVC9G8F+6X" {
+		t.Errorf("Plus code of (47.365590, 8.524997) is %v (%v), expected 8FVC9G8F+6X", code, err)
+	}
+
+	code, _ = EncodePlusCode(47.365590, 8.524997, 4)
+	if code != "8FVC0000+" {
+		t.Errorf("4 digit plus code is %v, expected 8FVC0000+", code)
+	}
+}
+
+func TestPlusCodeDecoding(t *testing.T) {
+	area, err := DecodePlusCode("8FVC9G8F+6X")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	lat, lng := area.Center()
+	if Distance(lat, lng, 47.365590, 8.524997) > 10 {
+		t.Errorf("Decoded center (%v, %v) is too far from (47.365590, 8.524997)", lat, lng)
+	}
+
+	if _, err := DecodePlusCode("9G8F+6X"); err == nil {
+		t.Error("Expected short codes to fail decoding without a reference")
+	}
+}
+
+func TestPlusCodeRecovery(t *testing.T) {
+	code, err := RecoverPlusCode("9G8F+6X", 47.4, 8.6)
+	if err != nil || code != "8FVC9G8F+6X" {
+		t.Errorf("Recovered code is %v (%v), expected 8FVC9G8F+6X", code, err)
+	}
+
+	for _, invalid := range []string{"8FVC9G8F6X", "8FVC9G8F+6X+", "8FV0+", "8FVC9G8F+6", "8FVC9G8I+6X"} {
+		if IsValidPlusCode(invalid) {
+			t.Errorf("Expected %v to be invalid", invalid)
+		}
+	}
+}
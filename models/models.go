@@ -4,6 +4,9 @@ type Peer struct {
 	ID       string                 `json:"peerID"`
 	RawMap   map[string]interface{} `json:"profile"`
 	LastPing int64                  `json:"lastPing"`
+
+	// Fields are the indexed custom fields of the profile, see servicestore.IndexProfileFields
+	Fields map[string]interface{} `json:"fields"`
 }
 
 /**
@@ -66,6 +69,20 @@ type ListingClass struct {
 	PeerSlug      string    `json:"peerSlug"`
 	ParentPeer    string    `json:"parentPeer"`
 	Location      Location  `json:"location"`
+
+	// Pricing is computed when the listing is indexed
+	Pricing ListingPrice `json:"pricing"`
+	// VendorFields are the indexed custom fields of the vendor's profile
+	VendorFields map[string]interface{} `json:"vendorFields"`
+}
+
+// ListingPrice is the price of a listing in whole units of its pricing currency, queries
+// convert it with the current exchange rates so listings priced in different currencies compare.
+type ListingPrice struct {
+	Amount   float64 `json:"amount"`
+	Currency string  `json:"currency"`
+	// RateMethod is what Amount is charged for, "hourly", "fixed" or "per-unit"
+	RateMethod string `json:"rateMethod"`
 }
 
 type Item struct {
@@ -111,6 +128,7 @@ type Metadata struct {
 	Expiry                string   `json:"expiry"`
 	AcceptedCurrencies    []string `json:"acceptedCurrencies"`
 	PricingCurrency       string   `json:"pricingCurrency"`
+	CoinDivisibility      int64    `json:"coinDivisibility"`
 	EscrowTimeoutHours    int64    `json:"escrowTimeoutHours"`
 	ServiceRateMethod     string   `json:"serviceRateMethod"`
 	ServiceClassification string   `json:"serviceClassification"`
@@ -145,6 +163,85 @@ type AdvancedSearchQuery struct {
 	Sort       string        `json:"sort"`
 	// Generous means that all of the database items are going to be filtered
 	Generous bool `json:"generous"`
+	// Fuzzy corrects typos in the query against the indexed terms
+	Fuzzy bool `json:"fuzzy"`
+	// Near only keeps the listings within a radius, see NearQuery
+	Near *NearQuery `json:"near"`
+	// Order is a first class ordering that takes precedence over Sort, "distance" is
+	// only meaningful along with Near
+	Order string `json:"order"`
+	// Where is a structured filter applied along with Filters, see FilterNode
+	Where *FilterNode `json:"where"`
+	// Currency is the currency the buyer sees prices in, MinPrice and MaxPrice are in
+	// this currency as well as the "convertedPrice" of the hits. Defaults to USD.
+	Currency string   `json:"currency"`
+	MinPrice *float64 `json:"minPrice"`
+	MaxPrice *float64 `json:"maxPrice"`
+	// Category only keeps the listings classified under a node of the service taxonomy or
+	// any of its descendants, given as a code or a path like "Home Services > Plumbing"
+	Category string `json:"category"`
+	// RateMethod only keeps the listings charging "hourly", "fixed" or "per-unit"
+	RateMethod string `json:"rateMethod"`
+	// Hours and Units estimate the cost of the listings for that much work, so hourly,
+	// fixed and per unit rates compare. The hits carry it as their "estimatedCost".
+	Hours float64 `json:"hours"`
+	Units float64 `json:"units"`
+	// Expand embeds related documents in the hits, "vendor" embeds the VendorProjection
+	// fields of the listing's vendor, see servicestore.DefaultVendorProjection
+	Expand           []string `json:"expand"`
+	VendorProjection []string `json:"vendorProjection"`
+	// OnlineOnly drops the hits whose peer, or the vendor for listings, isn't online
+	OnlineOnly bool `json:"onlineOnly"`
+	// Explain reports the documents left and the time spent after each stage of the query
+	Explain bool `json:"explain"`
+	// Cursor is the nextCursor of a previous page, the rest of the query is ignored
+	// when it is set except for Transforms
+	Cursor string `json:"cursor"`
+}
+
+// FilterNode is a structured filter, either a combination of nodes (And, Or, Not), or a
+// condition on Field, where Field is a dotted path into the document like "item.price".
+//
+//	{"and": [{"field": "item.price", "lte": 5000}, {"in": {"field": "metadata.acceptedCurrencies", "values": ["BTC"]}}]}
+type FilterNode struct {
+	And []*FilterNode `json:"and,omitempty"`
+	Or  []*FilterNode `json:"or,omitempty"`
+	Not *FilterNode   `json:"not,omitempty"`
+
+	Field    string      `json:"field,omitempty"`
+	Eq       interface{} `json:"eq,omitempty"`
+	Ne       interface{} `json:"ne,omitempty"`
+	Lt       interface{} `json:"lt,omitempty"`
+	Lte      interface{} `json:"lte,omitempty"`
+	Gt       interface{} `json:"gt,omitempty"`
+	Gte      interface{} `json:"gte,omitempty"`
+	Contains string      `json:"contains,omitempty"`
+	Like     string      `json:"like,omitempty"`
+	Fuzzy    string      `json:"fuzzy,omitempty"`
+	Exists   *bool       `json:"exists,omitempty"`
+
+	In   *InFilter   `json:"in,omitempty"`
+	Near *NearFilter `json:"near,omitempty"`
+}
+
+// InFilter matches documents where Field, or any of its elements if it is an array, is one of Values.
+type InFilter struct {
+	Field  string        `json:"field"`
+	Values []interface{} `json:"values"`
+}
+
+// NearFilter matches documents whose location at Field, "location" if empty,
+// is within RadiusMeters of (Lat, Lng).
+type NearFilter struct {
+	Field string `json:"field"`
+	NearQuery
+}
+
+// NearQuery restricts a listing search to the listings within RadiusMeters of (Lat, Lng).
+type NearQuery struct {
+	Lat          float64 `json:"lat"`
+	Lng          float64 `json:"lng"`
+	RadiusMeters float64 `json:"radiusMeters"`
 }
 
 // Probably Remove everything beyond this block in the future
@@ -0,0 +1,54 @@
+package openapi
+
+import (
+	"testing"
+	"time"
+)
+
+type point struct {
+	Lat float64 `json:"lat"`
+	Lng float64 `json:"lng"`
+}
+
+type node struct {
+	Name     string   `json:"name"`
+	Children []*node  `json:"children,omitempty"`
+	Tags     []string `json:"tags"`
+	Skipped  string   `json:"-"`
+	hidden   string
+	Created  time.Time              `json:"created"`
+	Extra    map[string]interface{} `json:"extra"`
+	point
+}
+
+func TestSchemaOf(t *testing.T) {
+	doc := NewDocument(Info{Title: "test"})
+	ref := doc.SchemaOf(&node{})
+	if ref.Ref != "#/components/schemas/openapi.node" {
+		t.Fatalf("unexpected reference %q", ref.Ref)
+	}
+
+	schema := doc.Components.Schemas["openapi.node"]
+	for _, property := range []string{"name", "children", "tags", "created", "extra", "lat", "lng"} {
+		if schema.Properties[property] == nil {
+			t.Errorf("missing property %v", property)
+		}
+	}
+	for _, property := range []string{"Skipped", "-", "hidden", "point"} {
+		if schema.Properties[property] != nil {
+			t.Errorf("unexpected property %v", property)
+		}
+	}
+
+	if children := schema.Properties["children"]; children.Type != "array" || children.Items.Ref != ref.Ref {
+		t.Errorf("recursive field isn't a reference to itself: %+v", children)
+	}
+	if created := schema.Properties["created"]; created.Format != "date-time" {
+		t.Errorf("time isn't a date-time: %+v", created)
+	}
+
+	doc.Describe(node{}, "name", "The name")
+	if schema.Properties["name"].Description != "The name" {
+		t.Error("description wasn't set")
+	}
+}
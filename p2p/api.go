@@ -10,20 +10,24 @@ import (
 
 	"github.com/gorilla/mux"
     "github.com/gorilla/websocket"
-	"github.com/perlin-network/noise/skademlia"
 
 	jsoniter "github.com/json-iterator/go"
 
 	"github.com/nokusukun/particles/satellite"
 
+	"github.com/kimitzu/kimitzu-services/cors"
 	"github.com/kimitzu/kimitzu-services/models"
 )
 
 var json = jsoniter.ConfigCompatibleWithStandardLibrary
+
+// OriginPolicy decides which web pages can open the rating websockets.
+var OriginPolicy = cors.DefaultPolicy
+
 var upgrader = websocket.Upgrader{
-    CheckOrigin: func(r *http.Request) bool {
-        return true
-    },
+	CheckOrigin: func(r *http.Request) bool {
+		return OriginPolicy.CheckOrigin(r)
+	},
 }
 
 type WriteRequest struct {
@@ -34,10 +38,6 @@ type WriteRequest struct {
 }
 
 func setupResponse(w *http.ResponseWriter, req *http.Request) bool {
-	(*w).Header().Set("Access-Control-Allow-Origin", req.Header.Get("origin"))
-	(*w).Header().Set("Access-Control-Allow-Methods", "POST, GET, PATCH, PUT, DELETE, OPTIONS")
-	(*w).Header().Set("Access-Control-Allow-Headers", "Accept, Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization, Origin, X-Requested-With")
-	(*w).Header().Set("Access-Control-Allow-Credentials", "true")
 	(*w).Header().Set("Content-Type", "application/json")
 	if req.Method == "OPTIONS" {
 		(*w).WriteHeader(http.StatusOK)
@@ -117,18 +117,7 @@ func AttachAPI(sat *satellite.Satellite, router *mux.Router, manager *RatingMana
 		_ = json.Unmarshal(b, &contract)
 
 		// Ingest Rating to internal database
-		var rating *Rating
-		if publishType == "fulfill" {
-			rating, err = manager.IngestFulfillmentRating(contract)
-		} else if publishType == "complete" {
-			rating, err = manager.IngestCompletionRating(contract)
-		} else {
-			_ = json.NewEncoder(w).Encode(map[string]interface{}{
-				"error": "endpoint only accepts either 'vendor' or 'buyer'",
-			})
-			return
-		}
-
+		rating, err := manager.IngestRating(publishType, contract)
 		if err != nil {
 			_ = json.NewEncoder(w).Encode(map[string]interface{}{
 				"error": fmt.Sprint(err),
@@ -138,15 +127,9 @@ func AttachAPI(sat *satellite.Satellite, router *mux.Router, manager *RatingMana
 
 		// Broadcast to the network
 		var errCode string
-		errs := skademlia.Broadcast(sat.Node, satellite.Packet{
-			PacketType: satellite.PType_Broadcast,
-			Namespace:  "new_rating",
-			Payload:    rating,
-		})
-
-		if errs != nil {
-			log.Debugf("failed to broadcast: %v", err)
-			errCode = fmt.Sprintf("failed to broadcast: %v", err)
+		if err := BroadcastRating(sat, rating); err != nil {
+			log.Debug(err)
+			errCode = err.Error()
 		}
 
 		_ = json.NewEncoder(w).Encode(map[string]interface{}{
@@ -2,10 +2,13 @@ package p2p
 
 import (
 	"bufio"
+	"context"
 	"encoding/hex"
 	"fmt"
 	"io/ioutil"
 	"os"
+	"sync"
+	"sync/atomic"
 
 	"github.com/nokusukun/particles/config"
 	"github.com/nokusukun/particles/keys"
@@ -14,78 +17,143 @@ import (
 	"github.com/perlin-network/noise/skademlia"
 
 	"github.com/kimitzu/kimitzu-services/configs"
+	"github.com/kimitzu/kimitzu-services/health"
 )
 
 var log = roggy.Printer("p2p")
 var Sat *satellite.Satellite
 
-func Bootstrap(cdae *configs.Daemon, csat *config.Satellite, ratingManager *RatingManager, killsig chan int) {
-	var boostrapNodes = [1]string{"109.201.140.20:9009"}
+var bootstrapNodes = []string{"109.201.140.20:9009"}
 
-	//todo: move most of this in the services main function
+// bootstrapStatus counts the bootstrap nodes dialed and reached by the node.
+type bootstrapStatus struct {
+	lock      *sync.Mutex
+	dialed    int
+	connected int
+	done      bool
+}
+
+var bootstrap = &bootstrapStatus{lock: &sync.Mutex{}}
+
+func (b *bootstrapStatus) reset() {
+	b.lock.Lock()
+	b.dialed, b.connected, b.done = 0, 0, false
+	b.lock.Unlock()
+}
+
+func (b *bootstrapStatus) dial(node string) {
+	connected := dial(node)
+	b.lock.Lock()
+	b.dialed++
+	if connected {
+		b.connected++
+	}
+	b.lock.Unlock()
+}
+
+func (b *bootstrapStatus) finish() {
+	b.lock.Lock()
+	b.done = true
+	b.lock.Unlock()
+}
+
+func (b *bootstrapStatus) details() health.Details {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	return health.Details{"dialed": b.dialed, "connected": b.connected, "done": b.done}
+}
+
+// Node is the satellite node of the ratings network as a lifecycle.Service, it owns
+// Ratings and closes it when stopped.
+type Node struct {
+	Daemon    *configs.Daemon
+	Satellite *config.Satellite
+	Ratings   *RatingManager
+
+	running int32
+}
+
+func (n *Node) Name() string {
+	return "p2p"
+}
+
+// Start builds the node as Sat and dials the bootstrap nodes in the background.
+func (n *Node) Start(ctx context.Context) error {
 	log.Info("Starting Particle Daemon")
 	printSplash()
 
 	log.Debug(roggy.Clr("TURNING ON DEBUG LOGS WILL SEVERELY IMPACT PERFORMANCE", 1))
 
-	if cdae.DatabasePath == "" {
-		log.Error("No database path provided --dbpath")
-		roggy.Wait()
-		os.Exit(1)
+	if n.Daemon.DatabasePath == "" {
+		return fmt.Errorf("no database path provided --dbpath")
 	}
 
 	// satellite bootstrapping
-	keyPair, err := getKeys(cdae.KeyPath, cdae.GenerateNewKeys)
+	keyPair, err := getKeys(n.Daemon.KeyPath, n.Daemon.GenerateNewKeys)
 	if err != nil {
-		log.Error("Failed to get keypair:", err)
 		log.Error("Your key might not exist, try with the -generate flag")
-		os.Exit(1)
+		return fmt.Errorf("failed to get keypair: %v", err)
 	}
-	Sat = satellite.BuildNetwork(csat, keyPair)
+	Sat = satellite.BuildNetwork(n.Satellite, keyPair)
+	bootstrapEvents(Sat, n.Ratings)
 
-	for i := 0; i < len(boostrapNodes); i++ {
-		if cdae.BootstrapNodeIdentity != boostrapNodes[i] {
-			dial(boostrapNodes[i])
-		}
-	}
+	atomic.StoreInt32(&n.running, 1)
 
-	if cdae.DialTo != "" {
-		dial(cdae.DialTo)
-	}
-
-	bootstrapEvents(Sat, ratingManager)
+	bootstrap.reset()
+	go func() {
+		for _, node := range bootstrapNodes {
+			if ctx.Err() != nil {
+				return
+			}
+			if n.Daemon.BootstrapNodeIdentity != node {
+				bootstrap.dial(node)
+			}
+		}
 
-	// API
-	//if cdae.ApiListen != "" {
-	//    log.Notice("Starting API on:", cdae.ApiListen)
-	//    router := generateAPI(sat)
-	//    log.Error(http.ListenAndServe(cdae.ApiListen, router))
-	//} else {
-	//    log.Notice("No API port provided")
-	//}
+		if n.Daemon.DialTo != "" && ctx.Err() == nil {
+			bootstrap.dial(n.Daemon.DialTo)
+		}
+		bootstrap.finish()
+	}()
+	return nil
+}
 
-	defer func() {
-		err := ratingManager.Close()
-		if err != nil {
-			log.Error("failed to close database", err)
+// HealthCheck reports the node down while it isn't running, along with its
+// peer count and how bootstrapping went.
+func (n *Node) HealthCheck() health.Check {
+	return health.Check{Name: "p2p", Required: true, Probe: func(ctx context.Context) (health.Details, error) {
+		if atomic.LoadInt32(&n.running) == 0 || Sat == nil {
+			return nil, fmt.Errorf("the satellite node isn't running")
 		}
+		return health.Details{"peers": len(Sat.Peers), "bootstrap": bootstrap.details()}, nil
+	}}
+}
+
+// Stop kills the node and closes the ratings database.
+func (n *Node) Stop(ctx context.Context) error {
+	atomic.StoreInt32(&n.running, 0)
+	if Sat != nil {
 		log.Info("Killing node...")
 		Sat.Node.Kill()
-		roggy.Wait()
-	}()
-
-	<-killsig
+	}
+	if err := n.Ratings.Close(); err != nil {
+		return fmt.Errorf("failed to close database: %v", err)
+	}
+	return nil
 }
 
-func dial(node string) {
+// dial bootstraps from node, it returns whether node was reached.
+func dial(node string) bool {
 	log.Info("Connecting s/kad bootstrap at ", node)
 	peer, err := Sat.Node.Dial(node)
 	if err != nil {
 		log.Errorf("Failed to dial to s/kad bootstrap")
+		return false
 	}
 	log.Debugf("waiting %v for bootstrap s/kad authentication", node)
 	skademlia.WaitUntilAuthenticated(peer)
 	log.Infof("Bootstrapped to: %v", satellite.GetPeerID(peer))
+	return true
 }
 
 func getKeys(path string, newKeys bool) (*skademlia.Keypair, error) {
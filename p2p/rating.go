@@ -1,14 +1,22 @@
 package p2p
 
 import (
+	"bytes"
+	"errors"
 	"fmt"
 	"os"
+	"strings"
 
 	"github.com/boltdb/bolt"
+	"github.com/nokusukun/particles/satellite"
+	"github.com/perlin-network/noise/skademlia"
 
 	"github.com/kimitzu/kimitzu-services/models"
 )
 
+// ErrRatingType is returned when publishing a rating that is neither "fulfill" nor "complete".
+var ErrRatingType = errors.New("endpoint only accepts either 'fulfill' or 'complete'")
+
 type Rating struct {
 	Type          string             `json:"type"`
 	Source        string             `json:"src"`
@@ -67,6 +75,32 @@ func (rm *RatingManager) InsertRating(rating *Rating) (err error) {
 	})
 }
 
+// RatingsOf reads the ratings given to each of destinations in one transaction, a peer ID
+// gets the ratings of its listings ("peerID@slug") as well.
+func (rm *RatingManager) RatingsOf(destinations []string) (map[string][]*Rating, error) {
+	ratings := make(map[string][]*Rating)
+	err := rm.db.View(func(tx *bolt.Tx) error {
+		cur := tx.Bucket([]byte("ratings")).Cursor()
+		for _, dst := range destinations {
+			ratings[dst] = []*Rating{}
+			prefix := []byte(dst)
+			for k, v := cur.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, v = cur.Next() {
+				rating := &Rating{}
+				if err := json.Unmarshal(v, rating); err != nil {
+					log.Error("Failed to unmarshal:", string(k))
+					continue
+				}
+				// Keys are the destination followed by the source, so the prefix matches longer slugs too
+				if rating.Destination == dst || strings.HasPrefix(rating.Destination, dst+"@") {
+					ratings[dst] = append(ratings[dst], rating)
+				}
+			}
+		}
+		return nil
+	})
+	return ratings, err
+}
+
 func (rm *RatingManager) Close() error {
 	return rm.db.Close()
 }
@@ -99,6 +133,31 @@ func (rm *RatingManager) IngestFulfillmentRating(contract *models.Contract) (rat
 	return
 }
 
+// IngestRating stores the rating in contract, publishType is "fulfill" for
+// the rating the vendor gives the buyer or "complete" for the buyer's rating.
+func (rm *RatingManager) IngestRating(publishType string, contract *models.Contract) (*Rating, error) {
+	switch publishType {
+	case "fulfill":
+		return rm.IngestFulfillmentRating(contract)
+	case "complete":
+		return rm.IngestCompletionRating(contract)
+	}
+	return nil, ErrRatingType
+}
+
+// BroadcastRating announces rating to the network.
+func BroadcastRating(sat *satellite.Satellite, rating *Rating) error {
+	errs := skademlia.Broadcast(sat.Node, satellite.Packet{
+		PacketType: satellite.PType_Broadcast,
+		Namespace:  "new_rating",
+		Payload:    rating,
+	})
+	if errs != nil {
+		return fmt.Errorf("failed to broadcast: %v", errs)
+	}
+	return nil
+}
+
 func VendorRatingFromContract(contract *models.Contract) (rating *Rating, err error) {
 	rating = new(Rating)
 
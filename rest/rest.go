@@ -0,0 +1,110 @@
+package rest
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// Error codes shared by the /v1 routes, clients should branch on these rather than the messages.
+const (
+	CodeBadRequest       = "badRequest"
+	CodeInvalidQuery     = "invalidQuery"
+	CodeNotFound         = "notFound"
+	CodeMethodNotAllowed = "methodNotAllowed"
+	CodeUnauthorized     = "unauthorized"
+	CodeForbidden        = "forbidden"
+	CodeUnavailable      = "unavailable"
+	CodeUpstreamFailure  = "upstreamFailure"
+	CodeTimeout          = "timeout"
+	CodeInternal         = "internal"
+)
+
+// MaxBodySize is the largest request body Decode reads.
+const MaxBodySize = 1 << 20
+
+// Response is the envelope of every /v1 response, exactly one of Data and Error is set.
+type Response struct {
+	RequestID string      `json:"requestID"`
+	Data      interface{} `json:"data,omitempty"`
+	Error     *Error      `json:"error,omitempty"`
+}
+
+// Error is an error reported to the client, Status is the HTTP status it is sent with.
+type Error struct {
+	Status  int         `json:"-"`
+	Code    string      `json:"code"`
+	Message string      `json:"message"`
+	Details interface{} `json:"details,omitempty"`
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%v: %v", e.Code, e.Message)
+}
+
+// Errorf returns an Error with a formatted message.
+func Errorf(status int, code string, format string, args ...interface{}) *Error {
+	return &Error{Status: status, Code: code, Message: fmt.Sprintf(format, args...)}
+}
+
+// AsError converts err to an Error, errors that aren't one are internal errors.
+func AsError(err error) *Error {
+	if e, ok := err.(*Error); ok {
+		return e
+	}
+	return &Error{Status: http.StatusInternalServerError, Code: CodeInternal, Message: err.Error()}
+}
+
+// Result is data sent with a status other than 200.
+type Result struct {
+	Status int
+	Data   interface{}
+}
+
+// WithStatus sends data with status instead of 200.
+func WithStatus(status int, data interface{}) *Result {
+	return &Result{Status: status, Data: data}
+}
+
+// HandlerFunc is a /v1 handler, it returns the data or the error to send in the envelope.
+type HandlerFunc func(r *http.Request) (interface{}, error)
+
+func (h HandlerFunc) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	data, err := h(r)
+	if err != nil {
+		WriteError(w, r, err)
+		return
+	}
+
+	status := http.StatusOK
+	if result, ok := data.(*Result); ok {
+		status, data = result.Status, result.Data
+	}
+	write(w, status, Response{RequestID: RequestID(r.Context()), Data: data})
+}
+
+// WriteError sends err in the envelope.
+func WriteError(w http.ResponseWriter, r *http.Request, err error) {
+	e := AsError(err)
+	write(w, e.Status, Response{RequestID: RequestID(r.Context()), Error: e})
+}
+
+func write(w http.ResponseWriter, status int, response Response) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(response)
+}
+
+// Decode reads the JSON body of r into v.
+func Decode(r *http.Request, v interface{}) error {
+	defer r.Body.Close()
+	err := json.NewDecoder(io.LimitReader(r.Body, MaxBodySize)).Decode(v)
+	if err == io.EOF {
+		return Errorf(http.StatusBadRequest, CodeBadRequest, "the request body is empty")
+	}
+	if err != nil {
+		return Errorf(http.StatusBadRequest, CodeBadRequest, "failed to decode the request body: %v", err)
+	}
+	return nil
+}
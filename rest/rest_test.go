@@ -0,0 +1,94 @@
+package rest
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func serve(h http.Handler, r *http.Request) (*httptest.ResponseRecorder, Response) {
+	w := httptest.NewRecorder()
+	WithRequestID(h).ServeHTTP(w, r)
+
+	response := Response{}
+	_ = json.Unmarshal(w.Body.Bytes(), &response)
+	return w, response
+}
+
+func TestEnvelope(t *testing.T) {
+	h := HandlerFunc(func(r *http.Request) (interface{}, error) {
+		switch r.URL.Path {
+		case "/created":
+			return WithStatus(http.StatusCreated, "done"), nil
+		case "/missing":
+			return nil, Errorf(http.StatusNotFound, CodeNotFound, "no such thing")
+		case "/broken":
+			return nil, errors.New("disk on fire")
+		}
+		return map[string]int{"count": 1}, nil
+	})
+
+	cases := []struct {
+		path   string
+		status int
+		code   string
+	}{
+		{"/", 200, ""},
+		{"/created", 201, ""},
+		{"/missing", 404, CodeNotFound},
+		{"/broken", 500, CodeInternal},
+	}
+	for _, c := range cases {
+		w, response := serve(h, httptest.NewRequest("GET", c.path, nil))
+		if w.Code != c.status {
+			t.Errorf("%v: status %v, want %v", c.path, w.Code, c.status)
+		}
+		if w.Header().Get("Content-Type") != "application/json" {
+			t.Errorf("%v: content type %v", c.path, w.Header().Get("Content-Type"))
+		}
+		if response.RequestID == "" || response.RequestID != w.Header().Get(RequestIDHeader) {
+			t.Errorf("%v: request ID %q doesn't match the header %q", c.path, response.RequestID, w.Header().Get(RequestIDHeader))
+		}
+		if c.code == "" && (response.Error != nil || response.Data == nil) {
+			t.Errorf("%v: unexpected response %+v", c.path, response)
+		}
+		if c.code != "" && (response.Error == nil || response.Error.Code != c.code) {
+			t.Errorf("%v: unexpected error %+v", c.path, response.Error)
+		}
+	}
+}
+
+func TestRequestID(t *testing.T) {
+	h := HandlerFunc(func(r *http.Request) (interface{}, error) { return nil, nil })
+
+	r := httptest.NewRequest("GET", "/", nil)
+	r.Header.Set(RequestIDHeader, "client-42")
+	if _, response := serve(h, r); response.RequestID != "client-42" {
+		t.Errorf("client request ID wasn't kept, got %q", response.RequestID)
+	}
+
+	r = httptest.NewRequest("GET", "/", nil)
+	r.Header.Set(RequestIDHeader, "bad id\n")
+	if _, response := serve(h, r); response.RequestID == "bad id\n" || response.RequestID == "" {
+		t.Errorf("invalid request ID wasn't replaced, got %q", response.RequestID)
+	}
+}
+
+func TestDecode(t *testing.T) {
+	v := struct {
+		ID string `json:"id"`
+	}{}
+
+	if err := Decode(httptest.NewRequest("POST", "/", strings.NewReader(`{"id": "a"}`)), &v); err != nil || v.ID != "a" {
+		t.Errorf("decode = %v, %+v", err, v)
+	}
+	for _, body := range []string{"", "{"} {
+		err := Decode(httptest.NewRequest("POST", "/", strings.NewReader(body)), &v)
+		if e, ok := err.(*Error); !ok || e.Status != http.StatusBadRequest {
+			t.Errorf("body %q: got %v", body, err)
+		}
+	}
+}
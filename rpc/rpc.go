@@ -0,0 +1,57 @@
+// Package rpc is the gRPC service of the daemon, described in services.proto. The
+// messages are protocol buffers, the documents of the stores are carried as
+// google.protobuf.Struct. Clients may send application/grpc+json instead, see Codec.
+package rpc
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative services.proto
+
+import (
+	"encoding/json"
+
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+// Full names of the methods, as seen by interceptors.
+const (
+	MethodSearchListings = Services_SearchListings_FullMethodName
+	MethodSearchPeers    = Services_SearchPeers_FullMethodName
+	MethodGetPeer        = Services_GetPeer_FullMethodName
+	MethodAddPeer        = Services_AddPeer_FullMethodName
+	MethodPublishRating  = Services_PublishRating_FullMethodName
+	MethodSeekRatings    = Services_SeekRatings_FullMethodName
+)
+
+// NewStruct converts v, anything encoding/json encodes as an object, to a Struct.
+// A v encoded as null gives a nil Struct.
+func NewStruct(v interface{}) (*structpb.Struct, error) {
+	b, err := json.Marshal(v)
+	if err != nil || string(b) == "null" {
+		return nil, err
+	}
+	s := &structpb.Struct{}
+	return s, protojson.Unmarshal(b, s)
+}
+
+// NewValue converts v, anything encoding/json encodes, to a Value.
+func NewValue(v interface{}) (*structpb.Value, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	value := &structpb.Value{}
+	return value, protojson.Unmarshal(b, value)
+}
+
+// DecodeStruct decodes s to v like encoding/json would decode the same object, v is
+// left alone when s is nil.
+func DecodeStruct(s *structpb.Struct, v interface{}) error {
+	if s == nil {
+		return nil
+	}
+	b, err := protojson.Marshal(s)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, v)
+}
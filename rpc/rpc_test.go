@@ -0,0 +1,162 @@
+package rpc
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+type testServer struct {
+	UnimplementedServicesServer
+}
+
+func (testServer) SearchListings(ctx context.Context, in *SearchRequest) (*SearchResult, error) {
+	hit, err := NewStruct(map[string]interface{}{"hash": in.Query, "price": in.GetMaxPrice()})
+	if err != nil {
+		return nil, err
+	}
+	return &SearchResult{Count: 1, Limit: in.Limit, Data: []*structpb.Struct{hit}}, nil
+}
+
+func (testServer) SearchPeers(ctx context.Context, in *SearchRequest) (*SearchResult, error) {
+	return nil, status.Error(codes.InvalidArgument, "invalid query")
+}
+
+func (testServer) GetPeer(ctx context.Context, in *PeerRequest) (*Peer, error) {
+	return &Peer{Id: in.Id}, nil
+}
+
+func (testServer) SeekRatings(in *SeekRequest, stream Services_SeekRatingsServer) error {
+	for _, source := range []string{"a", "b"} {
+		if err := stream.Send(&Rating{Source: source, Destination: in.Ids}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func TestService(t *testing.T) {
+	l := bufconn.Listen(1 << 16)
+	server := grpc.NewServer()
+	RegisterServicesServer(server, testServer{})
+	go server.Serve(l)
+	defer server.Stop()
+
+	conn, err := grpc.Dial("bufnet", grpc.WithInsecure(), grpc.WithContextDialer(func(ctx context.Context, address string) (net.Conn, error) {
+		return l.Dial()
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	client := NewServicesClient(conn)
+	ctx := context.Background()
+
+	// Protocol buffers by default, JSON when asked for
+	maxPrice := 12.5
+	for _, opts := range [][]grpc.CallOption{nil, {grpc.CallContentSubtype(CodecName)}} {
+		result, err := client.SearchListings(ctx, &SearchRequest{Query: "Qm", Limit: 5, MaxPrice: &maxPrice}, opts...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		hit := map[string]interface{}{}
+		if err := DecodeStruct(result.Data[0], &hit); err != nil {
+			t.Fatal(err)
+		}
+		if result.Count != 1 || result.Limit != 5 || hit["hash"] != "Qm" || hit["price"] != 12.5 {
+			t.Errorf("%v: unexpected result %v", opts, result)
+		}
+	}
+
+	if _, err := client.SearchPeers(ctx, &SearchRequest{}); status.Code(err) != codes.InvalidArgument {
+		t.Errorf("got %v, want InvalidArgument", err)
+	}
+
+	peer, err := client.GetPeer(ctx, &PeerRequest{Id: "QmPeer"})
+	if err != nil || peer.Id != "QmPeer" {
+		t.Errorf("unexpected peer %v, %v", peer, err)
+	}
+
+	if _, err := client.AddPeer(ctx, &PeerRequest{Id: "QmPeer"}); status.Code(err) != codes.Unimplemented {
+		t.Errorf("got %v, want Unimplemented", err)
+	}
+
+	stream, err := client.SeekRatings(ctx, &SeekRequest{Ids: "QmPeer"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sources := ""
+	for {
+		rating, err := stream.Recv()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if rating.Destination != "QmPeer" {
+			t.Errorf("unexpected rating %v", rating)
+		}
+		sources += rating.Source
+	}
+	if sources != "ab" {
+		t.Errorf("got ratings from %q, want ab", sources)
+	}
+}
+
+func TestCodec(t *testing.T) {
+	b, err := Codec{}.Marshal(&SearchRequest{RateMethod: "hourly", OnlineOnly: true, Near: &Near{RadiusMeters: 10}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The field names are the ones of the HTTP API
+	fields := map[string]interface{}{}
+	if err := json.Unmarshal(b, &fields); err != nil {
+		t.Fatal(err)
+	}
+	near, _ := fields["near"].(map[string]interface{})
+	if len(fields) != 3 || fields["rateMethod"] != "hourly" || fields["onlineOnly"] != true || near["radiusMeters"] != 10.0 {
+		t.Errorf("unexpected JSON %s", b)
+	}
+
+	in := &SearchRequest{}
+	if err := (Codec{}).Unmarshal([]byte(`{"query": "plumber", "minPrice": 5, "unknown": 1}`), in); err != nil {
+		t.Fatal(err)
+	}
+	if in.Query != "plumber" || in.GetMinPrice() != 5 {
+		t.Errorf("unexpected request %v", in)
+	}
+}
+
+func TestStruct(t *testing.T) {
+	type document struct {
+		Hash  string   `json:"hash"`
+		Price float64  `json:"price"`
+		Tags  []string `json:"tags"`
+	}
+
+	s, err := NewStruct(document{"Qm", 2.5, []string{"a"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded := document{}
+	if err := DecodeStruct(s, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if decoded.Hash != "Qm" || decoded.Price != 2.5 || len(decoded.Tags) != 1 {
+		t.Errorf("unexpected document %+v", decoded)
+	}
+
+	var none map[string]interface{}
+	if s, err := NewStruct(none); s != nil || err != nil {
+		t.Errorf("expected a nil Struct, got %v, %v", s, err)
+	}
+}
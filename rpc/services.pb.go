@@ -0,0 +1,1109 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.12
+// 	protoc        (unknown)
+// source: services.proto
+
+package rpc
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	structpb "google.golang.org/protobuf/types/known/structpb"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+// SearchRequest is the search query of the HTTP API, see the search documentation.
+type SearchRequest struct {
+	state      protoimpl.MessageState `protogen:"open.v1"`
+	Query      string                 `protobuf:"bytes,1,opt,name=query,proto3" json:"query,omitempty"`
+	Filters    []string               `protobuf:"bytes,2,rep,name=filters,proto3" json:"filters,omitempty"`
+	Limit      int32                  `protobuf:"varint,3,opt,name=limit,proto3" json:"limit,omitempty"`
+	Start      int32                  `protobuf:"varint,4,opt,name=start,proto3" json:"start,omitempty"`
+	Transforms []*structpb.Value      `protobuf:"bytes,5,rep,name=transforms,proto3" json:"transforms,omitempty"`
+	Sort       string                 `protobuf:"bytes,6,opt,name=sort,proto3" json:"sort,omitempty"`
+	Generous   bool                   `protobuf:"varint,7,opt,name=generous,proto3" json:"generous,omitempty"`
+	Fuzzy      bool                   `protobuf:"varint,8,opt,name=fuzzy,proto3" json:"fuzzy,omitempty"`
+	Near       *Near                  `protobuf:"bytes,9,opt,name=near,proto3" json:"near,omitempty"`
+	Order      string                 `protobuf:"bytes,10,opt,name=order,proto3" json:"order,omitempty"`
+	// Where is a structured filter, a FilterNode of the HTTP API.
+	Where            *structpb.Struct `protobuf:"bytes,11,opt,name=where,proto3" json:"where,omitempty"`
+	Currency         string           `protobuf:"bytes,12,opt,name=currency,proto3" json:"currency,omitempty"`
+	MinPrice         *float64         `protobuf:"fixed64,13,opt,name=min_price,json=minPrice,proto3,oneof" json:"min_price,omitempty"`
+	MaxPrice         *float64         `protobuf:"fixed64,14,opt,name=max_price,json=maxPrice,proto3,oneof" json:"max_price,omitempty"`
+	Category         string           `protobuf:"bytes,15,opt,name=category,proto3" json:"category,omitempty"`
+	RateMethod       string           `protobuf:"bytes,16,opt,name=rate_method,json=rateMethod,proto3" json:"rate_method,omitempty"`
+	Hours            float64          `protobuf:"fixed64,17,opt,name=hours,proto3" json:"hours,omitempty"`
+	Units            float64          `protobuf:"fixed64,18,opt,name=units,proto3" json:"units,omitempty"`
+	Expand           []string         `protobuf:"bytes,19,rep,name=expand,proto3" json:"expand,omitempty"`
+	VendorProjection []string         `protobuf:"bytes,20,rep,name=vendor_projection,json=vendorProjection,proto3" json:"vendor_projection,omitempty"`
+	OnlineOnly       bool             `protobuf:"varint,21,opt,name=online_only,json=onlineOnly,proto3" json:"online_only,omitempty"`
+	Explain          bool             `protobuf:"varint,22,opt,name=explain,proto3" json:"explain,omitempty"`
+	Cursor           string           `protobuf:"bytes,23,opt,name=cursor,proto3" json:"cursor,omitempty"`
+	unknownFields    protoimpl.UnknownFields
+	sizeCache        protoimpl.SizeCache
+}
+
+func (x *SearchRequest) Reset() {
+	*x = SearchRequest{}
+	mi := &file_services_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SearchRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SearchRequest) ProtoMessage() {}
+
+func (x *SearchRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_services_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SearchRequest.ProtoReflect.Descriptor instead.
+func (*SearchRequest) Descriptor() ([]byte, []int) {
+	return file_services_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *SearchRequest) GetQuery() string {
+	if x != nil {
+		return x.Query
+	}
+	return ""
+}
+
+func (x *SearchRequest) GetFilters() []string {
+	if x != nil {
+		return x.Filters
+	}
+	return nil
+}
+
+func (x *SearchRequest) GetLimit() int32 {
+	if x != nil {
+		return x.Limit
+	}
+	return 0
+}
+
+func (x *SearchRequest) GetStart() int32 {
+	if x != nil {
+		return x.Start
+	}
+	return 0
+}
+
+func (x *SearchRequest) GetTransforms() []*structpb.Value {
+	if x != nil {
+		return x.Transforms
+	}
+	return nil
+}
+
+func (x *SearchRequest) GetSort() string {
+	if x != nil {
+		return x.Sort
+	}
+	return ""
+}
+
+func (x *SearchRequest) GetGenerous() bool {
+	if x != nil {
+		return x.Generous
+	}
+	return false
+}
+
+func (x *SearchRequest) GetFuzzy() bool {
+	if x != nil {
+		return x.Fuzzy
+	}
+	return false
+}
+
+func (x *SearchRequest) GetNear() *Near {
+	if x != nil {
+		return x.Near
+	}
+	return nil
+}
+
+func (x *SearchRequest) GetOrder() string {
+	if x != nil {
+		return x.Order
+	}
+	return ""
+}
+
+func (x *SearchRequest) GetWhere() *structpb.Struct {
+	if x != nil {
+		return x.Where
+	}
+	return nil
+}
+
+func (x *SearchRequest) GetCurrency() string {
+	if x != nil {
+		return x.Currency
+	}
+	return ""
+}
+
+func (x *SearchRequest) GetMinPrice() float64 {
+	if x != nil && x.MinPrice != nil {
+		return *x.MinPrice
+	}
+	return 0
+}
+
+func (x *SearchRequest) GetMaxPrice() float64 {
+	if x != nil && x.MaxPrice != nil {
+		return *x.MaxPrice
+	}
+	return 0
+}
+
+func (x *SearchRequest) GetCategory() string {
+	if x != nil {
+		return x.Category
+	}
+	return ""
+}
+
+func (x *SearchRequest) GetRateMethod() string {
+	if x != nil {
+		return x.RateMethod
+	}
+	return ""
+}
+
+func (x *SearchRequest) GetHours() float64 {
+	if x != nil {
+		return x.Hours
+	}
+	return 0
+}
+
+func (x *SearchRequest) GetUnits() float64 {
+	if x != nil {
+		return x.Units
+	}
+	return 0
+}
+
+func (x *SearchRequest) GetExpand() []string {
+	if x != nil {
+		return x.Expand
+	}
+	return nil
+}
+
+func (x *SearchRequest) GetVendorProjection() []string {
+	if x != nil {
+		return x.VendorProjection
+	}
+	return nil
+}
+
+func (x *SearchRequest) GetOnlineOnly() bool {
+	if x != nil {
+		return x.OnlineOnly
+	}
+	return false
+}
+
+func (x *SearchRequest) GetExplain() bool {
+	if x != nil {
+		return x.Explain
+	}
+	return false
+}
+
+func (x *SearchRequest) GetCursor() string {
+	if x != nil {
+		return x.Cursor
+	}
+	return ""
+}
+
+// Near only keeps the listings within radius_meters of a point.
+type Near struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Lat           float64                `protobuf:"fixed64,1,opt,name=lat,proto3" json:"lat,omitempty"`
+	Lng           float64                `protobuf:"fixed64,2,opt,name=lng,proto3" json:"lng,omitempty"`
+	RadiusMeters  float64                `protobuf:"fixed64,3,opt,name=radius_meters,json=radiusMeters,proto3" json:"radius_meters,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Near) Reset() {
+	*x = Near{}
+	mi := &file_services_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Near) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Near) ProtoMessage() {}
+
+func (x *Near) ProtoReflect() protoreflect.Message {
+	mi := &file_services_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Near.ProtoReflect.Descriptor instead.
+func (*Near) Descriptor() ([]byte, []int) {
+	return file_services_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *Near) GetLat() float64 {
+	if x != nil {
+		return x.Lat
+	}
+	return 0
+}
+
+func (x *Near) GetLng() float64 {
+	if x != nil {
+		return x.Lng
+	}
+	return 0
+}
+
+func (x *Near) GetRadiusMeters() float64 {
+	if x != nil {
+		return x.RadiusMeters
+	}
+	return 0
+}
+
+// SearchResult is a page of listings or peers.
+type SearchResult struct {
+	state      protoimpl.MessageState `protogen:"open.v1"`
+	Count      int32                  `protobuf:"varint,1,opt,name=count,proto3" json:"count,omitempty"`
+	Limit      int32                  `protobuf:"varint,2,opt,name=limit,proto3" json:"limit,omitempty"`
+	NextStart  int32                  `protobuf:"varint,3,opt,name=next_start,json=nextStart,proto3" json:"next_start,omitempty"`
+	NextCursor string                 `protobuf:"bytes,4,opt,name=next_cursor,json=nextCursor,proto3" json:"next_cursor,omitempty"`
+	// Data are the documents as indexed.
+	Data          []*structpb.Struct `protobuf:"bytes,5,rep,name=data,proto3" json:"data,omitempty"`
+	FilterErrors  []*FilterError     `protobuf:"bytes,6,rep,name=filter_errors,json=filterErrors,proto3" json:"filter_errors,omitempty"`
+	Explain       *structpb.Struct   `protobuf:"bytes,7,opt,name=explain,proto3" json:"explain,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *SearchResult) Reset() {
+	*x = SearchResult{}
+	mi := &file_services_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SearchResult) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SearchResult) ProtoMessage() {}
+
+func (x *SearchResult) ProtoReflect() protoreflect.Message {
+	mi := &file_services_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SearchResult.ProtoReflect.Descriptor instead.
+func (*SearchResult) Descriptor() ([]byte, []int) {
+	return file_services_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *SearchResult) GetCount() int32 {
+	if x != nil {
+		return x.Count
+	}
+	return 0
+}
+
+func (x *SearchResult) GetLimit() int32 {
+	if x != nil {
+		return x.Limit
+	}
+	return 0
+}
+
+func (x *SearchResult) GetNextStart() int32 {
+	if x != nil {
+		return x.NextStart
+	}
+	return 0
+}
+
+func (x *SearchResult) GetNextCursor() string {
+	if x != nil {
+		return x.NextCursor
+	}
+	return ""
+}
+
+func (x *SearchResult) GetData() []*structpb.Struct {
+	if x != nil {
+		return x.Data
+	}
+	return nil
+}
+
+func (x *SearchResult) GetFilterErrors() []*FilterError {
+	if x != nil {
+		return x.FilterErrors
+	}
+	return nil
+}
+
+func (x *SearchResult) GetExplain() *structpb.Struct {
+	if x != nil {
+		return x.Explain
+	}
+	return nil
+}
+
+// FilterError is a filter that failed to compile or run.
+type FilterError struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Filter        string                 `protobuf:"bytes,1,opt,name=filter,proto3" json:"filter,omitempty"`
+	Message       string                 `protobuf:"bytes,2,opt,name=message,proto3" json:"message,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *FilterError) Reset() {
+	*x = FilterError{}
+	mi := &file_services_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *FilterError) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*FilterError) ProtoMessage() {}
+
+func (x *FilterError) ProtoReflect() protoreflect.Message {
+	mi := &file_services_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use FilterError.ProtoReflect.Descriptor instead.
+func (*FilterError) Descriptor() ([]byte, []int) {
+	return file_services_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *FilterError) GetFilter() string {
+	if x != nil {
+		return x.Filter
+	}
+	return ""
+}
+
+func (x *FilterError) GetMessage() string {
+	if x != nil {
+		return x.Message
+	}
+	return ""
+}
+
+// PeerRequest picks a peer, an empty id is the peer of the node. Force crawls the peer
+// again even if it is already indexed.
+type PeerRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Id            string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	Force         bool                   `protobuf:"varint,2,opt,name=force,proto3" json:"force,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *PeerRequest) Reset() {
+	*x = PeerRequest{}
+	mi := &file_services_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *PeerRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*PeerRequest) ProtoMessage() {}
+
+func (x *PeerRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_services_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use PeerRequest.ProtoReflect.Descriptor instead.
+func (*PeerRequest) Descriptor() ([]byte, []int) {
+	return file_services_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *PeerRequest) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+func (x *PeerRequest) GetForce() bool {
+	if x != nil {
+		return x.Force
+	}
+	return false
+}
+
+// Peer is an indexed peer.
+type Peer struct {
+	state    protoimpl.MessageState `protogen:"open.v1"`
+	Id       string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	Profile  *structpb.Struct       `protobuf:"bytes,2,opt,name=profile,proto3" json:"profile,omitempty"`
+	LastPing int64                  `protobuf:"varint,3,opt,name=last_ping,json=lastPing,proto3" json:"last_ping,omitempty"`
+	// Fields are the indexed custom fields of the profile.
+	Fields        *structpb.Struct `protobuf:"bytes,4,opt,name=fields,proto3" json:"fields,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Peer) Reset() {
+	*x = Peer{}
+	mi := &file_services_proto_msgTypes[5]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Peer) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Peer) ProtoMessage() {}
+
+func (x *Peer) ProtoReflect() protoreflect.Message {
+	mi := &file_services_proto_msgTypes[5]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Peer.ProtoReflect.Descriptor instead.
+func (*Peer) Descriptor() ([]byte, []int) {
+	return file_services_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *Peer) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+func (x *Peer) GetProfile() *structpb.Struct {
+	if x != nil {
+		return x.Profile
+	}
+	return nil
+}
+
+func (x *Peer) GetLastPing() int64 {
+	if x != nil {
+		return x.LastPing
+	}
+	return 0
+}
+
+func (x *Peer) GetFields() *structpb.Struct {
+	if x != nil {
+		return x.Fields
+	}
+	return nil
+}
+
+// PublishRequest publishes the rating in contract, type is "fulfill" or "complete".
+type PublishRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	Type  string                 `protobuf:"bytes,1,opt,name=type,proto3" json:"type,omitempty"`
+	// Contract is the contract of the order as the OpenBazaar node returns it.
+	Contract      *structpb.Struct `protobuf:"bytes,2,opt,name=contract,proto3" json:"contract,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *PublishRequest) Reset() {
+	*x = PublishRequest{}
+	mi := &file_services_proto_msgTypes[6]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *PublishRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*PublishRequest) ProtoMessage() {}
+
+func (x *PublishRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_services_proto_msgTypes[6]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use PublishRequest.ProtoReflect.Descriptor instead.
+func (*PublishRequest) Descriptor() ([]byte, []int) {
+	return file_services_proto_rawDescGZIP(), []int{6}
+}
+
+func (x *PublishRequest) GetType() string {
+	if x != nil {
+		return x.Type
+	}
+	return ""
+}
+
+func (x *PublishRequest) GetContract() *structpb.Struct {
+	if x != nil {
+		return x.Contract
+	}
+	return nil
+}
+
+// PublishResult is the stored rating, broadcast_error is set when it couldn't be sent to the network.
+type PublishResult struct {
+	state          protoimpl.MessageState `protogen:"open.v1"`
+	Rating         *Rating                `protobuf:"bytes,1,opt,name=rating,proto3" json:"rating,omitempty"`
+	BroadcastError string                 `protobuf:"bytes,2,opt,name=broadcast_error,json=broadcastError,proto3" json:"broadcast_error,omitempty"`
+	unknownFields  protoimpl.UnknownFields
+	sizeCache      protoimpl.SizeCache
+}
+
+func (x *PublishResult) Reset() {
+	*x = PublishResult{}
+	mi := &file_services_proto_msgTypes[7]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *PublishResult) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*PublishResult) ProtoMessage() {}
+
+func (x *PublishResult) ProtoReflect() protoreflect.Message {
+	mi := &file_services_proto_msgTypes[7]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use PublishResult.ProtoReflect.Descriptor instead.
+func (*PublishResult) Descriptor() ([]byte, []int) {
+	return file_services_proto_rawDescGZIP(), []int{7}
+}
+
+func (x *PublishResult) GetRating() *Rating {
+	if x != nil {
+		return x.Rating
+	}
+	return nil
+}
+
+func (x *PublishResult) GetBroadcastError() string {
+	if x != nil {
+		return x.BroadcastError
+	}
+	return ""
+}
+
+// SeekRequest asks the network for the ratings of ids, a peer ID or a "peerID@slug".
+type SeekRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Ids           string                 `protobuf:"bytes,1,opt,name=ids,proto3" json:"ids,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *SeekRequest) Reset() {
+	*x = SeekRequest{}
+	mi := &file_services_proto_msgTypes[8]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SeekRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SeekRequest) ProtoMessage() {}
+
+func (x *SeekRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_services_proto_msgTypes[8]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SeekRequest.ProtoReflect.Descriptor instead.
+func (*SeekRequest) Descriptor() ([]byte, []int) {
+	return file_services_proto_rawDescGZIP(), []int{8}
+}
+
+func (x *SeekRequest) GetIds() string {
+	if x != nil {
+		return x.Ids
+	}
+	return ""
+}
+
+// Rating is a signed rating given by source to destination.
+type Rating struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Type          string                 `protobuf:"bytes,1,opt,name=type,proto3" json:"type,omitempty"`
+	Source        string                 `protobuf:"bytes,2,opt,name=source,proto3" json:"source,omitempty"`
+	SourcePk      *Pubkeys               `protobuf:"bytes,3,opt,name=source_pk,json=sourcePk,proto3" json:"source_pk,omitempty"`
+	Destination   string                 `protobuf:"bytes,4,opt,name=destination,proto3" json:"destination,omitempty"`
+	DestinationPk *Pubkeys               `protobuf:"bytes,5,opt,name=destination_pk,json=destinationPk,proto3" json:"destination_pk,omitempty"`
+	Signatures    []*Signature           `protobuf:"bytes,6,rep,name=signatures,proto3" json:"signatures,omitempty"`
+	Content       *structpb.Value        `protobuf:"bytes,7,opt,name=content,proto3" json:"content,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Rating) Reset() {
+	*x = Rating{}
+	mi := &file_services_proto_msgTypes[9]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Rating) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Rating) ProtoMessage() {}
+
+func (x *Rating) ProtoReflect() protoreflect.Message {
+	mi := &file_services_proto_msgTypes[9]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Rating.ProtoReflect.Descriptor instead.
+func (*Rating) Descriptor() ([]byte, []int) {
+	return file_services_proto_rawDescGZIP(), []int{9}
+}
+
+func (x *Rating) GetType() string {
+	if x != nil {
+		return x.Type
+	}
+	return ""
+}
+
+func (x *Rating) GetSource() string {
+	if x != nil {
+		return x.Source
+	}
+	return ""
+}
+
+func (x *Rating) GetSourcePk() *Pubkeys {
+	if x != nil {
+		return x.SourcePk
+	}
+	return nil
+}
+
+func (x *Rating) GetDestination() string {
+	if x != nil {
+		return x.Destination
+	}
+	return ""
+}
+
+func (x *Rating) GetDestinationPk() *Pubkeys {
+	if x != nil {
+		return x.DestinationPk
+	}
+	return nil
+}
+
+func (x *Rating) GetSignatures() []*Signature {
+	if x != nil {
+		return x.Signatures
+	}
+	return nil
+}
+
+func (x *Rating) GetContent() *structpb.Value {
+	if x != nil {
+		return x.Content
+	}
+	return nil
+}
+
+type Pubkeys struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Identity      string                 `protobuf:"bytes,1,opt,name=identity,proto3" json:"identity,omitempty"`
+	Bitcoin       string                 `protobuf:"bytes,2,opt,name=bitcoin,proto3" json:"bitcoin,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Pubkeys) Reset() {
+	*x = Pubkeys{}
+	mi := &file_services_proto_msgTypes[10]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Pubkeys) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Pubkeys) ProtoMessage() {}
+
+func (x *Pubkeys) ProtoReflect() protoreflect.Message {
+	mi := &file_services_proto_msgTypes[10]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Pubkeys.ProtoReflect.Descriptor instead.
+func (*Pubkeys) Descriptor() ([]byte, []int) {
+	return file_services_proto_rawDescGZIP(), []int{10}
+}
+
+func (x *Pubkeys) GetIdentity() string {
+	if x != nil {
+		return x.Identity
+	}
+	return ""
+}
+
+func (x *Pubkeys) GetBitcoin() string {
+	if x != nil {
+		return x.Bitcoin
+	}
+	return ""
+}
+
+type Signature struct {
+	state          protoimpl.MessageState `protogen:"open.v1"`
+	Section        string                 `protobuf:"bytes,1,opt,name=section,proto3" json:"section,omitempty"`
+	SignatureBytes string                 `protobuf:"bytes,2,opt,name=signature_bytes,json=signatureBytes,proto3" json:"signature_bytes,omitempty"`
+	unknownFields  protoimpl.UnknownFields
+	sizeCache      protoimpl.SizeCache
+}
+
+func (x *Signature) Reset() {
+	*x = Signature{}
+	mi := &file_services_proto_msgTypes[11]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Signature) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Signature) ProtoMessage() {}
+
+func (x *Signature) ProtoReflect() protoreflect.Message {
+	mi := &file_services_proto_msgTypes[11]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Signature.ProtoReflect.Descriptor instead.
+func (*Signature) Descriptor() ([]byte, []int) {
+	return file_services_proto_rawDescGZIP(), []int{11}
+}
+
+func (x *Signature) GetSection() string {
+	if x != nil {
+		return x.Section
+	}
+	return ""
+}
+
+func (x *Signature) GetSignatureBytes() string {
+	if x != nil {
+		return x.SignatureBytes
+	}
+	return ""
+}
+
+var File_services_proto protoreflect.FileDescriptor
+
+const file_services_proto_rawDesc = "" +
+	"\n" +
+	"\x0eservices.proto\x12\akimitzu\x1a\x1cgoogle/protobuf/struct.proto\"\xce\x05\n" +
+	"\rSearchRequest\x12\x14\n" +
+	"\x05query\x18\x01 \x01(\tR\x05query\x12\x18\n" +
+	"\afilters\x18\x02 \x03(\tR\afilters\x12\x14\n" +
+	"\x05limit\x18\x03 \x01(\x05R\x05limit\x12\x14\n" +
+	"\x05start\x18\x04 \x01(\x05R\x05start\x126\n" +
+	"\n" +
+	"transforms\x18\x05 \x03(\v2\x16.google.protobuf.ValueR\n" +
+	"transforms\x12\x12\n" +
+	"\x04sort\x18\x06 \x01(\tR\x04sort\x12\x1a\n" +
+	"\bgenerous\x18\a \x01(\bR\bgenerous\x12\x14\n" +
+	"\x05fuzzy\x18\b \x01(\bR\x05fuzzy\x12!\n" +
+	"\x04near\x18\t \x01(\v2\r.kimitzu.NearR\x04near\x12\x14\n" +
+	"\x05order\x18\n" +
+	" \x01(\tR\x05order\x12-\n" +
+	"\x05where\x18\v \x01(\v2\x17.google.protobuf.StructR\x05where\x12\x1a\n" +
+	"\bcurrency\x18\f \x01(\tR\bcurrency\x12 \n" +
+	"\tmin_price\x18\r \x01(\x01H\x00R\bminPrice\x88\x01\x01\x12 \n" +
+	"\tmax_price\x18\x0e \x01(\x01H\x01R\bmaxPrice\x88\x01\x01\x12\x1a\n" +
+	"\bcategory\x18\x0f \x01(\tR\bcategory\x12\x1f\n" +
+	"\vrate_method\x18\x10 \x01(\tR\n" +
+	"rateMethod\x12\x14\n" +
+	"\x05hours\x18\x11 \x01(\x01R\x05hours\x12\x14\n" +
+	"\x05units\x18\x12 \x01(\x01R\x05units\x12\x16\n" +
+	"\x06expand\x18\x13 \x03(\tR\x06expand\x12+\n" +
+	"\x11vendor_projection\x18\x14 \x03(\tR\x10vendorProjection\x12\x1f\n" +
+	"\vonline_only\x18\x15 \x01(\bR\n" +
+	"onlineOnly\x12\x18\n" +
+	"\aexplain\x18\x16 \x01(\bR\aexplain\x12\x16\n" +
+	"\x06cursor\x18\x17 \x01(\tR\x06cursorB\f\n" +
+	"\n" +
+	"_min_priceB\f\n" +
+	"\n" +
+	"_max_price\"O\n" +
+	"\x04Near\x12\x10\n" +
+	"\x03lat\x18\x01 \x01(\x01R\x03lat\x12\x10\n" +
+	"\x03lng\x18\x02 \x01(\x01R\x03lng\x12#\n" +
+	"\rradius_meters\x18\x03 \x01(\x01R\fradiusMeters\"\x95\x02\n" +
+	"\fSearchResult\x12\x14\n" +
+	"\x05count\x18\x01 \x01(\x05R\x05count\x12\x14\n" +
+	"\x05limit\x18\x02 \x01(\x05R\x05limit\x12\x1d\n" +
+	"\n" +
+	"next_start\x18\x03 \x01(\x05R\tnextStart\x12\x1f\n" +
+	"\vnext_cursor\x18\x04 \x01(\tR\n" +
+	"nextCursor\x12+\n" +
+	"\x04data\x18\x05 \x03(\v2\x17.google.protobuf.StructR\x04data\x129\n" +
+	"\rfilter_errors\x18\x06 \x03(\v2\x14.kimitzu.FilterErrorR\ffilterErrors\x121\n" +
+	"\aexplain\x18\a \x01(\v2\x17.google.protobuf.StructR\aexplain\"?\n" +
+	"\vFilterError\x12\x16\n" +
+	"\x06filter\x18\x01 \x01(\tR\x06filter\x12\x18\n" +
+	"\amessage\x18\x02 \x01(\tR\amessage\"3\n" +
+	"\vPeerRequest\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\x12\x14\n" +
+	"\x05force\x18\x02 \x01(\bR\x05force\"\x97\x01\n" +
+	"\x04Peer\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\x121\n" +
+	"\aprofile\x18\x02 \x01(\v2\x17.google.protobuf.StructR\aprofile\x12\x1b\n" +
+	"\tlast_ping\x18\x03 \x01(\x03R\blastPing\x12/\n" +
+	"\x06fields\x18\x04 \x01(\v2\x17.google.protobuf.StructR\x06fields\"Y\n" +
+	"\x0ePublishRequest\x12\x12\n" +
+	"\x04type\x18\x01 \x01(\tR\x04type\x123\n" +
+	"\bcontract\x18\x02 \x01(\v2\x17.google.protobuf.StructR\bcontract\"a\n" +
+	"\rPublishResult\x12'\n" +
+	"\x06rating\x18\x01 \x01(\v2\x0f.kimitzu.RatingR\x06rating\x12'\n" +
+	"\x0fbroadcast_error\x18\x02 \x01(\tR\x0ebroadcastError\"\x1f\n" +
+	"\vSeekRequest\x12\x10\n" +
+	"\x03ids\x18\x01 \x01(\tR\x03ids\"\xa4\x02\n" +
+	"\x06Rating\x12\x12\n" +
+	"\x04type\x18\x01 \x01(\tR\x04type\x12\x16\n" +
+	"\x06source\x18\x02 \x01(\tR\x06source\x12-\n" +
+	"\tsource_pk\x18\x03 \x01(\v2\x10.kimitzu.PubkeysR\bsourcePk\x12 \n" +
+	"\vdestination\x18\x04 \x01(\tR\vdestination\x127\n" +
+	"\x0edestination_pk\x18\x05 \x01(\v2\x10.kimitzu.PubkeysR\rdestinationPk\x122\n" +
+	"\n" +
+	"signatures\x18\x06 \x03(\v2\x12.kimitzu.SignatureR\n" +
+	"signatures\x120\n" +
+	"\acontent\x18\a \x01(\v2\x16.google.protobuf.ValueR\acontent\"?\n" +
+	"\aPubkeys\x12\x1a\n" +
+	"\bidentity\x18\x01 \x01(\tR\bidentity\x12\x18\n" +
+	"\abitcoin\x18\x02 \x01(\tR\abitcoin\"N\n" +
+	"\tSignature\x12\x18\n" +
+	"\asection\x18\x01 \x01(\tR\asection\x12'\n" +
+	"\x0fsignature_bytes\x18\x02 \x01(\tR\x0esignatureBytes2\xe3\x02\n" +
+	"\bServices\x12?\n" +
+	"\x0eSearchListings\x12\x16.kimitzu.SearchRequest\x1a\x15.kimitzu.SearchResult\x12<\n" +
+	"\vSearchPeers\x12\x16.kimitzu.SearchRequest\x1a\x15.kimitzu.SearchResult\x12.\n" +
+	"\aGetPeer\x12\x14.kimitzu.PeerRequest\x1a\r.kimitzu.Peer\x12.\n" +
+	"\aAddPeer\x12\x14.kimitzu.PeerRequest\x1a\r.kimitzu.Peer\x12@\n" +
+	"\rPublishRating\x12\x17.kimitzu.PublishRequest\x1a\x16.kimitzu.PublishResult\x126\n" +
+	"\vSeekRatings\x12\x14.kimitzu.SeekRequest\x1a\x0f.kimitzu.Rating0\x01B)Z'github.com/kimitzu/kimitzu-services/rpcb\x06proto3"
+
+var (
+	file_services_proto_rawDescOnce sync.Once
+	file_services_proto_rawDescData []byte
+)
+
+func file_services_proto_rawDescGZIP() []byte {
+	file_services_proto_rawDescOnce.Do(func() {
+		file_services_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_services_proto_rawDesc), len(file_services_proto_rawDesc)))
+	})
+	return file_services_proto_rawDescData
+}
+
+var file_services_proto_msgTypes = make([]protoimpl.MessageInfo, 12)
+var file_services_proto_goTypes = []any{
+	(*SearchRequest)(nil),   // 0: kimitzu.SearchRequest
+	(*Near)(nil),            // 1: kimitzu.Near
+	(*SearchResult)(nil),    // 2: kimitzu.SearchResult
+	(*FilterError)(nil),     // 3: kimitzu.FilterError
+	(*PeerRequest)(nil),     // 4: kimitzu.PeerRequest
+	(*Peer)(nil),            // 5: kimitzu.Peer
+	(*PublishRequest)(nil),  // 6: kimitzu.PublishRequest
+	(*PublishResult)(nil),   // 7: kimitzu.PublishResult
+	(*SeekRequest)(nil),     // 8: kimitzu.SeekRequest
+	(*Rating)(nil),          // 9: kimitzu.Rating
+	(*Pubkeys)(nil),         // 10: kimitzu.Pubkeys
+	(*Signature)(nil),       // 11: kimitzu.Signature
+	(*structpb.Value)(nil),  // 12: google.protobuf.Value
+	(*structpb.Struct)(nil), // 13: google.protobuf.Struct
+}
+var file_services_proto_depIdxs = []int32{
+	12, // 0: kimitzu.SearchRequest.transforms:type_name -> google.protobuf.Value
+	1,  // 1: kimitzu.SearchRequest.near:type_name -> kimitzu.Near
+	13, // 2: kimitzu.SearchRequest.where:type_name -> google.protobuf.Struct
+	13, // 3: kimitzu.SearchResult.data:type_name -> google.protobuf.Struct
+	3,  // 4: kimitzu.SearchResult.filter_errors:type_name -> kimitzu.FilterError
+	13, // 5: kimitzu.SearchResult.explain:type_name -> google.protobuf.Struct
+	13, // 6: kimitzu.Peer.profile:type_name -> google.protobuf.Struct
+	13, // 7: kimitzu.Peer.fields:type_name -> google.protobuf.Struct
+	13, // 8: kimitzu.PublishRequest.contract:type_name -> google.protobuf.Struct
+	9,  // 9: kimitzu.PublishResult.rating:type_name -> kimitzu.Rating
+	10, // 10: kimitzu.Rating.source_pk:type_name -> kimitzu.Pubkeys
+	10, // 11: kimitzu.Rating.destination_pk:type_name -> kimitzu.Pubkeys
+	11, // 12: kimitzu.Rating.signatures:type_name -> kimitzu.Signature
+	12, // 13: kimitzu.Rating.content:type_name -> google.protobuf.Value
+	0,  // 14: kimitzu.Services.SearchListings:input_type -> kimitzu.SearchRequest
+	0,  // 15: kimitzu.Services.SearchPeers:input_type -> kimitzu.SearchRequest
+	4,  // 16: kimitzu.Services.GetPeer:input_type -> kimitzu.PeerRequest
+	4,  // 17: kimitzu.Services.AddPeer:input_type -> kimitzu.PeerRequest
+	6,  // 18: kimitzu.Services.PublishRating:input_type -> kimitzu.PublishRequest
+	8,  // 19: kimitzu.Services.SeekRatings:input_type -> kimitzu.SeekRequest
+	2,  // 20: kimitzu.Services.SearchListings:output_type -> kimitzu.SearchResult
+	2,  // 21: kimitzu.Services.SearchPeers:output_type -> kimitzu.SearchResult
+	5,  // 22: kimitzu.Services.GetPeer:output_type -> kimitzu.Peer
+	5,  // 23: kimitzu.Services.AddPeer:output_type -> kimitzu.Peer
+	7,  // 24: kimitzu.Services.PublishRating:output_type -> kimitzu.PublishResult
+	9,  // 25: kimitzu.Services.SeekRatings:output_type -> kimitzu.Rating
+	20, // [20:26] is the sub-list for method output_type
+	14, // [14:20] is the sub-list for method input_type
+	14, // [14:14] is the sub-list for extension type_name
+	14, // [14:14] is the sub-list for extension extendee
+	0,  // [0:14] is the sub-list for field type_name
+}
+
+func init() { file_services_proto_init() }
+func file_services_proto_init() {
+	if File_services_proto != nil {
+		return
+	}
+	file_services_proto_msgTypes[0].OneofWrappers = []any{}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_services_proto_rawDesc), len(file_services_proto_rawDesc)),
+			NumEnums:      0,
+			NumMessages:   12,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_services_proto_goTypes,
+		DependencyIndexes: file_services_proto_depIdxs,
+		MessageInfos:      file_services_proto_msgTypes,
+	}.Build()
+	File_services_proto = out.File
+	file_services_proto_goTypes = nil
+	file_services_proto_depIdxs = nil
+}
@@ -0,0 +1,333 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.5.1
+// - protoc             (unknown)
+// source: services.proto
+
+package rpc
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.64.0 or later.
+const _ = grpc.SupportPackageIsVersion9
+
+const (
+	Services_SearchListings_FullMethodName = "/kimitzu.Services/SearchListings"
+	Services_SearchPeers_FullMethodName    = "/kimitzu.Services/SearchPeers"
+	Services_GetPeer_FullMethodName        = "/kimitzu.Services/GetPeer"
+	Services_AddPeer_FullMethodName        = "/kimitzu.Services/AddPeer"
+	Services_PublishRating_FullMethodName  = "/kimitzu.Services/PublishRating"
+	Services_SeekRatings_FullMethodName    = "/kimitzu.Services/SeekRatings"
+)
+
+// ServicesClient is the client API for Services service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+//
+// Services searches the listings and peers indexed by the daemon, and publishes and
+// seeks ratings on the p2p network.
+type ServicesClient interface {
+	// SearchListings searches the listings like /kimitzu/search.
+	SearchListings(ctx context.Context, in *SearchRequest, opts ...grpc.CallOption) (*SearchResult, error)
+	// SearchPeers searches the peers like /kimitzu/peer/search.
+	SearchPeers(ctx context.Context, in *SearchRequest, opts ...grpc.CallOption) (*SearchResult, error)
+	// GetPeer returns an indexed peer, crawling it first if it isn't indexed yet.
+	GetPeer(ctx context.Context, in *PeerRequest, opts ...grpc.CallOption) (*Peer, error)
+	// AddPeer crawls a peer and indexes it with its listings.
+	AddPeer(ctx context.Context, in *PeerRequest, opts ...grpc.CallOption) (*Peer, error)
+	// PublishRating stores the rating of a contract and broadcasts it to the network.
+	PublishRating(ctx context.Context, in *PublishRequest, opts ...grpc.CallOption) (*PublishResult, error)
+	// SeekRatings streams the ratings the peers of the network hold, until every peer answered.
+	SeekRatings(ctx context.Context, in *SeekRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[Rating], error)
+}
+
+type servicesClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewServicesClient(cc grpc.ClientConnInterface) ServicesClient {
+	return &servicesClient{cc}
+}
+
+func (c *servicesClient) SearchListings(ctx context.Context, in *SearchRequest, opts ...grpc.CallOption) (*SearchResult, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(SearchResult)
+	err := c.cc.Invoke(ctx, Services_SearchListings_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *servicesClient) SearchPeers(ctx context.Context, in *SearchRequest, opts ...grpc.CallOption) (*SearchResult, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(SearchResult)
+	err := c.cc.Invoke(ctx, Services_SearchPeers_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *servicesClient) GetPeer(ctx context.Context, in *PeerRequest, opts ...grpc.CallOption) (*Peer, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Peer)
+	err := c.cc.Invoke(ctx, Services_GetPeer_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *servicesClient) AddPeer(ctx context.Context, in *PeerRequest, opts ...grpc.CallOption) (*Peer, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Peer)
+	err := c.cc.Invoke(ctx, Services_AddPeer_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *servicesClient) PublishRating(ctx context.Context, in *PublishRequest, opts ...grpc.CallOption) (*PublishResult, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(PublishResult)
+	err := c.cc.Invoke(ctx, Services_PublishRating_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *servicesClient) SeekRatings(ctx context.Context, in *SeekRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[Rating], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &Services_ServiceDesc.Streams[0], Services_SeekRatings_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[SeekRequest, Rating]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Services_SeekRatingsClient = grpc.ServerStreamingClient[Rating]
+
+// ServicesServer is the server API for Services service.
+// All implementations must embed UnimplementedServicesServer
+// for forward compatibility.
+//
+// Services searches the listings and peers indexed by the daemon, and publishes and
+// seeks ratings on the p2p network.
+type ServicesServer interface {
+	// SearchListings searches the listings like /kimitzu/search.
+	SearchListings(context.Context, *SearchRequest) (*SearchResult, error)
+	// SearchPeers searches the peers like /kimitzu/peer/search.
+	SearchPeers(context.Context, *SearchRequest) (*SearchResult, error)
+	// GetPeer returns an indexed peer, crawling it first if it isn't indexed yet.
+	GetPeer(context.Context, *PeerRequest) (*Peer, error)
+	// AddPeer crawls a peer and indexes it with its listings.
+	AddPeer(context.Context, *PeerRequest) (*Peer, error)
+	// PublishRating stores the rating of a contract and broadcasts it to the network.
+	PublishRating(context.Context, *PublishRequest) (*PublishResult, error)
+	// SeekRatings streams the ratings the peers of the network hold, until every peer answered.
+	SeekRatings(*SeekRequest, grpc.ServerStreamingServer[Rating]) error
+	mustEmbedUnimplementedServicesServer()
+}
+
+// UnimplementedServicesServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedServicesServer struct{}
+
+func (UnimplementedServicesServer) SearchListings(context.Context, *SearchRequest) (*SearchResult, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method SearchListings not implemented")
+}
+func (UnimplementedServicesServer) SearchPeers(context.Context, *SearchRequest) (*SearchResult, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method SearchPeers not implemented")
+}
+func (UnimplementedServicesServer) GetPeer(context.Context, *PeerRequest) (*Peer, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetPeer not implemented")
+}
+func (UnimplementedServicesServer) AddPeer(context.Context, *PeerRequest) (*Peer, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method AddPeer not implemented")
+}
+func (UnimplementedServicesServer) PublishRating(context.Context, *PublishRequest) (*PublishResult, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method PublishRating not implemented")
+}
+func (UnimplementedServicesServer) SeekRatings(*SeekRequest, grpc.ServerStreamingServer[Rating]) error {
+	return status.Errorf(codes.Unimplemented, "method SeekRatings not implemented")
+}
+func (UnimplementedServicesServer) mustEmbedUnimplementedServicesServer() {}
+func (UnimplementedServicesServer) testEmbeddedByValue()                  {}
+
+// UnsafeServicesServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to ServicesServer will
+// result in compilation errors.
+type UnsafeServicesServer interface {
+	mustEmbedUnimplementedServicesServer()
+}
+
+func RegisterServicesServer(s grpc.ServiceRegistrar, srv ServicesServer) {
+	// If the following call pancis, it indicates UnimplementedServicesServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&Services_ServiceDesc, srv)
+}
+
+func _Services_SearchListings_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SearchRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ServicesServer).SearchListings(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Services_SearchListings_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ServicesServer).SearchListings(ctx, req.(*SearchRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Services_SearchPeers_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SearchRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ServicesServer).SearchPeers(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Services_SearchPeers_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ServicesServer).SearchPeers(ctx, req.(*SearchRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Services_GetPeer_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(PeerRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ServicesServer).GetPeer(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Services_GetPeer_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ServicesServer).GetPeer(ctx, req.(*PeerRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Services_AddPeer_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(PeerRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ServicesServer).AddPeer(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Services_AddPeer_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ServicesServer).AddPeer(ctx, req.(*PeerRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Services_PublishRating_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(PublishRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ServicesServer).PublishRating(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Services_PublishRating_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ServicesServer).PublishRating(ctx, req.(*PublishRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Services_SeekRatings_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(SeekRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(ServicesServer).SeekRatings(m, &grpc.GenericServerStream[SeekRequest, Rating]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Services_SeekRatingsServer = grpc.ServerStreamingServer[Rating]
+
+// Services_ServiceDesc is the grpc.ServiceDesc for Services service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var Services_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "kimitzu.Services",
+	HandlerType: (*ServicesServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "SearchListings",
+			Handler:    _Services_SearchListings_Handler,
+		},
+		{
+			MethodName: "SearchPeers",
+			Handler:    _Services_SearchPeers_Handler,
+		},
+		{
+			MethodName: "GetPeer",
+			Handler:    _Services_GetPeer_Handler,
+		},
+		{
+			MethodName: "AddPeer",
+			Handler:    _Services_AddPeer_Handler,
+		},
+		{
+			MethodName: "PublishRating",
+			Handler:    _Services_PublishRating_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "SeekRatings",
+			Handler:       _Services_SeekRatings_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "services.proto",
+}
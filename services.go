@@ -1,11 +1,14 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"log"
-	"net/http"
+	"os"
+	"os/signal"
 	"path"
+	"syscall"
 	"time"
 
 	"github.com/gorilla/mux"
@@ -15,13 +18,22 @@ import (
 
 	"github.com/kimitzu/kimitzu-services/api"
 	"github.com/kimitzu/kimitzu-services/configs"
+	"github.com/kimitzu/kimitzu-services/cors"
+	"github.com/kimitzu/kimitzu-services/health"
+	"github.com/kimitzu/kimitzu-services/lifecycle"
 	"github.com/kimitzu/kimitzu-services/p2p"
+	"github.com/kimitzu/kimitzu-services/rest"
 
 	"github.com/kimitzu/kimitzu-services/location"
 	"github.com/kimitzu/kimitzu-services/servicestore"
+	"github.com/kimitzu/kimitzu-services/taxonomy"
+	"github.com/kimitzu/kimitzu-services/tokens"
 	"github.com/kimitzu/kimitzu-services/voyager"
 )
 
+// shutdownTimeout is how long the services get to stop, in flight requests included.
+const shutdownTimeout = time.Second * 30
+
 var (
 	logger     = roggy.Printer("services")
 	confSat    = config.Satellite{}
@@ -38,13 +50,24 @@ func init() {
 
 	flag.StringVar(&confDaemon.DialTo, "dial", "", "Bootstrap s/kad from this peer")
 	flag.StringVar(&confDaemon.BootstrapNodeIdentity, "bootstrapNodeIdentity", "", "The identity (host:port) of this bootstrap node")
-	flag.StringVar(&confDaemon.ApiListen, "api", "0.0.0.0:8109", "Enable the api and serve to this address")
+	flag.StringVar(&confDaemon.ApiListen, "api", api.DefaultListen, "Enable the api and serve to this address, empty to only serve on -api-socket")
+	flag.StringVar(&confDaemon.ApiSocket, "api-socket", "", "Serve the api on this Unix domain socket as well")
+	flag.StringVar(&confDaemon.TLSCert, "tls-cert", "", "Serve the api over TLS with this certificate")
+	flag.StringVar(&confDaemon.TLSKey, "tls-key", "", "Private key of -tls-cert")
+	flag.StringVar(&confDaemon.CORSProfile, "cors-profile", "electron", "Web origins allowed to call the api by default, electron or browser")
+	flag.StringVar(&confDaemon.CORSOrigins, "cors-origins", "", "Comma separated web origins allowed to call the api on top of -cors-profile, * allows any origin without credentials")
+	flag.BoolVar(&confDaemon.TLSSelfSigned, "tls-self-signed", false, "Serve the api over TLS with a self-signed certificate kept in the data folder")
 	flag.StringVar(&confDaemon.DatabasePath, "dbpath", "&home", "Database Path")
 	flag.StringVar(&confDaemon.KeyPath, "key", "&home", "Read/write key from/to path")
 	flag.BoolVar(&confDaemon.GenerateNewKeys, "generate", true, "Generate new keys")
 	flag.BoolVar(&confDaemon.ShowHelp, "h", false, "Show help")
 	flag.IntVar(&roggy.LogLevel, "log", 2, "log level 0~5")
 	flag.BoolVar(&confDaemon.Testnet, "testnet", false, "Launch network on the testnet")
+	flag.StringVar(&confDaemon.ImportLocations, "import-locations", "", "Import a GeoNames postal code dump (TSV) into the location dataset and exit")
+	flag.StringVar(&confDaemon.ImportCountry, "import-country", "", "Only import the rows of this country code with -import-locations")
+	flag.StringVar(&confDaemon.RatesFile, "rates-file", "", "Read exchange rates from this JSON file instead of the OpenBazaar node")
+	flag.StringVar(&confDaemon.GRPCListen, "grpc", "", "Serve the gRPC api to this address as well, uses the TLS settings of -api")
+	flag.BoolVar(&confDaemon.PrivateAPI, "private-api", false, "Require credentials or a read token on the read only routes as well")
 
 	flag.Parse()
 
@@ -76,9 +99,6 @@ func main() {
 	log.SetFlags(0) // Disables internal logging
 	log := logger
 
-	// Deadlock prevention
-	time.Sleep(time.Second * 1)
-
 	log.Info(fmt.Sprintf("Kimitzu Services Daemon (%v)", confDaemon.Version))
 	log.Info(" --- --- --- --- --- ")
 	log.Infof("Log Level: %v", roggy.LogLevel)
@@ -90,8 +110,33 @@ func main() {
 		log.Info("Network: Mainnet...")
 	}
 
+	if confDaemon.ImportLocations != "" {
+		info, err := location.ImportGeoNamesFile(confDaemon.DataPath, confDaemon.ImportLocations, confDaemon.ImportCountry)
+		if err != nil {
+			log.Errorf("Failed to import locations: %v", err)
+			roggy.Wait()
+			os.Exit(1)
+		}
+		log.Infof("Imported location dataset version %v, %v locations in %v countries", info.Version, info.Entries, len(info.Countries))
+		roggy.Wait()
+		return
+	}
+
 	store := servicestore.InitializeManagedStorage(confDaemon.DataPath)
-	p2pKillSig := make(chan int, 1)
+	// Listings located by zip code only resolve against the new dataset after an import
+	location.OnImport(func(location.DatasetInfo) {
+		store.MarkChanged()
+	})
+	if confDaemon.RatesFile != "" {
+		store.Rates = servicestore.NewExchangeRates(&servicestore.FileRateProvider{Path: confDaemon.RatesFile})
+	}
+
+	tokenStore, err := tokens.Open(confDaemon.DataPath)
+	if err != nil {
+		log.Errorf("Failed to load the API tokens: %v", err)
+		roggy.Wait()
+		os.Exit(1)
+	}
 
 	// database initialization
 	ratingManager, err := p2p.InitializeRatingManager(confDaemon.DatabasePath)
@@ -103,18 +148,136 @@ func main() {
 
 	// test(&srvLog, log, store)
 	apiRouter := mux.NewRouter()
+	origins, exists := cors.Origins(confDaemon.CORSProfile, confDaemon.CORSOrigins)
+	if !exists {
+		log.Errorf("Unknown CORS profile %v", confDaemon.CORSProfile)
+		roggy.Wait()
+		os.Exit(1)
+	}
+	corsPolicy := &cors.Policy{AllowedOrigins: origins}
+	p2p.OriginPolicy = corsPolicy
 
-	time.Sleep(time.Second * 10)
-	go p2p.Bootstrap(&confDaemon, &confSat, ratingManager, p2pKillSig)
-	go voyager.RunVoyagerService(log.Sub("voyager"), store)
-	location.RunLocationService(log.Sub("location"))
+	authPolicy := api.DefaultAuthPolicy
+	authPolicy.OpenReads = !confDaemon.PrivateAPI
+	apiRouter.Use(api.RequireAuth(authPolicy))
 
-	p2p.AttachAPI(p2p.Sat, apiRouter, ratingManager)
 	api.AttachStore(store)
-	api.AttachAPI(log.Sub("api"), apiRouter)
+	api.AttachTokens(tokenStore)
+	api.AttachRatings(ratingManager)
 
-	log.Infof("Running API on %v", confDaemon.ApiListen)
-	log.Error(http.ListenAndServe(confDaemon.ApiListen, apiRouter))
+	listenConf := api.ListenConfig{
+		Address:    confDaemon.ApiListen,
+		CertFile:   confDaemon.TLSCert,
+		KeyFile:    confDaemon.TLSKey,
+		SelfSigned: confDaemon.TLSSelfSigned,
+		Socket:     confDaemon.ApiSocket,
+		DataPath:   confDaemon.DataPath,
+	}
+	if (listenConf.CertFile == "") != (listenConf.KeyFile == "") {
+		log.Error("Both -tls-cert and -tls-key are needed")
+		roggy.Wait()
+		os.Exit(1)
+	}
+
+	apiServer := &api.Server{
+		Config:  listenConf,
+		Handler: rest.WithRequestID(corsPolicy.Handler(apiRouter)),
+	}
+	if confDaemon.GRPCListen != "" {
+		apiServer.GRPC = api.NewGRPCServer(authPolicy, ratingManager)
+		apiServer.GRPCConfig = listenConf
+		apiServer.GRPCConfig.Address, apiServer.GRPCConfig.Socket = confDaemon.GRPCListen, ""
+	}
 
-	select {}
+	node := &p2p.Node{Daemon: &confDaemon, Satellite: &confSat, Ratings: ratingManager}
+	crawler := voyager.NewCrawler(log.Sub("voyager"), store)
+
+	checks := health.NewChecks()
+	checks.Register(
+		location.HealthCheck(),
+		store.HealthCheck(),
+		api.NodeHealthCheck(),
+		node.HealthCheck(),
+		crawler.HealthCheck(),
+	)
+	api.AttachHealth(checks)
+
+	// Started in this order and stopped in reverse, the crawler stops before
+	// the API drains and the stores are committed and closed last
+	services := lifecycle.NewGroup(log.Sub("lifecycle"))
+	services.Add(
+		&lifecycle.Func{ServiceName: "store", OnStop: func(ctx context.Context) error {
+			return store.Close()
+		}},
+		&lifecycle.Func{ServiceName: "location", OnStart: func(ctx context.Context) error {
+			return location.RunLocationService(log.Sub("location"), confDaemon.DataPath)
+		}},
+		&lifecycle.Func{ServiceName: "taxonomy", OnStart: func(ctx context.Context) error {
+			if err := taxonomy.Load(log.Sub("taxonomy"), confDaemon.DataPath); err != nil {
+				log.Errorf("Failed to load the service taxonomy: %v", err)
+			}
+			return nil
+		}},
+		node,
+		&lifecycle.Func{ServiceName: "routes", OnStart: func(ctx context.Context) error {
+			// The p2p routes use the satellite built by the p2p service
+			p2p.AttachAPI(p2p.Sat, apiRouter, ratingManager)
+			api.AttachAPI(log.Sub("api"), apiRouter)
+			return nil
+		}},
+		apiServer,
+		crawler,
+	)
+
+	signals := make(chan os.Signal, 2)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+
+	if err := services.Start(context.Background()); err != nil {
+		log.Error(err)
+		roggy.Wait()
+		os.Exit(1)
+	}
+
+	if listenConf.Address != "" {
+		scheme := "http"
+		if listenConf.TLS() {
+			scheme = "https"
+		}
+		log.Infof("Running API on %v://%v", scheme, listenConf.Address)
+		if !api.IsLoopback(listenConf.Address) {
+			log.Info("The API is reachable from other machines")
+		}
+	}
+	if listenConf.Socket != "" {
+		log.Infof("Running API on unix://%v", listenConf.Socket)
+	}
+	if apiServer.GRPC != nil {
+		log.Infof("Running gRPC API on %v", apiServer.GRPCConfig.Address)
+	}
+
+	exitCode := 0
+	select {
+	case sig := <-signals:
+		log.Infof("Received %v, shutting down", sig)
+	case err := <-apiServer.Errors():
+		log.Errorf("The API stopped: %v", err)
+		exitCode = 1
+	}
+
+	// A second signal skips the graceful shutdown
+	go func() {
+		<-signals
+		log.Error("Forced shutdown")
+		roggy.Wait()
+		os.Exit(1)
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := services.Stop(ctx); err != nil {
+		exitCode = 1
+	}
+	log.Info("Stopped")
+	roggy.Wait()
+	os.Exit(exitCode)
 }
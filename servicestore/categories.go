@@ -0,0 +1,73 @@
+package servicestore
+
+import (
+	"sync"
+
+	"github.com/kimitzu/kimitzu-services/models"
+	"github.com/kimitzu/kimitzu-services/taxonomy"
+)
+
+// CategoryIndex counts the listings under each node of the service taxonomy,
+// a listing counts towards its own category and all of the parent ones.
+type CategoryIndex struct {
+	lock         *sync.RWMutex
+	counts       map[string]int
+	unclassified int
+	refresher    *refresher
+}
+
+// NewCategoryIndex returns an empty CategoryIndex, it gets populated on the first Refresh.
+func NewCategoryIndex() *CategoryIndex {
+	return &CategoryIndex{
+		lock:      &sync.RWMutex{},
+		counts:    make(map[string]int),
+		refresher: newRefresher(),
+	}
+}
+
+// Invalidate flags the counts as stale, they get recounted on the next lookup.
+func (c *CategoryIndex) Invalidate() {
+	c.refresher.invalidate()
+}
+
+// Refresh recounts the listings of the store.
+func (c *CategoryIndex) Refresh(m *MainManagedStorage) {
+	t := taxonomy.Current()
+	counts := make(map[string]int)
+	unclassified := 0
+
+	listings := m.Listings.Search("")
+	for _, doc := range listings.Documents {
+		listing := models.ListingClass{}
+		if err := doc.Export(&listing); err != nil {
+			continue
+		}
+		code, known := t.Resolve(listing.Metadata.ServiceClassification)
+		if !known {
+			unclassified++
+			continue
+		}
+		for _, ancestor := range t.Ancestors(code) {
+			counts[ancestor]++
+		}
+	}
+
+	c.lock.Lock()
+	c.counts = counts
+	c.unclassified = unclassified
+	c.lock.Unlock()
+}
+
+// Counts returns the amount of listings per category code, along with the amount of
+// listings whose classification isn't in the taxonomy.
+func (c *CategoryIndex) Counts() (map[string]int, int) {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	return c.counts, c.unclassified
+}
+
+// CategoryCounts returns the up to date listing counts per category.
+func (m *MainManagedStorage) CategoryCounts() (map[string]int, int) {
+	m.Categories.refresher.refresh(func() { m.Categories.Refresh(m) })
+	return m.Categories.Counts()
+}
@@ -0,0 +1,150 @@
+package servicestore
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	gomenasai "github.com/nokusukun/go-menasai/manager"
+)
+
+const (
+	// DefaultSnapshotTTL is how long the results of a query stay around for its cursors.
+	DefaultSnapshotTTL = time.Minute * 5
+
+	maxSnapshots = 256
+)
+
+// snapshot is the sorted and filtered result of a query, pages of it are served
+// from here so they stay consistent while the stores change.
+type snapshot struct {
+	store     string
+	results   gomenasai.SearchResult
+	distances map[string]float64
+	prices    map[string]float64
+	estimates map[string]float64
+	currency  string
+	expires   time.Time
+}
+
+// Cursor points to the next page of a query snapshot, it is handed to the
+// clients as an opaque string.
+type Cursor struct {
+	Snapshot string `json:"s"`
+	Offset   int    `json:"o"`
+	Limit    int    `json:"l"`
+}
+
+// EncodeCursor returns the opaque form of c.
+func EncodeCursor(c Cursor) string {
+	b, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// DecodeCursor parses a cursor returned by EncodeCursor.
+func DecodeCursor(s string) (Cursor, error) {
+	c := Cursor{}
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err == nil {
+		err = json.Unmarshal(b, &c)
+	}
+	if err != nil || c.Snapshot == "" || c.Offset < 0 || c.Limit <= 0 {
+		return c, fmt.Errorf("invalid cursor")
+	}
+	return c, nil
+}
+
+// SnapshotStore keeps the query snapshots until they expire.
+type SnapshotStore struct {
+	TTL time.Duration
+
+	lock      *sync.Mutex
+	snapshots map[string]*snapshot
+}
+
+// NewSnapshotStore returns an empty SnapshotStore.
+func NewSnapshotStore() *SnapshotStore {
+	return &SnapshotStore{
+		TTL:       DefaultSnapshotTTL,
+		lock:      &sync.Mutex{},
+		snapshots: make(map[string]*snapshot),
+	}
+}
+
+// save keeps a copy of the results of q and returns its snapshot ID.
+func (s *SnapshotStore) save(store string, q *QueryResult) string {
+	snap := &snapshot{
+		store:     store,
+		results:   *q.Results,
+		distances: q.Distances,
+		prices:    q.Prices,
+		estimates: q.Estimates,
+		currency:  q.Currency,
+		expires:   time.Now().Add(s.TTL),
+	}
+	snap.results.Documents = append(q.Results.Documents[:0:0], q.Results.Documents...)
+
+	b := make([]byte, 12)
+	_, _ = rand.Read(b)
+	id := hex.EncodeToString(b)
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.expire()
+	if len(s.snapshots) >= maxSnapshots {
+		// Drop the one closest to expiring to make room
+		var oldest string
+		for k, v := range s.snapshots {
+			if oldest == "" || v.expires.Before(s.snapshots[oldest].expires) {
+				oldest = k
+			}
+		}
+		delete(s.snapshots, oldest)
+	}
+	s.snapshots[id] = snap
+	return id
+}
+
+// page returns the documents of a snapshot from offset up to limit of them in a
+// result of their own, along with the total amount of documents in the snapshot.
+func (s *SnapshotStore) page(store string, c Cursor) (*QueryResult, int, error) {
+	s.lock.Lock()
+	snap, exists := s.snapshots[c.Snapshot]
+	if exists && time.Now().After(snap.expires) {
+		delete(s.snapshots, c.Snapshot)
+		exists = false
+	}
+	s.lock.Unlock()
+	if !exists || snap.store != store {
+		return nil, 0, fmt.Errorf("cursor expired")
+	}
+
+	page := snap.results
+	total := len(page.Documents)
+	start, end := c.Offset, c.Offset+c.Limit
+	if start > total {
+		start = total
+	}
+	if end > total {
+		end = total
+	}
+	page.Documents = append(page.Documents[:0:0], page.Documents[start:end]...)
+	page.Count = len(page.Documents)
+
+	// The filters ran along with the first page
+	filters := &FilterStats{Errors: []FilterError{}}
+	return &QueryResult{Results: &page, Filters: filters, Distances: snap.distances, Prices: snap.prices, Estimates: snap.estimates, Currency: snap.currency}, total, nil
+}
+
+func (s *SnapshotStore) expire() {
+	now := time.Now()
+	for k, v := range s.snapshots {
+		if now.After(v.expires) {
+			delete(s.snapshots, k)
+		}
+	}
+}
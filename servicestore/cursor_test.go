@@ -0,0 +1,39 @@
+package servicestore
+
+import (
+	"testing"
+	"time"
+
+	gomenasai "github.com/nokusukun/go-menasai/manager"
+)
+
+func TestCursor(t *testing.T) {
+	c := Cursor{Snapshot: "abc", Offset: 20, Limit: 10}
+	decoded, err := DecodeCursor(EncodeCursor(c))
+	if err != nil || decoded != c {
+		t.Errorf("expected %v, got %v (%v)", c, decoded, err)
+	}
+
+	for _, s := range []string{"", "not a cursor", EncodeCursor(Cursor{Snapshot: "abc"})} {
+		if _, err := DecodeCursor(s); err == nil {
+			t.Errorf("expected %q to be rejected", s)
+		}
+	}
+}
+
+func TestSnapshotExpiry(t *testing.T) {
+	snapshots := NewSnapshotStore()
+	id := snapshots.save(storeListings, &QueryResult{Results: &gomenasai.SearchResult{}})
+
+	if _, _, err := snapshots.page(storeListings, Cursor{id, 0, 10}); err != nil {
+		t.Errorf("unexpected error %v", err)
+	}
+	if _, _, err := snapshots.page(storePeers, Cursor{id, 0, 10}); err == nil {
+		t.Errorf("expected a listing cursor to be rejected for peers")
+	}
+
+	snapshots.snapshots[id].expires = time.Now().Add(-time.Second)
+	if _, _, err := snapshots.page(storeListings, Cursor{id, 0, 10}); err == nil {
+		t.Errorf("expected the cursor to expire")
+	}
+}
@@ -0,0 +1,202 @@
+package servicestore
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/kimitzu/kimitzu-services/models"
+)
+
+const maxFilterDepth = 16
+
+var fieldPath = regexp.MustCompile(`^[A-Za-z0-9_]+(\.[A-Za-z0-9_]+)*$`)
+
+// CompileWhere turns a structured filter into the equivalent gval expression, so it
+// runs through the same checks and functions as the string filters.
+func CompileWhere(node *models.FilterNode) (string, error) {
+	return compileNode(node, 0)
+}
+
+func compileNode(node *models.FilterNode, depth int) (string, error) {
+	if node == nil {
+		return "", fmt.Errorf("empty filter")
+	}
+	if depth > maxFilterDepth {
+		return "", fmt.Errorf("filters can't be nested more than %v levels deep", maxFilterDepth)
+	}
+
+	var clauses []string
+	join := func(nodes []*models.FilterNode, op string) error {
+		if len(nodes) == 0 {
+			return fmt.Errorf("%v needs at least one filter", op)
+		}
+		var parts []string
+		for _, n := range nodes {
+			part, err := compileNode(n, depth+1)
+			if err != nil {
+				return err
+			}
+			parts = append(parts, part)
+		}
+		clauses = append(clauses, "("+strings.Join(parts, map[string]string{"and": " && ", "or": " || "}[op])+")")
+		return nil
+	}
+
+	if node.And != nil {
+		if err := join(node.And, "and"); err != nil {
+			return "", err
+		}
+	}
+	if node.Or != nil {
+		if err := join(node.Or, "or"); err != nil {
+			return "", err
+		}
+	}
+	if node.Not != nil {
+		part, err := compileNode(node.Not, depth+1)
+		if err != nil {
+			return "", err
+		}
+		clauses = append(clauses, "!"+part)
+	}
+
+	if node.In != nil {
+		field, err := compileField(node.In.Field)
+		if err != nil {
+			return "", err
+		}
+		values, err := compileValues(node.In.Values)
+		if err != nil {
+			return "", err
+		}
+		clauses = append(clauses, fmt.Sprintf("anyIn(%v, %v)", field, values))
+	}
+
+	if node.Near != nil {
+		name := node.Near.Field
+		if name == "" {
+			name = "location"
+		}
+		field, err := compileField(name)
+		if err != nil {
+			return "", err
+		}
+		if node.Near.RadiusMeters <= 0 {
+			return "", fmt.Errorf("near needs a radiusMeters")
+		}
+		clauses = append(clauses, fmt.Sprintf("locatedWithin(%v, %v, %v, %v)", field,
+			formatNumber(node.Near.Lat), formatNumber(node.Near.Lng), formatNumber(node.Near.RadiusMeters)))
+	}
+
+	conditions, err := compileConditions(node)
+	if err != nil {
+		return "", err
+	}
+	clauses = append(clauses, conditions...)
+
+	if len(clauses) == 0 {
+		return "", fmt.Errorf("empty filter")
+	}
+	if len(clauses) == 1 {
+		return clauses[0], nil
+	}
+	return "(" + strings.Join(clauses, " && ") + ")", nil
+}
+
+// compileConditions compiles the conditions on node.Field, the field has to exist
+// for any of them to match.
+func compileConditions(node *models.FilterNode) ([]string, error) {
+	var conditions []string
+	field, err := compileField(node.Field)
+	if node.Field == "" {
+		field, err = "", nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	operators := []struct {
+		op    string
+		value interface{}
+	}{
+		{"==", node.Eq}, {"!=", node.Ne}, {"<", node.Lt}, {"<=", node.Lte}, {">", node.Gt}, {">=", node.Gte},
+	}
+	for _, o := range operators {
+		if o.value == nil {
+			continue
+		}
+		value, err := compileValue(o.value)
+		if err != nil {
+			return nil, err
+		}
+		conditions = append(conditions, fmt.Sprintf("%v %v %v", field, o.op, value))
+	}
+
+	matchers := []struct {
+		fn    string
+		value string
+	}{
+		{"contains", node.Contains}, {"like", node.Like}, {"fuzzy", node.Fuzzy},
+	}
+	for _, m := range matchers {
+		if m.value != "" {
+			conditions = append(conditions, fmt.Sprintf("%v(%v, %v)", m.fn, field, strconv.Quote(m.value)))
+		}
+	}
+
+	exists := fmt.Sprintf("exists(doc, %v)", strconv.Quote(node.Field))
+	if node.Exists != nil && !*node.Exists {
+		if len(conditions) != 0 {
+			return nil, fmt.Errorf("%v can't be compared if it must not exist", node.Field)
+		}
+		return []string{"!" + exists}, nil
+	}
+
+	if len(conditions) == 0 && node.Exists == nil {
+		if node.Field != "" {
+			return nil, fmt.Errorf("no condition given for %v", node.Field)
+		}
+		return nil, nil
+	}
+	if field == "" {
+		return nil, fmt.Errorf("conditions need a field")
+	}
+	return append([]string{exists}, conditions...), nil
+}
+
+func compileField(name string) (string, error) {
+	if !fieldPath.MatchString(name) {
+		return "", fmt.Errorf("invalid field %q", name)
+	}
+	return fmt.Sprintf("field(doc, %v)", strconv.Quote(name)), nil
+}
+
+func compileValue(value interface{}) (string, error) {
+	switch v := value.(type) {
+	case string:
+		return strconv.Quote(v), nil
+	case float64:
+		return formatNumber(v), nil
+	case bool:
+		return strconv.FormatBool(v), nil
+	}
+	return "", fmt.Errorf("unsupported value %v, only strings, numbers and booleans can be compared", value)
+}
+
+func compileValues(values []interface{}) (string, error) {
+	var compiled []string
+	for _, value := range values {
+		v, err := compileValue(value)
+		if err != nil {
+			return "", err
+		}
+		compiled = append(compiled, v)
+	}
+	return "[" + strings.Join(compiled, ", ") + "]", nil
+}
+
+func formatNumber(f float64) string {
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
@@ -0,0 +1,63 @@
+package servicestore
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/kimitzu/kimitzu-services/models"
+)
+
+func TestCompileWhere(t *testing.T) {
+	engine := NewFilterEngine(LoadCustomEngine(&MainManagedStorage{}))
+	doc := map[string]interface{}{}
+	_ = json.Unmarshal([]byte(`{
+		"item": {"title": "Golden Comics", "price": 4500},
+		"metadata": {"acceptedCurrencies": ["BTC", "ZEC"]}
+	}`), &doc)
+
+	cases := map[string]bool{
+		`{"field": "item.price", "lte": 5000}`:                                                            true,
+		`{"field": "item.price", "gt": 5000}`:                                                             false,
+		`{"field": "item.missing", "eq": 1}`:                                                              false,
+		`{"field": "item.missing", "exists": false}`:                                                      true,
+		`{"not": {"field": "item.title", "contains": "Golden"}}`:                                          false,
+		`{"in": {"field": "metadata.acceptedCurrencies", "values": ["BTC"]}}`:                             true,
+		`{"in": {"field": "metadata.acceptedCurrencies", "values": ["LTC"]}}`:                             false,
+		`{"or": [{"field": "item.price", "gt": 5000}, {"field": "item.title", "like": "comic"}]}`:         true,
+		`{"and": [{"field": "item.price", "gte": 4500}, {"field": "item.title", "eq": "Golden Comics"}]}`: true,
+	}
+
+	for where, expected := range cases {
+		node := &models.FilterNode{}
+		if err := json.Unmarshal([]byte(where), node); err != nil {
+			t.Fatal(err)
+		}
+		expr, err := CompileWhere(node)
+		if err != nil {
+			t.Errorf("%v: %v", where, err)
+			continue
+		}
+		filter, err := engine.Compile(expr)
+		if err != nil {
+			t.Errorf("%v: %v", expr, err)
+			continue
+		}
+		v, err := filter.eval(context.Background(), map[string]interface{}{"doc": doc})
+		if err != nil {
+			t.Errorf("%v: %v", expr, err)
+			continue
+		}
+		if v != expected {
+			t.Errorf("%v: expected %v, got %v", expr, expected, v)
+		}
+	}
+
+	for _, where := range []string{`{}`, `{"field": "item.price"}`, `{"field": "a b", "eq": 1}`, `{"and": []}`, `{"field": "x", "eq": {"a": 1}}`} {
+		node := &models.FilterNode{}
+		_ = json.Unmarshal([]byte(where), node)
+		if expr, err := CompileWhere(node); err == nil {
+			t.Errorf("expected %v to be rejected, got %v", where, expr)
+		}
+	}
+}
@@ -0,0 +1,91 @@
+package servicestore
+
+import (
+	"fmt"
+
+	"github.com/kimitzu/kimitzu-services/models"
+)
+
+const (
+	// ExpandVendor embeds the vendor of each listing hit as its "vendor".
+	ExpandVendor = "vendor"
+)
+
+// DefaultVendorProjection is what is embedded of the vendors when a query doesn't pick the fields.
+var DefaultVendorProjection = []string{"peerID", "name", "handle", "avatarHashes", "lastPing", "reputation"}
+
+// vendorProjections are the fields of a models.Peer that can be embedded in the hits.
+var vendorProjections = map[string]func(peer *models.Peer) interface{}{
+	"peerID":       func(peer *models.Peer) interface{} { return peer.ID },
+	"name":         func(peer *models.Peer) interface{} { return peer.RawMap["name"] },
+	"handle":       func(peer *models.Peer) interface{} { return peer.RawMap["handle"] },
+	"about":        func(peer *models.Peer) interface{} { return peer.RawMap["about"] },
+	"location":     func(peer *models.Peer) interface{} { return peer.RawMap["location"] },
+	"avatarHashes": func(peer *models.Peer) interface{} { return peer.RawMap["avatarHashes"] },
+	"lastPing":     func(peer *models.Peer) interface{} { return peer.LastPing },
+	"fields":       func(peer *models.Peer) interface{} { return peer.Fields },
+	"reputation": func(peer *models.Peer) interface{} {
+		stats, _ := peer.RawMap["stats"].(map[string]interface{})
+		return map[string]interface{}{
+			"averageRating": stats["averageRating"],
+			"ratingCount":   stats["ratingCount"],
+		}
+	},
+}
+
+// expand resolves what params.Expand asks for, the vendors of the hits are read from the
+// peer store once each no matter how many of their listings are in the page.
+func (q *QueryResult) expand(m *MainManagedStorage, params *models.AdvancedSearchQuery) error {
+	vendor := false
+	for _, e := range params.Expand {
+		if e != ExpandVendor {
+			return fmt.Errorf("can't expand %v", e)
+		}
+		vendor = true
+	}
+	if !vendor {
+		return nil
+	}
+
+	projection := params.VendorProjection
+	if len(projection) == 0 {
+		projection = DefaultVendorProjection
+	}
+	for _, field := range projection {
+		if _, exists := vendorProjections[field]; !exists {
+			return fmt.Errorf("unknown vendor field %v", field)
+		}
+	}
+
+	q.VendorOf = make(map[string]string)
+	q.Vendors = make(map[string]map[string]interface{})
+	for _, doc := range q.Results.Documents {
+		hit := doc.ExportI()
+		id := VendorPeer(hit)
+		if id == "" {
+			continue
+		}
+		q.VendorOf[doc.ID] = id
+		if _, resolved := q.Vendors[id]; resolved {
+			continue
+		}
+
+		peerDoc, err := m.PeerData.Get(id)
+		if err != nil {
+			q.Vendors[id] = nil
+			continue
+		}
+		peer := &models.Peer{}
+		if err := peerDoc.Export(peer); err != nil {
+			q.Vendors[id] = nil
+			continue
+		}
+
+		projected := make(map[string]interface{})
+		for _, field := range projection {
+			projected[field] = vendorProjections[field](peer)
+		}
+		q.Vendors[id] = projected
+	}
+	return nil
+}
@@ -0,0 +1,69 @@
+package servicestore
+
+import (
+	"time"
+)
+
+// Explain describes how a query ran, how many documents were left after each
+// stage and how long each stage took.
+type Explain struct {
+	Stages           []ExplainStage `json:"stages"`
+	TotalMillis      float64        `json:"totalMs"`
+	BudgetSpent      int            `json:"budgetSpent"`
+	FilterErrorCount int            `json:"filterErrorCount"`
+	FilterErrors     []FilterError  `json:"filterErrors"`
+
+	started time.Time
+}
+
+// ExplainStage is a single step of a query, Filter is set for the filter stages.
+type ExplainStage struct {
+	Stage     string  `json:"stage"`
+	Filter    string  `json:"filter,omitempty"`
+	Remaining int     `json:"remaining"`
+	Millis    float64 `json:"ms"`
+}
+
+func newExplain() *Explain {
+	return &Explain{Stages: []ExplainStage{}, FilterErrors: []FilterError{}, started: time.Now()}
+}
+
+func millis(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+// stage records a stage that started at since if the query is being explained,
+// it returns the current time so stages can be chained.
+func (q *QueryResult) stage(name string, since time.Time) time.Time {
+	now := time.Now()
+	if q.Explain != nil {
+		q.Explain.Stages = append(q.Explain.Stages, ExplainStage{
+			Stage:     name,
+			Remaining: len(q.Results.Documents),
+			Millis:    millis(now.Sub(since)),
+		})
+		q.Explain.TotalMillis = millis(now.Sub(q.Explain.started))
+	}
+	return now
+}
+
+// explainFilters records a stage per filter along with the evaluation errors.
+func (q *QueryResult) explainFilters(filters []*CompiledFilter, stats *FilterStats) {
+	if q.Explain == nil || stats == nil {
+		return
+	}
+	for i, filter := range filters {
+		stage := ExplainStage{Stage: "filter", Filter: filter.Expression}
+		if i < len(stats.Remaining) {
+			stage.Remaining = stats.Remaining[i]
+		}
+		if i < len(stats.Durations) {
+			stage.Millis = millis(stats.Durations[i])
+		}
+		q.Explain.Stages = append(q.Explain.Stages, stage)
+	}
+	q.Explain.BudgetSpent = stats.Spent
+	q.Explain.FilterErrorCount = stats.ErrorCount
+	q.Explain.FilterErrors = stats.Errors
+	q.Explain.TotalMillis = millis(time.Since(q.Explain.started))
+}
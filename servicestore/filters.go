@@ -3,13 +3,16 @@ package servicestore
 import (
 	"encoding/json"
 	"fmt"
+	"reflect"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/PaesslerAG/gval"
 
 	"github.com/kimitzu/kimitzu-services/location"
 	"github.com/kimitzu/kimitzu-services/models"
+	"github.com/kimitzu/kimitzu-services/taxonomy"
 )
 
 func any(arr []bool) bool {
@@ -55,34 +58,101 @@ func like(a, b string) bool {
 
 }
 
-// LoadCustomEngine loads a custom gval.Language to extend the capabilities of the Filters.
-func LoadCustomEngine(store *MainManagedStorage) gval.Language {
-
-	getProps := func(profileId string) []map[string]string {
-		fmt.Println("getProps", profileId)
-		result, err := store.PeerData.Get(profileId)
+// lookupField walks a dotted path like "item.price" into a document.
+func lookupField(doc interface{}, path string) (interface{}, bool) {
+	current := doc
+	for _, key := range strings.Split(path, ".") {
+		m, ok := current.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		if current, ok = m[key]; !ok {
+			return nil, false
+		}
+	}
+	return current, current != nil
+}
 
-		if err != nil {
-			return nil
+func anyIn(v interface{}, values []interface{}) bool {
+	arr, isArr := v.([]interface{})
+	if !isArr {
+		arr = []interface{}{v}
+	}
+	for _, x := range arr {
+		for _, y := range values {
+			if reflect.DeepEqual(x, y) {
+				return true
+			}
 		}
+	}
+	return false
+}
+
+// filterDateLayouts are the layouts date() parses.
+var filterDateLayouts = []string{
+	time.RFC3339,
+	time.RFC3339Nano,
+	"2006-01-02",
+	"2006-01-02 15:04",
+	"2006-01-02 15:04:05",
+	"2006-01-02T15:04Z0700",
+	"2006-01-02T15:04:05Z0700",
+}
 
-		peer := &models.Peer{}
-		_ = result.Export(peer)
-		jb, err := json.Marshal(peer.RawMap["customFields"])
-		fields := []map[string]string{}
-		json.Unmarshal(jb, &fields)
+// filterLanguage is the language filters are written in: equality, numbers with their
+// arithmetic and order, text concatenation and order, logic, `in` and JSON arrays and
+// objects. The regex operators of gval.Text, bitmasks and the conditional operators
+// are left out.
+func filterLanguage(extensions ...gval.Language) gval.Language {
+	text := gval.NewLanguage(
+		gval.InfixTextOperator("+", func(a, b string) (interface{}, error) { return a + b, nil }),
+		gval.InfixTextOperator("<", func(a, b string) (interface{}, error) { return a < b, nil }),
+		gval.InfixTextOperator("<=", func(a, b string) (interface{}, error) { return a <= b, nil }),
+		gval.InfixTextOperator(">", func(a, b string) (interface{}, error) { return a > b, nil }),
+		gval.InfixTextOperator(">=", func(a, b string) (interface{}, error) { return a >= b, nil }),
+	)
 
-		return fields
+	language := []gval.Language{
+		gval.Base(),
+		gval.Arithmetic(),
+		text,
+		gval.PropositionalLogic(),
+		gval.JSON(),
+		// `doc.metadata.contractType in ["SERVICE", "DIGITAL_GOOD"]`
+		gval.InfixOperator("in", func(a, b interface{}) (interface{}, error) {
+			values, ok := b.([]interface{})
+			if !ok {
+				return nil, fmt.Errorf("expected an array on the right of in, got %T", b)
+			}
+			for _, value := range values {
+				if reflect.DeepEqual(a, value) {
+					return true, nil
+				}
+			}
+			return false, nil
+		}),
+		gval.Function("date", func(s string) (time.Time, error) {
+			for _, layout := range filterDateLayouts {
+				if t, err := time.ParseInLocation(layout, s, time.Local); err == nil {
+					return t, nil
+				}
+			}
+			return time.Time{}, fmt.Errorf("date() could not parse %v", s)
+		}),
 	}
+	return gval.NewLanguage(append(language, extensions...)...)
+}
+
+// LoadCustomEngine loads a custom gval.Language to extend the capabilities of the Filters.
+func LoadCustomEngine(store *MainManagedStorage) gval.Language {
 
-	locMap := LoadLocationMap()
-	language := gval.Full(
+	language := filterLanguage(
 		gval.Function("contains", func(fullstr string, substr string) bool {
 			return strings.Contains(fullstr, substr)
 		}),
 		gval.Function("containsInArr", func(arr []interface{}, search string) bool {
 			for _, val := range arr {
-				if val.(string) == search {
+				if s, ok := val.(string); ok && s == search {
 					return true
 				}
 			}
@@ -93,17 +163,20 @@ func LoadCustomEngine(store *MainManagedStorage) gval.Language {
 				return false
 			}
 
-			source := locMap[sourceCountry][sourceZip]
-			target := locMap[targetCountry][targetZip]
+			sourceLat, sourceLng, sourceOk := location.Lookup(sourceCountry, sourceZip)
+			targetLat, targetLng, targetOk := location.Lookup(targetCountry, targetZip)
+			if !sourceOk || !targetOk {
+				return false
+			}
 
-			return location.Distance(source[0], source[1], target[0], target[1]) <= distanceMeters
+			return location.Distance(sourceLat, sourceLng, targetLat, targetLng) <= distanceMeters
 		}),
 		gval.Function("coordsWithin", func(sourceLat float64, sourceLng float64, targetZip string, targetCountry string, distanceMeters float64) bool {
-			target := locMap[targetCountry][targetZip]
-			if targetZip == "" {
+			targetLat, targetLng, ok := location.Lookup(targetCountry, targetZip)
+			if targetZip == "" || !ok {
 				return false
 			}
-			return location.Distance(sourceLat, sourceLng, target[0], target[1]) <= distanceMeters
+			return location.Distance(sourceLat, sourceLng, targetLat, targetLng) <= distanceMeters
 		}),
 		gval.Function("geoWithin", func(sourceLat, sourceLng, targetLat, targetLng string, distanceMeters float64) bool {
 			if sourceLat == "" || sourceLng == "" || targetLat == "" || targetLng == "" {
@@ -115,6 +188,35 @@ func LoadCustomEngine(store *MainManagedStorage) gval.Language {
 			targetLng64, _ := strconv.ParseFloat(targetLng, 64)
 			return location.Distance(sourceLat64, sourceLng64, targetLat64, targetLng64) <= distanceMeters
 		}),
+		// `locatedWithin(doc.location, 10.69, 122.56, 5000)`, resolves the coordinates like the near queries
+		gval.Function("locatedWithin", func(loc interface{}, lat, lng, distanceMeters float64) bool {
+			jb, _ := json.Marshal(loc)
+			target := &models.Location{}
+			if err := json.Unmarshal(jb, target); err != nil {
+				return false
+			}
+			targetLat, targetLng, ok := store.ListingCoordinates(target)
+			return ok && location.Distance(lat, lng, targetLat, targetLng) <= distanceMeters
+		}),
+		// `field(doc, "item.price")` is the value at a path of the document, nil if it doesn't exist
+		gval.Function("field", func(doc interface{}, path string) interface{} {
+			v, _ := lookupField(doc, path)
+			return v
+		}),
+		gval.Function("exists", func(doc interface{}, path string) bool {
+			_, ok := lookupField(doc, path)
+			return ok
+		}),
+		// `anyIn(doc.metadata.acceptedCurrencies, ["BTC", "ZEC"])`, arrays match if any of their elements do
+		gval.Function("anyIn", anyIn),
+		// `convertPrice(doc.pricing.amount, doc.pricing.currency, "EUR") < 50`
+		gval.Function("convertPrice", func(amount float64, from, to string) (float64, error) {
+			return store.Rates.Convert(amount, from, to)
+		}),
+		// `inCategory(doc.metadata.serviceClassification, "home.plumbing")` also matches the subcategories
+		gval.Function("inCategory", func(classification, code string) bool {
+			return taxonomy.Current().Within(classification, code)
+		}),
 		gval.Function("compareString", func(x, y string) bool {
 			return x < y
 		}),
@@ -125,6 +227,14 @@ func LoadCustomEngine(store *MainManagedStorage) gval.Language {
 			return like(x, y)
 		}),
 
+		// `fuzzy(doc.item.title, "plumbr")`, like but tolerates typos
+		gval.Function("fuzzy", func(x, y string) bool {
+			if y == "" || x == "" {
+				return false
+			}
+			return fuzzyLike(x, y)
+		}),
+
 		// `getProfile(doc.peerId)["age"]["min"] > 14`
 		gval.Function("getProfile", func(profileId string) map[string]interface{} {
 			profile := store.PeerData.Search(profileId)
@@ -134,24 +244,14 @@ func LoadCustomEngine(store *MainManagedStorage) gval.Language {
 			return profile.Documents[0].ExportI()
 		}),
 
+        // `hasProp(doc.vendorID.peerID, "Certified")`, doc.vendorFields is faster for listings
         gval.Function("hasProp", func(profileId, target string) bool {
-            fields := getProps(profileId)
-            for _, field := range fields {
-                if prop, ok := field["label"]; ok && prop == target {
-                    return true
-                }
-            }
-            return false
+            _, ok := store.ProfileLabels(profileId)[target]
+            return ok
         }),
 
         gval.Function("getPropAsString", func(profileId string, target string) string {
-			fields := getProps(profileId)
-			for _, field := range fields {
-				if prop, ok := field["label"]; ok && prop == target {
-					return field["value"]
-				}
-			}
-			return ""
+			return store.ProfileLabels(profileId)[target]
 		}),
 
         gval.Function("asInt", func(s string) int {
@@ -0,0 +1,125 @@
+package servicestore
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+// maxEdits returns how many typos a token of the given length is allowed to have.
+// Short tokens have to match exactly, otherwise everything would match.
+func maxEdits(token string) int {
+	n := utf8.RuneCountInString(token)
+	switch {
+	case n <= 3:
+		return 0
+	case n <= 6:
+		return 1
+	default:
+		return 2
+	}
+}
+
+// editDistance computes the Levenshtein distance between a and b, giving up
+// as soon as the distance is guaranteed to go beyond max. Returns max+1
+// when the distance is out of bounds.
+func editDistance(a, b string, max int) int {
+	ra := []rune(a)
+	rb := []rune(b)
+
+	if abs(len(ra)-len(rb)) > max {
+		return max + 1
+	}
+
+	prev := make([]int, len(rb)+1)
+	curr := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+
+	for i := 1; i <= len(ra); i++ {
+		curr[0] = i
+		rowMin := curr[0]
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			curr[j] = min3(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+			if curr[j] < rowMin {
+				rowMin = curr[j]
+			}
+		}
+		if rowMin > max {
+			return max + 1
+		}
+		prev, curr = curr, prev
+	}
+
+	if prev[len(rb)] > max {
+		return max + 1
+	}
+	return prev[len(rb)]
+}
+
+// prefixDistance is the edit distance between token and the closest prefix
+// of word, used for typo tolerant autocompletion ("plumb" ~ "plubming").
+func prefixDistance(token, word string, max int) int {
+	rt := []rune(token)
+	rw := []rune(word)
+
+	best := max + 1
+	for n := len(rt) - max; n <= len(rt)+max; n++ {
+		if n < 0 || n > len(rw) {
+			continue
+		}
+		if d := editDistance(token, string(rw[:n]), max); d < best {
+			best = d
+		}
+	}
+	return best
+}
+
+// fuzzyHas is the typo tolerant version of has, it returns true if any
+// whitespace separated word of str starts with something close to token.
+func fuzzyHas(token, str string) bool {
+	token = strings.ToLower(token)
+	max := maxEdits(token)
+	for _, t := range strings.Fields(strings.ToLower(str)) {
+		if prefixDistance(token, t, max) <= max {
+			return true
+		}
+	}
+	return false
+}
+
+// fuzzyLike is the typo tolerant version of like.
+func fuzzyLike(a, b string) bool {
+	for _, t := range strings.Fields(a) {
+		if fuzzyHas(t, b) {
+			return true
+		}
+	}
+	for _, t := range strings.Fields(b) {
+		if fuzzyHas(t, a) {
+			return true
+		}
+	}
+	return false
+}
+
+func abs(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
+
+func min3(a, b, c int) int {
+	if b < a {
+		a = b
+	}
+	if c < a {
+		a = c
+	}
+	return a
+}
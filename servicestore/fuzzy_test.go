@@ -0,0 +1,96 @@
+package servicestore
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestEditDistance(t *testing.T) {
+	cases := []struct {
+		a, b     string
+		max      int
+		expected int
+	}{
+		{"plumber", "plumber", 2, 0},
+		{"plumbr", "plumber", 2, 1},
+		{"pulmber", "plumber", 2, 2},
+		{"electrician", "plumber", 2, 3},
+		{"cat", "cats", 0, 1},
+	}
+
+	for _, c := range cases {
+		if d := editDistance(c.a, c.b, c.max); d != c.expected {
+			t.Errorf("editDistance(%q, %q, %v) is %v, expected %v", c.a, c.b, c.max, d, c.expected)
+		}
+	}
+}
+
+func TestFuzzyLike(t *testing.T) {
+	if !fuzzyLike("plubming", "Emergency Plumbing Services") {
+		t.Error("Expected `plubming` to match `Emergency Plumbing Services`")
+	}
+
+	if !fuzzyLike("electr", "Licensed Electrician") {
+		t.Error("Expected the prefix `electr` to match `Licensed Electrician`")
+	}
+
+	if fuzzyLike("car", "Licensed Electrician") {
+		t.Error("Expected short tokens to require an exact prefix match")
+	}
+}
+
+func TestSuggest(t *testing.T) {
+	dir, err := ioutil.TempDir("", "suggest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	m := InitializeManagedStorage(dir)
+	defer m.Close()
+
+	titles := []string{"Electrician", "Electrician", "Electrician", "Electrician", "Plumber", "Plumber", "Plumbing Repair", "Flumbing Supplies"}
+	for i, title := range titles {
+		listing := map[string]interface{}{"hash": fmt.Sprint("listing", i), "item": map[string]interface{}{"title": title}}
+		if _, err := m.Listings.Insert(fmt.Sprint("listing", i), listing); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	index := NewSuggestIndex()
+	index.Refresh(m)
+
+	texts := func(result []Suggestion) []string {
+		texts := []string{}
+		for _, s := range result {
+			texts = append(texts, s.Text)
+		}
+		return texts
+	}
+
+	cases := []struct {
+		q        string
+		expected []string
+	}{
+		{"plum", []string{"plumber", "plumbing", "plumbing repair"}},
+		{"plubm", []string{"plumber", "plumbing", "plumbing repair"}},
+		{"elektri", []string{"electrician"}},
+		{"lumbing", []string{}},
+		{"xyz", []string{}},
+	}
+	for _, c := range cases {
+		if result := texts(index.Suggest(c.q, 10)); !reflect.DeepEqual(result, c.expected) {
+			t.Errorf("Suggest(%q) is %v, expected %v", c.q, result, c.expected)
+		}
+	}
+
+	if result := index.Suggest("plum", 1); len(result) != 1 || result[0].Text != "plumber" || result[0].Count != 2 {
+		t.Errorf("Expected the most frequent completion of `plum`, got %v", result)
+	}
+
+	if corrected := index.Correct("plumbng"); corrected != "plumbing" {
+		t.Errorf("Correct(`plumbng`) is %q, expected `plumbing`", corrected)
+	}
+}
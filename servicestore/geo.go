@@ -0,0 +1,87 @@
+package servicestore
+
+import (
+	"strconv"
+	"sync"
+
+	"github.com/kimitzu/kimitzu-services/location"
+	"github.com/kimitzu/kimitzu-services/models"
+)
+
+const (
+	// listingGeoPrecision is the geohash precision of the listing index, cells are about 39km x 20km.
+	listingGeoPrecision = 4
+)
+
+// ListingGeoIndex is the spatial index of the listing coordinates keyed by document ID.
+type ListingGeoIndex struct {
+	lock      *sync.RWMutex
+	index     *location.GeoIndex
+	refresher *refresher
+}
+
+// NewListingGeoIndex returns an empty ListingGeoIndex, it gets populated on the first Refresh.
+func NewListingGeoIndex() *ListingGeoIndex {
+	return &ListingGeoIndex{
+		lock:      &sync.RWMutex{},
+		index:     location.NewGeoIndex(listingGeoPrecision),
+		refresher: newRefresher(),
+	}
+}
+
+// Invalidate flags the index as stale, it gets rebuilt on the next lookup.
+func (g *ListingGeoIndex) Invalidate() {
+	g.refresher.invalidate()
+}
+
+// Refresh rebuilds the index from the listings in the store.
+func (g *ListingGeoIndex) Refresh(m *MainManagedStorage) {
+	index := location.NewGeoIndex(listingGeoPrecision)
+
+	listings := m.Listings.Search("")
+	for _, doc := range listings.Documents {
+		listing := models.ListingClass{}
+		if err := doc.Export(&listing); err != nil {
+			continue
+		}
+		if lat, lng, ok := m.ListingCoordinates(&listing.Location); ok {
+			index.Insert(doc.ID, lat, lng)
+		}
+	}
+
+	g.lock.Lock()
+	g.index = index
+	g.lock.Unlock()
+}
+
+// Within returns the listings within radius meters of (lat, lng), closest first.
+func (g *ListingGeoIndex) Within(lat, lng, radius float64) []location.GeoHit {
+	g.lock.RLock()
+	index := g.index
+	g.lock.RUnlock()
+	return index.Within(lat, lng, radius)
+}
+
+// ListingLocations returns the up to date spatial index of the listings.
+func (m *MainManagedStorage) ListingLocations() *ListingGeoIndex {
+	m.GeoIndex.refresher.refresh(func() { m.GeoIndex.Refresh(m) })
+	return m.GeoIndex
+}
+
+// ListingCoordinates resolves the coordinates of a listing location, either from its
+// latitude and longitude or from its zip code and country through the location dataset.
+func (m *MainManagedStorage) ListingCoordinates(loc *models.Location) (lat, lng float64, ok bool) {
+	if loc.Latitude != "" && loc.Longitude != "" {
+		lat, errLat := strconv.ParseFloat(loc.Latitude, 64)
+		lng, errLng := strconv.ParseFloat(loc.Longitude, 64)
+		if errLat == nil && errLng == nil {
+			return lat, lng, true
+		}
+	}
+
+	if loc.ZipCode != "" && loc.Country != "" {
+		return location.Lookup(loc.Country, loc.ZipCode)
+	}
+
+	return 0, 0, false
+}
@@ -0,0 +1,72 @@
+package servicestore
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/kimitzu/kimitzu-services/location"
+	"github.com/kimitzu/kimitzu-services/models"
+)
+
+const (
+	// maxReverseDistance is how far a listing can be from the nearest known
+	// postal code for it to be assumed as the listing's zip code.
+	maxReverseDistance = 25000
+)
+
+// ResolveLocation fills in whatever it can of the missing coordinates, zip code
+// and plus code of a listing location so it can show up in radius searches.
+// Returns true if anything was changed.
+func (m *MainManagedStorage) ResolveLocation(loc *models.Location) bool {
+	changed := false
+	_, _, hasCoords := m.ListingCoordinates(&models.Location{Latitude: loc.Latitude, Longitude: loc.Longitude})
+
+	// Plus codes can come with a locality, "8F+9V Iloilo City"
+	if fields := strings.Fields(loc.PlusCode); !hasCoords && len(fields) != 0 {
+		code := fields[0]
+		if !location.IsFullPlusCode(code) {
+			if refLat, refLng, ok := m.ListingCoordinates(&models.Location{ZipCode: loc.ZipCode, Country: loc.Country}); ok {
+				code, _ = location.RecoverPlusCode(code, refLat, refLng)
+			}
+		}
+		if area, err := location.DecodePlusCode(code); err == nil {
+			lat, lng := area.Center()
+			loc.Latitude = strconv.FormatFloat(lat, 'f', -1, 64)
+			loc.Longitude = strconv.FormatFloat(lng, 'f', -1, 64)
+			hasCoords, changed = true, true
+		}
+	}
+
+	if !hasCoords {
+		if lat, lng, ok := m.ListingCoordinates(&models.Location{ZipCode: loc.ZipCode, Country: loc.Country}); ok {
+			loc.Latitude = strconv.FormatFloat(lat, 'f', -1, 64)
+			loc.Longitude = strconv.FormatFloat(lng, 'f', -1, 64)
+			hasCoords, changed = true, true
+		}
+	}
+
+	if !hasCoords {
+		return changed
+	}
+
+	lat, lng, _ := m.ListingCoordinates(loc)
+
+	if loc.ZipCode == "" {
+		if nearest, found := location.Reverse(lat, lng); found && nearest.Dist <= maxReverseDistance {
+			if loc.Country == "" || loc.Country == nearest.Loc.Country {
+				loc.ZipCode = nearest.Loc.ZipCode
+				loc.Country = nearest.Loc.Country
+				changed = true
+			}
+		}
+	}
+
+	if loc.PlusCode == "" {
+		if code, err := location.EncodePlusCode(lat, lng, 10); err == nil {
+			loc.PlusCode = code
+			changed = true
+		}
+	}
+
+	return changed
+}
@@ -0,0 +1,23 @@
+package servicestore
+
+import (
+	"testing"
+
+	"github.com/kimitzu/kimitzu-services/models"
+)
+
+func TestResolveLocationPlusCode(t *testing.T) {
+	m := &MainManagedStorage{}
+
+	loc := &models.Location{PlusCode: "8FVC9G8F+6X Zurich"}
+	if !m.ResolveLocation(loc) || loc.Latitude == "" || loc.Longitude == "" {
+		t.Errorf("expected the plus code to be resolved, got %+v", loc)
+	}
+
+	for _, code := range []string{"   ", "\t\n", "not a code"} {
+		loc := &models.Location{PlusCode: code}
+		if m.ResolveLocation(loc) {
+			t.Errorf("%q: expected nothing to be resolved, got %+v", code, loc)
+		}
+	}
+}
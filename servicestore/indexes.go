@@ -0,0 +1,58 @@
+package servicestore
+
+import "sync"
+
+// refresher keeps track of whether a derived index is out of date with the
+// listings and peers in the store. The first build is done synchronously,
+// after that rebuilds happen in the background while lookups keep being
+// served from the previous state.
+type refresher struct {
+	lock    sync.Mutex
+	dirty   bool
+	running bool
+	built   bool
+}
+
+func newRefresher() *refresher {
+	return &refresher{dirty: true}
+}
+
+func (r *refresher) invalidate() {
+	r.lock.Lock()
+	r.dirty = true
+	r.lock.Unlock()
+}
+
+func (r *refresher) refresh(build func()) {
+	r.lock.Lock()
+	if !r.dirty || r.running {
+		r.lock.Unlock()
+		return
+	}
+	r.dirty = false
+	r.running = true
+	built := r.built
+	r.lock.Unlock()
+
+	run := func() {
+		build()
+		r.lock.Lock()
+		r.running = false
+		r.built = true
+		r.lock.Unlock()
+	}
+
+	if !built {
+		run()
+		return
+	}
+	go run()
+}
+
+// MarkChanged notifies the derived indexes that the listings or peers have changed.
+func (m *MainManagedStorage) MarkChanged() {
+	m.Suggestions.Invalidate()
+	m.GeoIndex.Invalidate()
+	m.Categories.Invalidate()
+	m.Profiles.Invalidate()
+}
@@ -0,0 +1,34 @@
+package servicestore
+
+// Presence tells whether peers are online without waiting on the network,
+// voyager keeps the statuses fresh in the background.
+type Presence interface {
+	Online(peerID string) bool
+}
+
+// VendorPeer returns the peer ID of the vendor of a listing hit, its parentPeer if it has no vendorID.
+func VendorPeer(hit map[string]interface{}) string {
+	peerID, _ := lookupField(hit, "vendorID.peerID")
+	id, _ := peerID.(string)
+	if id == "" {
+		id, _ = hit["parentPeer"].(string)
+	}
+	return id
+}
+
+// online drops the documents whose peer isn't online, peerOf returns the peer of a hit.
+func (q *QueryResult) online(presence Presence, peerOf func(map[string]interface{}) string) {
+	docs := q.Results.Documents[:0]
+	for _, doc := range q.Results.Documents {
+		if id := peerOf(doc.ExportI()); id != "" && presence.Online(id) {
+			docs = append(docs, doc)
+		}
+	}
+	q.Results.Documents = docs
+	q.Results.Count = len(docs)
+}
+
+func peerOfPeer(hit map[string]interface{}) string {
+	id, _ := hit["peerID"].(string)
+	return id
+}
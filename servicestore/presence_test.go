@@ -0,0 +1,64 @@
+package servicestore
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/nokusukun/go-menasai/chunk"
+	gomenasai "github.com/nokusukun/go-menasai/manager"
+
+	"github.com/kimitzu/kimitzu-services/models"
+)
+
+type presenceMap map[string]bool
+
+func (p presenceMap) Online(peerID string) bool {
+	return p[peerID]
+}
+
+func TestQueryOnline(t *testing.T) {
+	hits := []map[string]interface{}{
+		{"hash": "online", "vendorID": map[string]interface{}{"peerID": "QmOnline"}},
+		{"hash": "offline", "vendorID": map[string]interface{}{"peerID": "QmOffline"}},
+		{"hash": "unknown", "vendorID": map[string]interface{}{"peerID": "QmUnknown"}},
+		{"hash": "parent", "parentPeer": "QmOnline"},
+		{"hash": "orphan"},
+	}
+	results := &gomenasai.SearchResult{}
+	for _, hit := range hits {
+		content, _ := json.Marshal(hit)
+		results.Documents = append(results.Documents, &chunk.Document{ID: hit["hash"].(string), Content: content})
+	}
+
+	q := &QueryResult{Results: results}
+	q.online(presenceMap{"QmOnline": true, "QmOffline": false}, VendorPeer)
+
+	ids := []string{}
+	for _, doc := range q.Results.Documents {
+		ids = append(ids, doc.ID)
+	}
+	if len(ids) != 2 || ids[0] != "online" || ids[1] != "parent" || q.Results.Count != 2 {
+		t.Errorf("expected the listings of online vendors, got %v (count %v)", ids, q.Results.Count)
+	}
+}
+
+func TestPresenceUnavailable(t *testing.T) {
+	dir, err := ioutil.TempDir("", "servicestore")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	m := InitializeManagedStorage(dir)
+	defer m.Close()
+
+	params := &models.AdvancedSearchQuery{OnlineOnly: true}
+	if _, err := m.QueryListings(context.Background(), params); err == nil || err.(*QueryError).Reason != "presenceUnavailable" {
+		t.Errorf("listings: expected presenceUnavailable, got %v", err)
+	}
+	if _, err := m.QueryPeers(context.Background(), params); err == nil || err.(*QueryError).Reason != "presenceUnavailable" {
+		t.Errorf("peers: expected presenceUnavailable, got %v", err)
+	}
+}
@@ -0,0 +1,127 @@
+package servicestore
+
+import (
+	"encoding/json"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kimitzu/kimitzu-services/models"
+)
+
+var (
+	fieldKeyInvalid = regexp.MustCompile(`[^a-z0-9]+`)
+	// fieldNumber matches plain decimal numbers, with thousands grouped by commas. Leading
+	// zeros aren't, so values like zip codes and phone numbers stay strings.
+	fieldNumber      = regexp.MustCompile(`^-?(0|[1-9][0-9]{0,2}(,[0-9]{3})+|[1-9][0-9]*)(\.[0-9]+)?$`)
+	fieldDateLayouts = []string{time.RFC3339, "2006-01-02", "2006/01/02", "01/02/2006", "January 2, 2006", "Jan 2, 2006"}
+)
+
+// FieldKey turns a custom field label like "Years of Experience" into the key it is
+// indexed with, "years_of_experience", so filters can refer to it as doc.fields.years_of_experience.
+func FieldKey(label string) string {
+	return strings.Trim(fieldKeyInvalid.ReplaceAllString(strings.ToLower(label), "_"), "_")
+}
+
+// IndexProfileFields reads the custom fields of a profile, a list of label and value pairs,
+// into a map keyed by FieldKey. Numbers are stored as numbers and dates in RFC 3339 so
+// they compare with date(), everything else is kept as a string.
+func IndexProfileFields(profile map[string]interface{}) map[string]interface{} {
+	raw, _ := profile["customFields"].([]interface{})
+	fields := make(map[string]interface{})
+	for _, entry := range raw {
+		field, ok := entry.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		label, _ := field["label"].(string)
+		key := FieldKey(label)
+		if key == "" {
+			continue
+		}
+		fields[key] = typedFieldValue(field["value"])
+	}
+	return fields
+}
+
+func typedFieldValue(v interface{}) interface{} {
+	s, isString := v.(string)
+	if !isString {
+		return v
+	}
+
+	trimmed := strings.TrimSpace(s)
+	if fieldNumber.MatchString(trimmed) {
+		n, err := strconv.ParseFloat(strings.Replace(trimmed, ",", "", -1), 64)
+		if err == nil && !math.IsNaN(n) && !math.IsInf(n, 0) {
+			return n
+		}
+	}
+	for _, layout := range fieldDateLayouts {
+		if t, err := time.Parse(layout, trimmed); err == nil {
+			return t.UTC().Format(time.RFC3339)
+		}
+	}
+	return trimmed
+}
+
+// ProfileIndex holds the raw custom field labels and values of every peer, it
+// backs hasProp and getPropAsString so they don't read the peer per document.
+type ProfileIndex struct {
+	lock      *sync.RWMutex
+	labels    map[string]map[string]string
+	refresher *refresher
+}
+
+// NewProfileIndex returns an empty ProfileIndex, it gets populated on the first Refresh.
+func NewProfileIndex() *ProfileIndex {
+	return &ProfileIndex{
+		lock:      &sync.RWMutex{},
+		labels:    make(map[string]map[string]string),
+		refresher: newRefresher(),
+	}
+}
+
+// Invalidate flags the index as stale, it gets rebuilt on the next lookup.
+func (p *ProfileIndex) Invalidate() {
+	p.refresher.invalidate()
+}
+
+// Refresh rebuilds the index from the peers of the store.
+func (p *ProfileIndex) Refresh(m *MainManagedStorage) {
+	labels := make(map[string]map[string]string)
+
+	peers := m.PeerData.Search("")
+	for _, doc := range peers.Documents {
+		peer := models.Peer{}
+		if err := doc.Export(&peer); err != nil {
+			continue
+		}
+		jb, _ := json.Marshal(peer.RawMap["customFields"])
+		fields := []map[string]string{}
+		_ = json.Unmarshal(jb, &fields)
+
+		peerLabels := make(map[string]string)
+		for _, field := range fields {
+			if label, ok := field["label"]; ok {
+				peerLabels[label] = field["value"]
+			}
+		}
+		labels[peer.ID] = peerLabels
+	}
+
+	p.lock.Lock()
+	p.labels = labels
+	p.lock.Unlock()
+}
+
+// ProfileLabels returns the custom field values of a peer keyed by their label.
+func (m *MainManagedStorage) ProfileLabels(peerID string) map[string]string {
+	m.Profiles.refresher.refresh(func() { m.Profiles.Refresh(m) })
+	m.Profiles.lock.RLock()
+	defer m.Profiles.lock.RUnlock()
+	return m.Profiles.labels[peerID]
+}
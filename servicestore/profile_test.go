@@ -0,0 +1,56 @@
+package servicestore
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestTypedFieldValue(t *testing.T) {
+	cases := []struct {
+		value    string
+		expected interface{}
+	}{
+		{"42", 42.0},
+		{"-3.5", -3.5},
+		{"0.25", 0.25},
+		{"1,500", 1500.0},
+		{"12,345.67", 12345.67},
+		{"1,5", "1,5"},
+		{"01234", "01234"},
+		{"0917 555 1234", "0917 555 1234"},
+		{"NaN", "NaN"},
+		{"Inf", "Inf"},
+		{"-Infinity", "-Infinity"},
+		{"1e3", "1e3"},
+		{"0x1F", "0x1F"},
+	}
+	for _, c := range cases {
+		if value := typedFieldValue(c.value); value != c.expected {
+			t.Errorf("%q: expected %v, got %v", c.value, c.expected, value)
+		}
+	}
+}
+func TestIndexProfileFields(t *testing.T) {
+	profile := map[string]interface{}{}
+	_ = json.Unmarshal([]byte(`{"customFields": [
+		{"label": "Years of Experience", "value": "7"},
+		{"label": "Certified Since", "value": "2012-05-01"},
+		{"label": "Licence", "value": " Master Electrician "},
+		{"label": "", "value": "ignored"}
+	]}`), &profile)
+
+	fields := IndexProfileFields(profile)
+	expected := map[string]interface{}{
+		"years_of_experience": 7.0,
+		"certified_since":     "2012-05-01T00:00:00Z",
+		"licence":             "Master Electrician",
+	}
+	if len(fields) != len(expected) {
+		t.Errorf("expected %v fields, got %v", len(expected), fields)
+	}
+	for key, value := range expected {
+		if fields[key] != value {
+			t.Errorf("%v: expected %v, got %v", key, value, fields[key])
+		}
+	}
+}
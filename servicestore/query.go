@@ -0,0 +1,402 @@
+package servicestore
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	gomenasai "github.com/nokusukun/go-menasai/manager"
+
+	"github.com/kimitzu/kimitzu-services/models"
+	"github.com/kimitzu/kimitzu-services/taxonomy"
+)
+
+const (
+	// OrderDistance sorts the hits of a near query closest first.
+	OrderDistance = "distance"
+	// OrderPrice and OrderPriceDesc sort listings by their price in the buyer's currency,
+	// listings without a known price come last.
+	OrderPrice     = "price"
+	OrderPriceDesc = "-price"
+
+	storeListings = "listings"
+	storePeers    = "peers"
+)
+
+// QueryResult is the outcome of running an AdvancedSearchQuery against one of the stores.
+type QueryResult struct {
+	Results   *gomenasai.SearchResult
+	Distances map[string]float64
+
+	// Prices are the listing prices in Currency, the buyer's currency
+	Prices   map[string]float64
+	Currency string
+	// Estimates are the costs of the listings for the hours or units of the query, in Currency
+	Estimates   map[string]float64
+	RateMethods map[string]string
+
+	// Vendors are the projected vendors of the hits keyed by peer ID, VendorOf maps
+	// the hits to their vendor
+	Vendors  map[string]map[string]interface{}
+	VendorOf map[string]string
+
+	// Explain is set for queries with Explain, see models.AdvancedSearchQuery
+	Explain *Explain
+
+	NextStart int
+	// NextCursor fetches the next page from a snapshot of the results, empty on the last page
+	NextCursor string
+	Filters    *FilterStats
+}
+
+// QueryError is returned when the filters of a query can't be compiled or fail to run.
+type QueryError struct {
+	Reason  string        `json:"error"`
+	Errors  []FilterError `json:"details"`
+	Explain *Explain      `json:"explain,omitempty"`
+	// TimedOut is set when the query ran out of time rather than being invalid
+	TimedOut bool `json:"-"`
+}
+
+func (e *QueryError) Error() string {
+	if len(e.Errors) == 0 {
+		return e.Reason
+	}
+	return fmt.Sprintf("%v: %v", e.Reason, e.Errors[0].Error())
+}
+
+// QueryListings runs params against the listings.
+func (m *MainManagedStorage) QueryListings(ctx context.Context, params *models.AdvancedSearchQuery) (*QueryResult, error) {
+	if params.Cursor != "" {
+		return m.queryPage(storeListings, params)
+	}
+
+	filters, err := m.compileFilters(params)
+	if err != nil {
+		return nil, err
+	}
+	if params.OnlineOnly && m.Presence == nil {
+		return nil, &QueryError{Reason: "presenceUnavailable"}
+	}
+
+	query := &QueryResult{}
+	if params.Explain {
+		query.Explain = newExplain()
+	}
+
+	started := time.Now()
+	query.Results = m.SearchListings(params.Query, params.Fuzzy)
+	started = query.stage("search", started)
+
+	if query.Results.Count == 0 && params.Generous {
+		query.Results = m.Listings.Search("")
+		started = query.stage("generous", started)
+	}
+
+	if params.Near != nil {
+		query.near(m.ListingLocations(), params.Near)
+		started = query.stage("near", started)
+	}
+
+	if params.OnlineOnly {
+		query.online(m.Presence, VendorPeer)
+		query.stage("online", started)
+	}
+	return query, query.run(ctx, m, storeListings, filters, params)
+}
+
+// QueryPeers runs params against the peers.
+func (m *MainManagedStorage) QueryPeers(ctx context.Context, params *models.AdvancedSearchQuery) (*QueryResult, error) {
+	if params.Cursor != "" {
+		return m.queryPage(storePeers, params)
+	}
+
+	filters, err := m.compileFilters(params)
+	if err != nil {
+		return nil, err
+	}
+	if params.OnlineOnly && m.Presence == nil {
+		return nil, &QueryError{Reason: "presenceUnavailable"}
+	}
+
+	query := &QueryResult{}
+	if params.Explain {
+		query.Explain = newExplain()
+	}
+
+	started := time.Now()
+	query.Results = m.PeerData.Search(params.Query)
+	started = query.stage("search", started)
+
+	if params.OnlineOnly {
+		query.online(m.Presence, peerOfPeer)
+		query.stage("online", started)
+	}
+	return query, query.run(ctx, m, storePeers, filters, params)
+}
+
+// queryPage returns the page params.Cursor points to, the query itself
+// isn't run again so the pages don't shift while the stores change.
+func (m *MainManagedStorage) queryPage(store string, params *models.AdvancedSearchQuery) (*QueryResult, error) {
+	cursor, err := DecodeCursor(params.Cursor)
+	if err != nil {
+		return nil, &QueryError{Reason: err.Error()}
+	}
+
+	query, total, err := m.Snapshots.page(store, cursor)
+	if err != nil {
+		return nil, &QueryError{Reason: err.Error()}
+	}
+
+	next := cursor.Offset + cursor.Limit
+	query.NextStart = -1
+	if next < total {
+		query.NextStart = next
+		query.NextCursor = EncodeCursor(Cursor{cursor.Snapshot, next, cursor.Limit})
+	}
+	if store == storeListings {
+		if err := query.expand(m, params); err != nil {
+			return nil, &QueryError{Reason: err.Error()}
+		}
+	}
+	query.transform(params)
+	return query, nil
+}
+
+// compileFilters compiles the string filters of params along with its structured filter.
+func (m *MainManagedStorage) compileFilters(params *models.AdvancedSearchQuery) ([]*CompiledFilter, error) {
+	exprs := params.Filters
+	if params.Category != "" {
+		code, known := taxonomy.Current().Resolve(params.Category)
+		if !known {
+			return nil, &QueryError{Reason: fmt.Sprintf("unknown category %v", params.Category)}
+		}
+		exprs = append(append([]string{}, exprs...),
+			fmt.Sprintf(`inCategory(field(doc, "metadata.serviceClassification") ?? "", %q)`, code))
+	}
+	if params.Where != nil {
+		where, err := CompileWhere(params.Where)
+		if err != nil {
+			return nil, &QueryError{Reason: "invalidFilter", Errors: []FilterError{{"where", err.Error()}}}
+		}
+		exprs = append(append([]string{}, exprs...), where)
+	}
+
+	filters, errs := m.Filters.CompileAll(exprs)
+	if len(errs) != 0 {
+		return nil, &QueryError{Reason: "invalidFilter", Errors: errs}
+	}
+	return filters, nil
+}
+
+// near drops every document that isn't within the radius of the near query
+// and remembers the distance of the ones that are.
+func (q *QueryResult) near(index *ListingGeoIndex, near *models.NearQuery) {
+	q.Distances = make(map[string]float64)
+	for _, hit := range index.Within(near.Lat, near.Lng, near.RadiusMeters) {
+		q.Distances[hit.ID] = hit.Distance
+	}
+
+	docs := q.Results.Documents[:0]
+	for _, doc := range q.Results.Documents {
+		if _, ok := q.Distances[doc.ID]; ok {
+			docs = append(docs, doc)
+		}
+	}
+	q.Results.Documents = docs
+	q.Results.Count = len(docs)
+}
+
+func (q *QueryResult) run(ctx context.Context, m *MainManagedStorage, store string, filters []*CompiledFilter, params *models.AdvancedSearchQuery) error {
+	results := q.Results
+
+	stats, err := m.Filters.Apply(ctx, results, filters)
+	q.Filters = stats
+	q.explainFilters(filters, stats)
+	started := time.Now()
+	if err != nil {
+		if ferr, ok := err.(*FilterError); ok {
+			return &QueryError{Reason: "invalidFilter", Errors: []FilterError{*ferr}, Explain: q.Explain}
+		}
+		if _, ok := err.(*FilterTimeoutError); ok {
+			return &QueryError{Reason: err.Error(), Explain: q.Explain, TimedOut: true}
+		}
+		return &QueryError{Reason: err.Error(), Explain: q.Explain}
+	}
+
+	if store == storeListings {
+		if err := q.price(m.Rates, params); err != nil {
+			return &QueryError{Reason: err.Error(), Explain: q.Explain}
+		}
+		started = q.stage("price", started)
+	}
+
+	if params.Order == OrderDistance && q.Distances != nil {
+		sort.SliceStable(results.Documents, func(i, j int) bool {
+			return q.Distances[results.Documents[i].ID] < q.Distances[results.Documents[j].ID]
+		})
+	} else if (params.Order == OrderPrice || params.Order == OrderPriceDesc) && q.Prices != nil {
+		desc := params.Order == OrderPriceDesc
+		sort.SliceStable(results.Documents, func(i, j int) bool {
+			return q.lessPrice(results.Documents[i].ID, results.Documents[j].ID, desc)
+		})
+	} else if params.Sort != "" {
+		results.Sort(params.Sort)
+	}
+	started = q.stage("sort", started)
+
+	total := len(results.Documents)
+	q.NextStart = params.Start + params.Limit
+	if q.NextStart >= total {
+		q.NextStart = -1
+	}
+
+	if params.Limit != 0 {
+		// Later pages are served from a snapshot of the results through NextCursor
+		if q.NextStart != -1 {
+			id := m.Snapshots.save(store, q)
+			q.NextCursor = EncodeCursor(Cursor{id, q.NextStart, params.Limit})
+		}
+		results.Limit(params.Start, params.Limit)
+	}
+	started = q.stage("limit", started)
+
+	if store == storeListings {
+		if err := q.expand(m, params); err != nil {
+			return &QueryError{Reason: err.Error(), Explain: q.Explain}
+		}
+		started = q.stage("expand", started)
+	}
+
+	q.transform(params)
+	q.stage("transform", started)
+	return nil
+}
+
+// price converts the listing prices to the buyer's currency with the current rates, drops the
+// listings outside of the price range or charging with another rate method, and
+// estimates the cost of the listings for the hours or units asked for.
+func (q *QueryResult) price(rates *ExchangeRates, params *models.AdvancedSearchQuery) error {
+	currency := strings.ToUpper(params.Currency)
+	if currency == "" {
+		currency = NormalizedCurrency
+	}
+	ranged := params.MinPrice != nil || params.MaxPrice != nil
+	estimated := params.Hours > 0 || params.Units > 0
+	if params.Currency == "" && !ranged && !estimated && params.RateMethod == "" &&
+		params.Order != OrderPrice && params.Order != OrderPriceDesc {
+		return nil
+	}
+	if currency != NormalizedCurrency && !rates.Knows(currency) {
+		return fmt.Errorf("no exchange rate for %v", currency)
+	}
+	method := NormalizeRateMethod(params.RateMethod)
+	if params.RateMethod != "" && method == "" {
+		return fmt.Errorf("unknown rate method %v", params.RateMethod)
+	}
+
+	q.Currency = currency
+	q.Prices = make(map[string]float64)
+	q.RateMethods = make(map[string]string)
+	if estimated {
+		q.Estimates = make(map[string]float64)
+	}
+	docs := q.Results.Documents[:0]
+	for _, doc := range q.Results.Documents {
+		pricing, _ := lookupField(doc.ExportI(), "pricing")
+		docMethod, _ := lookupField(pricing, "rateMethod")
+		q.RateMethods[doc.ID], _ = docMethod.(string)
+		if method != "" && q.RateMethods[doc.ID] != method {
+			continue
+		}
+
+		amount, _ := lookupField(pricing, "amount")
+		docCurrency, _ := lookupField(pricing, "currency")
+		if amount, isNumber := amount.(float64); isNumber {
+			if docCurrency, ok := docCurrency.(string); ok && docCurrency != "" {
+				converted, err := rates.Convert(amount, docCurrency, currency)
+				if err == nil && !math.IsNaN(converted) && !math.IsInf(converted, 0) {
+					q.Prices[doc.ID] = converted
+				}
+			}
+		}
+
+		price, known := q.Prices[doc.ID]
+		if ranged && (!known || (params.MinPrice != nil && price < *params.MinPrice) || (params.MaxPrice != nil && price > *params.MaxPrice)) {
+			continue
+		}
+		if estimated && known {
+			if cost, ok := EstimateCost(q.RateMethods[doc.ID], price, params.Hours, params.Units); ok {
+				q.Estimates[doc.ID] = cost
+			}
+		}
+		docs = append(docs, doc)
+	}
+	q.Results.Documents = docs
+	q.Results.Count = len(docs)
+	return nil
+}
+
+// lessPrice orders listings by their estimated cost when one was asked for, otherwise
+// listings are grouped by rate method so only like priced listings are compared.
+func (q *QueryResult) lessPrice(a, b string, desc bool) bool {
+	var aPrice, bPrice float64
+	var aOk, bOk bool
+	if q.Estimates != nil {
+		aPrice, aOk = q.Estimates[a]
+		bPrice, bOk = q.Estimates[b]
+	} else {
+		if q.RateMethods[a] != q.RateMethods[b] {
+			return q.RateMethods[a] < q.RateMethods[b]
+		}
+		aPrice, aOk = q.Prices[a]
+		bPrice, bOk = q.Prices[b]
+	}
+
+	if aOk != bOk {
+		return aOk
+	}
+	if desc {
+		return aPrice > bPrice
+	}
+	return aPrice < bPrice
+}
+
+func (q *QueryResult) transform(params *models.AdvancedSearchQuery) {
+	if len(params.Transforms) != 0 {
+		d, _ := json.Marshal(params.Transforms)
+		q.Results.Transform(string(d))
+	}
+}
+
+// Data decodes the documents of the result, hits of a near query carry their
+// distance in meters from the query origin and priced queries carry the
+// "convertedPrice" and "estimatedCost" of the listings in the buyer's currency.
+// Expanded hits carry their "vendor".
+func (q *QueryResult) Data() []interface{} {
+	arr := []interface{}{}
+	for _, doc := range q.Results.Documents {
+		var i interface{}
+		_ = json.Unmarshal(doc.Content, &i)
+		if hit, isMap := i.(map[string]interface{}); isMap {
+			if d, ok := q.Distances[doc.ID]; ok {
+				hit["distance"] = d
+			}
+			if p, ok := q.Prices[doc.ID]; ok {
+				hit["convertedPrice"] = map[string]interface{}{"amount": p, "currency": q.Currency}
+			}
+			if e, ok := q.Estimates[doc.ID]; ok {
+				hit["estimatedCost"] = map[string]interface{}{"amount": e, "currency": q.Currency}
+			}
+			if v, ok := q.VendorOf[doc.ID]; ok {
+				hit["vendor"] = q.Vendors[v]
+			}
+		}
+		arr = append(arr, i)
+	}
+	return arr
+}
@@ -0,0 +1,43 @@
+package servicestore
+
+import (
+	"strings"
+)
+
+// The service rate methods listings are indexed with.
+const (
+	RateHourly  = "hourly"
+	RateFixed   = "fixed"
+	RatePerUnit = "per-unit"
+)
+
+// NormalizeRateMethod maps the ServiceRateMethod of a listing, like "HOURLY" or
+// "PER_UNIT", to one of the rate methods, empty if it isn't recognised.
+func NormalizeRateMethod(method string) string {
+	method = strings.ToLower(strings.TrimSpace(method))
+	method = strings.NewReplacer("_", "", "-", "", " ", "").Replace(method)
+
+	switch method {
+	case "hourly", "hour", "perhour":
+		return RateHourly
+	case "fixed", "flat", "flatrate", "fixedprice", "fixedrate":
+		return RateFixed
+	case "perunit", "unit", "unitary":
+		return RatePerUnit
+	}
+	return ""
+}
+
+// EstimateCost returns what a service priced at price with method costs for
+// hours of work or units of it.
+func EstimateCost(method string, price, hours, units float64) (float64, bool) {
+	switch method {
+	case RateFixed:
+		return price, true
+	case RateHourly:
+		return price * hours, hours > 0
+	case RatePerUnit:
+		return price * units, units > 0
+	}
+	return 0, false
+}
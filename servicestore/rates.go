@@ -0,0 +1,220 @@
+package servicestore
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kimitzu/kimitzu-services/models"
+)
+
+const (
+	// RateBase is the currency the rate providers express their rates against.
+	RateBase = "BTC"
+	// NormalizedCurrency is the currency prices are converted to when a query doesn't ask for one.
+	NormalizedCurrency = "USD"
+	// DefaultRatesTTL is how long fetched rates are used before fetching them again.
+	DefaultRatesTTL = time.Minute * 10
+	// DefaultRatesBackoff is how long a failed fetch is remembered before fetching again.
+	DefaultRatesBackoff = time.Second * 30
+)
+
+// cryptoCurrencies use 8 decimal places when the listing doesn't say otherwise, the rest are fiat with 2.
+var cryptoCurrencies = map[string]bool{
+	"BTC": true, "BCH": true, "LTC": true, "ZEC": true, "ETH": true,
+	"TBTC": true, "TBCH": true, "TLTC": true, "TZEC": true,
+}
+
+// RateProvider supplies exchange rates as the amount of each currency one RateBase is worth.
+type RateProvider interface {
+	Rates() (map[string]float64, error)
+}
+
+// NodeRateProvider reads the exchange rates of the OpenBazaar node.
+type NodeRateProvider struct {
+	URL    string
+	client *http.Client
+}
+
+// NewNodeRateProvider returns a provider reading from the local OpenBazaar node.
+func NewNodeRateProvider() *NodeRateProvider {
+	return &NodeRateProvider{
+		URL:    "http://localhost:8100/ob/exchangerates/" + RateBase,
+		client: &http.Client{Timeout: time.Second * 30},
+	}
+}
+
+func (p *NodeRateProvider) Rates() (map[string]float64, error) {
+	resp, err := p.client.Get(p.URL)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("exchange rates returned status %v", resp.StatusCode)
+	}
+
+	rates := make(map[string]float64)
+	if err := json.NewDecoder(resp.Body).Decode(&rates); err != nil {
+		return nil, fmt.Errorf("Failed to parse exchange rates: %v", err)
+	}
+	return rates, nil
+}
+
+// FileRateProvider reads the exchange rates from a JSON file like {"USD": 9500.5, "EUR": 8600.1},
+// it stands in for the node when there's none around, such as in tests.
+type FileRateProvider struct {
+	Path string
+}
+
+func (p *FileRateProvider) Rates() (map[string]float64, error) {
+	b, err := ioutil.ReadFile(p.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	rates := make(map[string]float64)
+	if err := json.Unmarshal(b, &rates); err != nil {
+		return nil, fmt.Errorf("Failed to parse exchange rates: %v", err)
+	}
+	return rates, nil
+}
+
+// ExchangeRates caches the rates of a RateProvider and converts between currencies.
+type ExchangeRates struct {
+	TTL     time.Duration
+	Backoff time.Duration
+
+	provider RateProvider
+	lock     *sync.Mutex
+	rates    map[string]float64
+	fetched  time.Time
+	err      error
+	failed   time.Time
+	// refreshing is closed once the fetch in flight is done, nil when there's none
+	refreshing chan struct{}
+}
+
+// NewExchangeRates returns ExchangeRates backed by provider.
+func NewExchangeRates(provider RateProvider) *ExchangeRates {
+	return &ExchangeRates{
+		TTL:      DefaultRatesTTL,
+		Backoff:  DefaultRatesBackoff,
+		provider: provider,
+		lock:     &sync.Mutex{},
+	}
+}
+
+// Rates returns the current rates. Expired rates are returned while they are fetched
+// again in the background, only the first call waits for the provider. A failed fetch
+// isn't retried for Backoff, the last known rates are kept meanwhile.
+func (e *ExchangeRates) Rates() (map[string]float64, error) {
+	e.lock.Lock()
+	if e.rates != nil && time.Since(e.fetched) < e.TTL {
+		defer e.lock.Unlock()
+		return e.rates, nil
+	}
+
+	backingOff := e.err != nil && time.Since(e.failed) < e.Backoff
+	if !backingOff && e.refreshing == nil {
+		e.refreshing = make(chan struct{})
+		go e.refresh(e.refreshing)
+	}
+	rates, err, refreshing := e.rates, e.err, e.refreshing
+	e.lock.Unlock()
+
+	if rates != nil {
+		return rates, nil
+	}
+	if refreshing == nil {
+		return nil, err
+	}
+
+	<-refreshing
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	if e.rates != nil {
+		return e.rates, nil
+	}
+	return nil, e.err
+}
+
+// refresh fetches the rates from the provider and closes done.
+func (e *ExchangeRates) refresh(done chan struct{}) {
+	rates, err := e.provider.Rates()
+
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	defer close(done)
+	e.refreshing = nil
+
+	if err != nil {
+		e.err, e.failed = err, time.Now()
+		return
+	}
+
+	normalized := make(map[string]float64)
+	for code, rate := range rates {
+		normalized[strings.ToUpper(code)] = rate
+	}
+	if _, exists := normalized[RateBase]; !exists {
+		normalized[RateBase] = 1
+	}
+	e.rates, e.fetched, e.err = normalized, time.Now(), nil
+}
+
+// Convert converts amount whole units of from into to.
+func (e *ExchangeRates) Convert(amount float64, from, to string) (float64, error) {
+	from, to = strings.ToUpper(from), strings.ToUpper(to)
+	if from == to {
+		return amount, nil
+	}
+
+	rates, err := e.Rates()
+	if err != nil {
+		return 0, err
+	}
+	fromRate, fromOk := rates[from]
+	toRate, toOk := rates[to]
+	if !fromOk || fromRate == 0 {
+		return 0, fmt.Errorf("no exchange rate for %v", from)
+	}
+	if !toOk {
+		return 0, fmt.Errorf("no exchange rate for %v", to)
+	}
+	return amount / fromRate * toRate, nil
+}
+
+// Knows checks whether there's a rate for currency.
+func (e *ExchangeRates) Knows(currency string) bool {
+	rates, err := e.Rates()
+	if err != nil {
+		return false
+	}
+	_, exists := rates[strings.ToUpper(currency)]
+	return exists
+}
+
+// NormalizePrice fills in the pricing of a listing, its price in whole units of its
+// pricing currency. It isn't converted here, the rates change long before the
+// listing is crawled again, so queries convert it with the rates they run with.
+func (m *MainManagedStorage) NormalizePrice(listing *models.ListingClass) {
+	currency := strings.ToUpper(listing.Metadata.PricingCurrency)
+	divisibility := float64(listing.Metadata.CoinDivisibility)
+	if divisibility <= 0 {
+		divisibility = 100
+		if cryptoCurrencies[currency] {
+			divisibility = 1e8
+		}
+	}
+
+	listing.Pricing = models.ListingPrice{
+		Amount:     float64(listing.Item.Price) / divisibility,
+		Currency:   currency,
+		RateMethod: NormalizeRateMethod(listing.Metadata.ServiceRateMethod),
+	}
+}
@@ -0,0 +1,226 @@
+package servicestore
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"os"
+	"path"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/nokusukun/go-menasai/chunk"
+	gomenasai "github.com/nokusukun/go-menasai/manager"
+
+	"github.com/kimitzu/kimitzu-services/models"
+)
+
+func testRates(t *testing.T) (*ExchangeRates, func()) {
+	dir, err := ioutil.TempDir("", "rates")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	file := path.Join(dir, "rates.json")
+	if err := ioutil.WriteFile(file, []byte(`{"USD": 10000, "eur": 8000, "ZEC": 200}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return NewExchangeRates(&FileRateProvider{Path: file}), func() { os.RemoveAll(dir) }
+}
+
+func TestExchangeRates(t *testing.T) {
+	rates, cleanup := testRates(t)
+	defer cleanup()
+
+	cases := []struct {
+		amount   float64
+		from, to string
+		expected float64
+	}{
+		{1, "BTC", "USD", 10000},
+		{100, "USD", "EUR", 80},
+		{2, "ZEC", "USD", 100},
+		{5, "USD", "usd", 5},
+	}
+	for _, c := range cases {
+		v, err := rates.Convert(c.amount, c.from, c.to)
+		if err != nil || math.Abs(v-c.expected) > 1e-9 {
+			t.Errorf("%v %v to %v: expected %v, got %v (%v)", c.amount, c.from, c.to, c.expected, v, err)
+		}
+	}
+
+	if _, err := rates.Convert(1, "XYZ", "USD"); err == nil {
+		t.Errorf("expected an unknown currency to fail")
+	}
+}
+
+// countingProvider counts its fetches, each one waits for release when it's set.
+type countingProvider struct {
+	lock    *sync.Mutex
+	fetches int
+	err     error
+	release chan struct{}
+}
+
+func (p *countingProvider) Rates() (map[string]float64, error) {
+	if p.release != nil {
+		<-p.release
+	}
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.fetches++
+	if p.err != nil {
+		return nil, p.err
+	}
+	return map[string]float64{"USD": 10000}, nil
+}
+
+func (p *countingProvider) count() int {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	return p.fetches
+}
+
+func TestExchangeRatesBackoff(t *testing.T) {
+	provider := &countingProvider{lock: &sync.Mutex{}, err: errors.New("node offline")}
+	rates := NewExchangeRates(provider)
+
+	for i := 0; i < 3; i++ {
+		if _, err := rates.Rates(); err == nil {
+			t.Fatal("expected the failed fetch to be reported")
+		}
+	}
+	if fetches := provider.count(); fetches != 1 {
+		t.Errorf("the failure wasn't cached, fetched %v times", fetches)
+	}
+
+	rates.Backoff = 0
+	provider.lock.Lock()
+	provider.err = nil
+	provider.lock.Unlock()
+	if _, err := rates.Rates(); err != nil {
+		t.Errorf("expected the rates once the backoff is over, got %v", err)
+	}
+}
+
+func TestExchangeRatesRefresh(t *testing.T) {
+	provider := &countingProvider{lock: &sync.Mutex{}, release: make(chan struct{})}
+	rates := NewExchangeRates(provider)
+
+	// Concurrent first calls share a single fetch
+	wg := &sync.WaitGroup{}
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := rates.Rates(); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	time.Sleep(time.Millisecond * 20)
+	provider.release <- struct{}{}
+	wg.Wait()
+	if fetches := provider.count(); fetches != 1 {
+		t.Errorf("expected a single fetch, got %v", fetches)
+	}
+
+	// Expired rates are served while they are fetched again
+	rates.TTL = 0
+	done := make(chan struct{})
+	go func() {
+		if r, err := rates.Rates(); err != nil || r["USD"] != 10000 {
+			t.Errorf("expected the stale rates, got %v (%v)", r, err)
+		}
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("waited for the refresh instead of serving the stale rates")
+	}
+	provider.release <- struct{}{}
+}
+
+func TestNormalizePrice(t *testing.T) {
+	rates, cleanup := testRates(t)
+	defer cleanup()
+	m := &MainManagedStorage{Rates: rates}
+
+	listing := &models.ListingClass{}
+	listing.Item.Price = 2500
+	listing.Metadata.PricingCurrency = "eur"
+	listing.Metadata.ServiceRateMethod = "HOURLY"
+	m.NormalizePrice(listing)
+	if listing.Pricing.Amount != 25 || listing.Pricing.Currency != "EUR" || listing.Pricing.RateMethod != RateHourly {
+		t.Errorf("unexpected pricing %+v", listing.Pricing)
+	}
+
+	listing = &models.ListingClass{}
+	listing.Item.Price = 50000000
+	listing.Metadata.PricingCurrency = "BTC"
+	m.NormalizePrice(listing)
+	if listing.Pricing.Amount != 0.5 || listing.Pricing.Currency != "BTC" {
+		t.Errorf("unexpected pricing %+v", listing.Pricing)
+	}
+}
+
+func TestQueryPrice(t *testing.T) {
+	hits := []map[string]interface{}{
+		{"pricing": map[string]interface{}{"amount": 25, "currency": "EUR", "rateMethod": RateHourly}},
+		{"pricing": map[string]interface{}{"amount": 0.01, "currency": "BTC", "rateMethod": RateHourly}},
+		{"pricing": map[string]interface{}{"amount": 5, "currency": "XYZ", "rateMethod": RateHourly}},
+	}
+	query := func(rates *ExchangeRates, params *models.AdvancedSearchQuery) *QueryResult {
+		results := &gomenasai.SearchResult{}
+		for i, hit := range hits {
+			content, _ := json.Marshal(hit)
+			results.Documents = append(results.Documents, &chunk.Document{ID: fmt.Sprint(i), Content: content})
+		}
+		q := &QueryResult{Results: results}
+		if err := q.price(rates, params); err != nil {
+			t.Fatal(err)
+		}
+		return q
+	}
+
+	// The prices follow the rates the query runs with, not the ones of the crawl
+	rates, cleanup := testRates(t)
+	defer cleanup()
+	q := query(rates, &models.AdvancedSearchQuery{Currency: "usd"})
+	if math.Abs(q.Prices["0"]-31.25) > 1e-9 || q.Prices["1"] != 100 || len(q.Prices) != 2 {
+		t.Errorf("unexpected prices %v", q.Prices)
+	}
+
+	file := path.Join(os.TempDir(), fmt.Sprintf("rates-%v.json", time.Now().UnixNano()))
+	if err := ioutil.WriteFile(file, []byte(`{"USD": 20000, "EUR": 10000}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(file)
+	maxPrice := 60.0
+	q = query(NewExchangeRates(&FileRateProvider{Path: file}), &models.AdvancedSearchQuery{MaxPrice: &maxPrice})
+	if q.Prices["0"] != 50 || q.Prices["1"] != 200 || q.Results.Count != 1 || q.Results.Documents[0].ID != "0" {
+		t.Errorf("unexpected prices %v and hits %v", q.Prices, q.Results.Count)
+	}
+}
+
+func TestRateMethods(t *testing.T) {
+	for method, expected := range map[string]string{"HOURLY": RateHourly, "Fixed": RateFixed, "PER_UNIT": RatePerUnit, "per-unit": RatePerUnit, "weekly": ""} {
+		if got := NormalizeRateMethod(method); got != expected {
+			t.Errorf("%v: expected %q, got %q", method, expected, got)
+		}
+	}
+
+	if cost, ok := EstimateCost(RateHourly, 20, 3, 0); !ok || cost != 60 {
+		t.Errorf("expected 3 hours at 20 to cost 60, got %v", cost)
+	}
+	if cost, ok := EstimateCost(RateFixed, 50, 3, 0); !ok || cost != 50 {
+		t.Errorf("expected a fixed price to cost 50, got %v", cost)
+	}
+	if _, ok := EstimateCost(RatePerUnit, 5, 3, 0); ok {
+		t.Errorf("expected no estimate for a per unit rate without units")
+	}
+}
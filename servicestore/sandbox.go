@@ -0,0 +1,331 @@
+package servicestore
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"text/scanner"
+	"time"
+
+	"github.com/PaesslerAG/gval"
+	"github.com/nokusukun/go-menasai/chunk"
+	gomenasai "github.com/nokusukun/go-menasai/manager"
+)
+
+const (
+	// DefaultFilterBudget is the amount of cost units a single query can spend evaluating its filters.
+	DefaultFilterBudget = 1000000
+	// DefaultFilterTimeout is how long the filters of a single query are allowed to run.
+	DefaultFilterTimeout = time.Second * 5
+
+	maxFilterLength    = 2048
+	maxFiltersPerQuery = 16
+	maxReportedErrors  = 10
+	filterCacheSize    = 256
+)
+
+// FilterFunctions is the whitelist of functions that filters can call, along with the cost
+// of a single call. The cost of a filter per document is 1 plus the cost of its calls.
+var FilterFunctions = map[string]int{
+	"date":            1,
+	"field":           1,
+	"exists":          1,
+	"anyIn":           1,
+	"contains":        1,
+	"containsInArr":   1,
+	"compareString":   1,
+	"asInt":           1,
+	"asFloat":         1,
+	"convertPrice":    1,
+	"like":            2,
+	"fuzzy":           4,
+	"zipWithin":       2,
+	"coordsWithin":    2,
+	"geoWithin":       2,
+	"locatedWithin":   2,
+	"inCategory":      2,
+	"hasProp":         2,
+	"getPropAsString": 2,
+	"getProfile":      50,
+}
+
+// FilterError is a problem found while compiling or evaluating a filter.
+type FilterError struct {
+	Filter  string `json:"filter"`
+	Message string `json:"message"`
+}
+
+func (e *FilterError) Error() string {
+	return fmt.Sprintf("%v: %v", e.Filter, e.Message)
+}
+
+// FilterTimeoutError is returned when the filters of a query run out of time.
+type FilterTimeoutError struct {
+	Timeout time.Duration
+}
+
+func (e *FilterTimeoutError) Error() string {
+	return fmt.Sprintf("filters took longer than %v to run", e.Timeout)
+}
+
+// CompiledFilter is a parsed and checked filter expression ready to be evaluated.
+type CompiledFilter struct {
+	Expression string
+	Cost       int
+	eval       gval.Evaluable
+}
+
+// FilterStats reports how the filters of a query went.
+type FilterStats struct {
+	// Remaining is the amount of documents left after each filter
+	Remaining  []int         `json:"remaining"`
+	Spent      int           `json:"spent"`
+	ErrorCount int           `json:"errorCount"`
+	Errors     []FilterError `json:"errors"`
+	// Durations is the time spent evaluating each filter
+	Durations []time.Duration `json:"-"`
+}
+
+// FilterEngine compiles and runs the client supplied filters, only the whitelisted
+// functions can be called and each query gets a limited budget and time to run them.
+type FilterEngine struct {
+	Budget  int
+	Timeout time.Duration
+
+	language gval.Language
+	lock     *sync.Mutex
+	cache    map[string]*CompiledFilter
+	order    []string
+}
+
+// NewFilterEngine returns a FilterEngine evaluating filters with language.
+func NewFilterEngine(language gval.Language) *FilterEngine {
+	return &FilterEngine{
+		Budget:   DefaultFilterBudget,
+		Timeout:  DefaultFilterTimeout,
+		language: language,
+		lock:     &sync.Mutex{},
+		cache:    make(map[string]*CompiledFilter),
+	}
+}
+
+// Compile parses and checks expr, compiled filters are cached so repeated filters are only parsed once.
+func (e *FilterEngine) Compile(expr string) (*CompiledFilter, error) {
+	e.lock.Lock()
+	cached, exists := e.cache[expr]
+	e.lock.Unlock()
+	if exists {
+		return cached, nil
+	}
+
+	if len(expr) > maxFilterLength {
+		return nil, &FilterError{expr, fmt.Sprintf("filter is longer than %v characters", maxFilterLength)}
+	}
+
+	cost, err := filterCost(expr)
+	if err != nil {
+		return nil, &FilterError{expr, err.Error()}
+	}
+
+	eval, err := e.language.NewEvaluable(expr)
+	if err != nil {
+		return nil, &FilterError{expr, err.Error()}
+	}
+
+	// Constant expressions and ones that don't resolve to a boolean can be
+	// caught early by evaluating them against an empty document. Errors
+	// are expected here since the fields don't exist.
+	v, err := probeFilter(eval)
+	if p, panicked := err.(filterPanic); panicked {
+		return nil, &FilterError{expr, fmt.Sprintf("filter failed to run: %v", p.value)}
+	}
+	if err == nil && v != nil {
+		if _, isBool := v.(bool); !isBool {
+			return nil, &FilterError{expr, fmt.Sprintf("filter must evaluate to a boolean, got %T", v)}
+		}
+	}
+
+	compiled := &CompiledFilter{Expression: expr, Cost: cost, eval: eval}
+
+	e.lock.Lock()
+	if _, exists := e.cache[expr]; !exists {
+		if len(e.order) >= filterCacheSize {
+			delete(e.cache, e.order[0])
+			e.order = e.order[1:]
+		}
+		e.cache[expr] = compiled
+		e.order = append(e.order, expr)
+	}
+	e.lock.Unlock()
+
+	return compiled, nil
+}
+
+// filterPanic is the error of a filter that panicked while being probed.
+type filterPanic struct {
+	value interface{}
+}
+
+func (p filterPanic) Error() string {
+	return fmt.Sprint(p.value)
+}
+
+// probeFilter evaluates eval against an empty document, turning a panic into a filterPanic.
+func probeFilter(eval gval.Evaluable) (v interface{}, err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			err = filterPanic{p}
+		}
+	}()
+	return eval(context.Background(), emptyDocument())
+}
+
+// CompileAll compiles every filter of a query, returning all of the errors found.
+func (e *FilterEngine) CompileAll(exprs []string) ([]*CompiledFilter, []FilterError) {
+	var errs []FilterError
+	if len(exprs) > maxFiltersPerQuery {
+		return nil, []FilterError{{"", fmt.Sprintf("a query can have at most %v filters", maxFiltersPerQuery)}}
+	}
+
+	compiled := []*CompiledFilter{}
+	for _, expr := range exprs {
+		f, err := e.Compile(expr)
+		if err != nil {
+			errs = append(errs, *err.(*FilterError))
+			continue
+		}
+		compiled = append(compiled, f)
+	}
+	return compiled, errs
+}
+
+// Apply drops the documents of results that don't pass every filter. Documents that
+// fail to evaluate are dropped as well and reported in the stats. Running out of
+// budget aborts the query, running out of time aborts it with a FilterTimeoutError
+// even in the middle of a document.
+func (e *FilterEngine) Apply(ctx context.Context, results *gomenasai.SearchResult, filters []*CompiledFilter) (*FilterStats, error) {
+	if len(filters) == 0 {
+		return newFilterStats(0), nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, e.Timeout)
+	defer cancel()
+
+	type applied struct {
+		docs  []*chunk.Document
+		stats *FilterStats
+		err   error
+	}
+	done := make(chan applied, 1)
+	go func() {
+		// gval doesn't recover the panics of the filter functions, and nothing up this goroutine would
+		defer func() {
+			if p := recover(); p != nil {
+				done <- applied{nil, newFilterStats(len(filters)), &FilterError{"", fmt.Sprintf("a filter failed to run: %v", p)}}
+			}
+		}()
+		docs, stats, err := e.apply(ctx, results.Documents, filters)
+		done <- applied{docs, stats, err}
+	}()
+
+	select {
+	case a := <-done:
+		if a.err == nil {
+			results.Documents = a.docs
+			results.Count = len(a.docs)
+		}
+		return a.stats, a.err
+	case <-ctx.Done():
+		// The evaluation stops at the next document, its results are dropped
+		return newFilterStats(len(filters)), &FilterTimeoutError{e.Timeout}
+	}
+}
+
+func newFilterStats(filters int) *FilterStats {
+	return &FilterStats{
+		Remaining: make([]int, filters),
+		Errors:    []FilterError{},
+		Durations: make([]time.Duration, filters),
+	}
+}
+
+// apply returns the documents passing every filter, the documents given aren't modified.
+func (e *FilterEngine) apply(ctx context.Context, documents []*chunk.Document, filters []*CompiledFilter) ([]*chunk.Document, *FilterStats, error) {
+	stats := newFilterStats(len(filters))
+	docs := make([]*chunk.Document, 0, len(documents))
+	for _, doc := range documents {
+		if ctx.Err() != nil {
+			return nil, stats, &FilterTimeoutError{e.Timeout}
+		}
+
+		parameter := map[string]interface{}{"doc": doc.ExportI()}
+		passed := true
+		for i, filter := range filters {
+			stats.Spent += filter.Cost
+			if stats.Spent > e.Budget {
+				return nil, stats, fmt.Errorf("filters exceeded the evaluation budget of %v", e.Budget)
+			}
+
+			started := time.Now()
+			v, err := filter.eval(ctx, parameter)
+			stats.Durations[i] += time.Since(started)
+			if err != nil {
+				stats.ErrorCount++
+				if len(stats.Errors) < maxReportedErrors {
+					stats.Errors = append(stats.Errors, FilterError{filter.Expression, err.Error()})
+				}
+				passed = false
+				break
+			}
+
+			if v != nil {
+				if _, isBool := v.(bool); !isBool {
+					return nil, stats, &FilterError{filter.Expression, fmt.Sprintf("filter must evaluate to a boolean, got %T", v)}
+				}
+			}
+			if v != true {
+				passed = false
+				break
+			}
+			stats.Remaining[i]++
+		}
+
+		if passed {
+			docs = append(docs, doc)
+		}
+	}
+	return docs, stats, nil
+}
+
+// filterCost checks that expr only calls whitelisted functions and
+// returns the cost of evaluating it against a single document.
+func filterCost(expr string) (int, error) {
+	var s scanner.Scanner
+	s.Init(strings.NewReader(expr))
+	s.Mode = scanner.GoTokens
+	// Syntax errors are reported by the parser
+	s.Error = func(*scanner.Scanner, string) {}
+
+	cost := 1
+	var prev, prevPrev rune
+	var prevText string
+	for tok := s.Scan(); tok != scanner.EOF; tok = s.Scan() {
+		if tok == '(' && prev == scanner.Ident {
+			if prevPrev == '.' {
+				return 0, fmt.Errorf("calling %v is not allowed", prevText)
+			}
+			fnCost, allowed := FilterFunctions[prevText]
+			if !allowed {
+				return 0, fmt.Errorf("unknown function %v", prevText)
+			}
+			cost += fnCost
+		}
+		prevPrev, prev, prevText = prev, tok, s.TokenText()
+	}
+	return cost, nil
+}
+
+func emptyDocument() map[string]interface{} {
+	return map[string]interface{}{"doc": map[string]interface{}{}}
+}
@@ -0,0 +1,143 @@
+package servicestore
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/PaesslerAG/gval"
+	"github.com/nokusukun/go-menasai/chunk"
+	gomenasai "github.com/nokusukun/go-menasai/manager"
+)
+
+func TestFilterCost(t *testing.T) {
+	cost, err := filterCost(`contains(doc.title, "x") && getProfile(doc.vendorID.peerID) != nil`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := 1 + FilterFunctions["contains"] + FilterFunctions["getProfile"]; cost != expected {
+		t.Errorf("expected cost %v, got %v", expected, cost)
+	}
+
+	for _, expr := range []string{`exec("rm")`, `doc.title.upper() == "X"`} {
+		if _, err := filterCost(expr); err == nil {
+			t.Errorf("expected %v to be rejected", expr)
+		}
+	}
+
+	// Calls inside strings aren't calls
+	if _, err := filterCost(`doc.title == "exec()"`); err != nil {
+		t.Errorf("unexpected error %v", err)
+	}
+}
+
+func TestFilterCompile(t *testing.T) {
+	engine := NewFilterEngine(filterLanguage())
+
+	if _, err := engine.Compile(`doc.price.amount > 10`); err != nil {
+		t.Errorf("unexpected error %v", err)
+	}
+	for _, expr := range []string{`1 + 2`, `doc.price.amount >`, `"text"`,
+		`doc.title =~ "(a+)+$"`, `doc.title !~ "a"`, `(doc.x | 1) == 1`, `doc.x ? true : false`, `doc.x ?? true`} {
+		if _, err := engine.Compile(expr); err == nil {
+			t.Errorf("expected %v to fail to compile", expr)
+		}
+	}
+
+	first, _ := engine.Compile(`doc.x == 1`)
+	second, _ := engine.Compile(`doc.x == 1`)
+	if first != second {
+		t.Errorf("expected compiled filters to be cached")
+	}
+}
+
+func TestFilterLanguage(t *testing.T) {
+	engine := NewFilterEngine(filterLanguage())
+	doc := map[string]interface{}{"doc": map[string]interface{}{
+		"title": "Plumbing", "price": 25.0, "type": "SERVICE", "since": "2019-05-01",
+	}}
+
+	for _, expr := range []string{
+		`doc.price * 2 + 1 == 51`,
+		`doc.title + "!" == "Plumbing!" && doc.title > "A"`,
+		`!(doc.price < 10) || false`,
+		`doc.type in ["SERVICE", "DIGITAL_GOOD"]`,
+		`date(doc.since) == date("2019-05-01")`,
+	} {
+		filter, err := engine.Compile(expr)
+		if err != nil {
+			t.Errorf("%v: %v", expr, err)
+			continue
+		}
+		if v, err := filter.eval(context.Background(), doc); err != nil || v != true {
+			t.Errorf("%v: expected true, got %v (%v)", expr, v, err)
+		}
+	}
+}
+
+func TestFilterTimeout(t *testing.T) {
+	FilterFunctions["slow"] = 1
+	defer delete(FilterFunctions, "slow")
+
+	engine := NewFilterEngine(filterLanguage(gval.Function("slow", func() bool {
+		time.Sleep(time.Millisecond * 200)
+		return true
+	})))
+	engine.Timeout = time.Millisecond * 20
+
+	filter, err := engine.Compile(`slow()`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	results := &gomenasai.SearchResult{Documents: []*chunk.Document{{ID: "a", Content: []byte(`{}`)}}}
+
+	started := time.Now()
+	_, err = engine.Apply(context.Background(), results, []*CompiledFilter{filter})
+	if _, ok := err.(*FilterTimeoutError); !ok {
+		t.Errorf("expected a FilterTimeoutError, got %v", err)
+	}
+	if elapsed := time.Since(started); elapsed > time.Millisecond*100 {
+		t.Errorf("the timeout took %v to be noticed", elapsed)
+	}
+	if len(results.Documents) != 1 {
+		t.Errorf("expected the results to be left alone, got %v", len(results.Documents))
+	}
+}
+
+func TestFilterPanic(t *testing.T) {
+	FilterFunctions["explode"] = 1
+	defer delete(FilterFunctions, "explode")
+
+	engine := NewFilterEngine(filterLanguage(gval.Function("explode", func(v interface{}) bool {
+		if v != nil {
+			panic("exploded")
+		}
+		return true
+	})))
+
+	if _, err := engine.Compile(`explode(1)`); err == nil {
+		t.Error("expected a filter panicking on the empty document to be rejected")
+	}
+
+	filter, err := engine.Compile(`explode(doc.item)`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	results := &gomenasai.SearchResult{Documents: []*chunk.Document{{ID: "a", Content: []byte(`{"item": {}}`)}}}
+	if _, err := engine.Apply(context.Background(), results, []*CompiledFilter{filter}); err == nil {
+		t.Error("expected the panic of the filter to be returned as an error")
+	}
+	if len(results.Documents) != 1 {
+		t.Errorf("expected the results to be left alone, got %v", len(results.Documents))
+	}
+
+	engine = NewFilterEngine(LoadCustomEngine(nil))
+	filter, err = engine.Compile(`containsInArr(doc.item.images, "x")`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	results = &gomenasai.SearchResult{Documents: []*chunk.Document{{ID: "a", Content: []byte(`{"item": {"images": [{"small": "x"}, "x"]}}`)}}}
+	if _, err := engine.Apply(context.Background(), results, []*CompiledFilter{filter}); err != nil || len(results.Documents) != 1 {
+		t.Errorf("expected containsInArr to skip the values that aren't strings, got %v", err)
+	}
+}
@@ -1,12 +1,15 @@
 package servicestore
 
 import (
+	"context"
 	"fmt"
 	"path"
     "sync"
+	"sync/atomic"
 
 	gomenasai "github.com/nokusukun/go-menasai/manager"
 
+	"github.com/kimitzu/kimitzu-services/health"
 	"github.com/kimitzu/kimitzu-services/models"
 )
 
@@ -24,6 +27,18 @@ type MainManagedStorage struct {
 	PeerData  *gomenasai.Gomenasai
 	Listings  *gomenasai.Gomenasai
 	StorePath string
+
+	Suggestions *SuggestIndex
+	GeoIndex    *ListingGeoIndex
+	Categories  *CategoryIndex
+	Profiles    *ProfileIndex
+	Filters     *FilterEngine
+	Snapshots   *SnapshotStore
+	Rates       *ExchangeRates
+	// Presence is set once voyager starts checking the peers
+	Presence    Presence
+
+	closed int32
 }
 
 func (m *MainManagedStorage) SafePMapModify(function func()) {
@@ -38,6 +53,37 @@ func (m *MainManagedStorage) PMapSet(id, val string) {
     })
 }
 
+// Close commits the listings and the peers and closes their stores.
+func (m *MainManagedStorage) Close() error {
+	atomic.StoreInt32(&m.closed, 1)
+	for _, db := range []*gomenasai.Gomenasai{m.Listings, m.PeerData} {
+		if err := db.Commit(); err != nil {
+			return err
+		}
+		if err := db.Close(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// HealthCheck reports the stores down once they are closed.
+func (m *MainManagedStorage) HealthCheck() health.Check {
+	return health.Check{Name: "store", Required: true, Probe: func(ctx context.Context) (health.Details, error) {
+		if atomic.LoadInt32(&m.closed) == 1 {
+			return nil, fmt.Errorf("the stores are closed")
+		}
+		if m.Listings == nil || m.PeerData == nil {
+			return nil, fmt.Errorf("the stores aren't open")
+		}
+
+		m.PMapLock.RLock()
+		peers := len(m.PMap)
+		m.PMapLock.RUnlock()
+		return health.Details{"peers": peers}, nil
+	}}
+}
+
 // InitializeManagedStorage - Initializes and returns a MainStorage instance,
 // 		pass this around the various services, acts as like the centraliezd
 // 		storage for the listings and Peer Data
@@ -46,6 +92,12 @@ func InitializeManagedStorage(rootPath string) *MainManagedStorage {
     store.PMapLock = &sync.RWMutex{}
     store.PMap = make(map[string]string)
 	store.StorePath = rootPath
+	store.Suggestions = NewSuggestIndex()
+	store.GeoIndex = NewListingGeoIndex()
+	store.Categories = NewCategoryIndex()
+	store.Profiles = NewProfileIndex()
+	store.Snapshots = NewSnapshotStore()
+	store.Rates = NewExchangeRates(NewNodeRateProvider())
 
 	peerStorePath := path.Join(rootPath, "data", "peers")
 	listingStorePath := path.Join(rootPath, "data", "listings")
@@ -97,6 +149,7 @@ func InitializeManagedStorage(rootPath string) *MainManagedStorage {
 	}
 
     store.Listings.OverrideEvalEngine(LoadCustomEngine(&store))
+	store.Filters = NewFilterEngine(LoadCustomEngine(&store))
 
 	return &store
 }
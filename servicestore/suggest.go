@@ -0,0 +1,261 @@
+package servicestore
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	gomenasai "github.com/nokusukun/go-menasai/manager"
+
+	"github.com/kimitzu/kimitzu-services/models"
+)
+
+const (
+	// DefaultSuggestLimit is the amount of completions returned when none is specified.
+	DefaultSuggestLimit = 10
+)
+
+// Suggestion is a single autocomplete entry, Count is how many times
+// the term was seen in the indexed listings and profiles.
+type Suggestion struct {
+	Text     string `json:"text"`
+	Count    int    `json:"count"`
+	Distance int    `json:"distance"`
+}
+
+// SuggestIndex holds the frequency table of the words and phrases found in
+// listing titles, tags, categories and vendor names. The table is
+// kept sorted so prefix lookups are a binary search away, which keeps
+// it cheap enough to be queried on every keystroke.
+type SuggestIndex struct {
+	lock      *sync.RWMutex
+	terms     []Suggestion
+	known     map[string]int
+	refresher *refresher
+}
+
+// NewSuggestIndex returns an empty SuggestIndex, it gets populated on the first Refresh.
+func NewSuggestIndex() *SuggestIndex {
+	return &SuggestIndex{
+		lock:      &sync.RWMutex{},
+		known:     make(map[string]int),
+		refresher: newRefresher(),
+	}
+}
+
+// Invalidate flags the index as stale, it gets rebuilt in the background
+// on the next lookup.
+func (s *SuggestIndex) Invalidate() {
+	s.refresher.invalidate()
+}
+
+// Refresh rebuilds the frequency table from the contents of the store.
+func (s *SuggestIndex) Refresh(m *MainManagedStorage) {
+	counts := make(map[string]int)
+	add := func(text string, words bool) {
+		text = normalizeTerm(text)
+		if text == "" {
+			return
+		}
+		counts[text]++
+		if words {
+			for _, w := range strings.Fields(text) {
+				if w != text && len([]rune(w)) > 1 {
+					counts[w]++
+				}
+			}
+		}
+	}
+
+	listings := m.Listings.Search("")
+	for _, doc := range listings.Documents {
+		listing := models.ListingClass{}
+		if err := doc.Export(&listing); err != nil {
+			continue
+		}
+		add(listing.Item.Title, true)
+		for _, tag := range listing.Item.Tags {
+			add(tag, false)
+		}
+		for _, category := range listing.Item.Categories {
+			add(category, false)
+		}
+	}
+
+	peers := m.PeerData.Search("")
+	for _, doc := range peers.Documents {
+		peer := models.Peer{}
+		if err := doc.Export(&peer); err != nil {
+			continue
+		}
+		if name, ok := peer.RawMap["name"].(string); ok {
+			add(name, true)
+		}
+	}
+
+	terms := make([]Suggestion, 0, len(counts))
+	for text, count := range counts {
+		terms = append(terms, Suggestion{Text: text, Count: count})
+	}
+	sort.Slice(terms, func(i, j int) bool {
+		return terms[i].Text < terms[j].Text
+	})
+
+	s.lock.Lock()
+	s.terms = terms
+	s.known = counts
+	s.lock.Unlock()
+}
+
+// refreshIfDirty kicks off a rebuild when the index is stale, lookups keep
+// being served from the previous table in the meantime.
+func (s *SuggestIndex) refreshIfDirty(m *MainManagedStorage) {
+	s.refresher.refresh(func() { s.Refresh(m) })
+}
+
+// Suggest returns up to limit completions for the prefix q. Exact prefix matches
+// come first ranked by frequency, followed by completions of prefixes that
+// are within the allowed edit distance of q and start with the same letter.
+func (s *SuggestIndex) Suggest(q string, limit int) []Suggestion {
+	q = normalizeTerm(q)
+	if limit <= 0 {
+		limit = DefaultSuggestLimit
+	}
+
+	result := []Suggestion{}
+	if q == "" {
+		return result
+	}
+
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	start := sort.Search(len(s.terms), func(i int) bool {
+		return s.terms[i].Text >= q
+	})
+
+	seen := make(map[string]bool)
+	for i := start; i < len(s.terms) && strings.HasPrefix(s.terms[i].Text, q); i++ {
+		result = append(result, s.terms[i])
+		seen[s.terms[i].Text] = true
+	}
+
+	max := maxEdits(q)
+	if max > 0 {
+		for _, term := range s.candidates(q, max) {
+			if seen[term.Text] {
+				continue
+			}
+			if d := prefixDistance(q, term.Text, max); d <= max {
+				term.Distance = d
+				result = append(result, term)
+			}
+		}
+	}
+
+	sort.SliceStable(result, func(i, j int) bool {
+		if result[i].Distance != result[j].Distance {
+			return result[i].Distance < result[j].Distance
+		}
+		return result[i].Count > result[j].Count
+	})
+
+	if len(result) > limit {
+		result = result[:limit]
+	}
+	return result
+}
+
+// candidates returns the terms worth running prefixDistance against for q: the ones
+// starting with the same letter as q, which are a single range of the sorted table,
+// and long enough to have a prefix within max edits of q. Like most autocompletion,
+// typos in the first letter aren't corrected.
+func (s *SuggestIndex) candidates(q string, max int) []Suggestion {
+	first, _ := utf8.DecodeRuneInString(q)
+	lead := string(first)
+	start := sort.Search(len(s.terms), func(i int) bool {
+		return s.terms[i].Text >= lead
+	})
+
+	minLength := utf8.RuneCountInString(q) - max
+	terms := []Suggestion{}
+	for i := start; i < len(s.terms) && strings.HasPrefix(s.terms[i].Text, lead); i++ {
+		if utf8.RuneCountInString(s.terms[i].Text) >= minLength {
+			terms = append(terms, s.terms[i])
+		}
+	}
+	return terms
+}
+
+// Correct replaces every word of query that is not in the index with the most
+// frequent indexed word within the allowed edit distance.
+func (s *SuggestIndex) Correct(query string) string {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	words := strings.Fields(strings.ToLower(query))
+	for i, word := range words {
+		if _, ok := s.known[word]; ok {
+			continue
+		}
+		max := maxEdits(word)
+		if max == 0 {
+			continue
+		}
+
+		best, bestDist, bestCount := "", max+1, 0
+		for _, term := range s.terms {
+			if strings.Contains(term.Text, " ") {
+				continue
+			}
+			d := editDistance(word, term.Text, max)
+			if d < bestDist || (d == bestDist && term.Count > bestCount) {
+				best, bestDist, bestCount = term.Text, d, term.Count
+			}
+		}
+		if best != "" {
+			words[i] = best
+		}
+	}
+	return strings.Join(words, " ")
+}
+
+func normalizeTerm(text string) string {
+	return strings.Join(strings.Fields(strings.ToLower(text)), " ")
+}
+
+// Suggest returns autocomplete entries for q drawn from the indexed listings and profiles.
+func (m *MainManagedStorage) Suggest(q string, limit int) []Suggestion {
+	m.Suggestions.refreshIfDirty(m)
+	return m.Suggestions.Suggest(q, limit)
+}
+
+// SearchListings runs the keyword search over the listings, if fuzzy is set
+// the words of the query are corrected against the suggestion index and
+// the hits of the corrected query are merged into the result.
+func (m *MainManagedStorage) SearchListings(query string, fuzzy bool) *gomenasai.SearchResult {
+	results := m.Listings.Search(query)
+	if !fuzzy || strings.TrimSpace(query) == "" {
+		return results
+	}
+
+	m.Suggestions.refreshIfDirty(m)
+	corrected := m.Suggestions.Correct(query)
+	if corrected == normalizeTerm(query) {
+		return results
+	}
+
+	seen := make(map[string]bool)
+	for _, doc := range results.Documents {
+		seen[doc.ID] = true
+	}
+	for _, doc := range m.Listings.Search(corrected).Documents {
+		if !seen[doc.ID] {
+			results.Documents = append(results.Documents, doc)
+			seen[doc.ID] = true
+		}
+	}
+	results.Count = len(results.Documents)
+	return results
+}
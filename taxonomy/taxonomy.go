@@ -0,0 +1,204 @@
+package taxonomy
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/gobuffalo/packr/v2"
+	"github.com/nokusukun/particles/roggy"
+)
+
+const taxonomyFile = "taxonomy.json"
+
+// pathSeparators split a classification like "Home Services > Plumbing > Emergency" into node names.
+var pathSeparators = regexp.MustCompile(`\s*[>/:]\s*`)
+
+// Node is a service category, Code is its stable identifier and Aliases are other
+// names a listing's serviceClassification can use to refer to it.
+type Node struct {
+	Code     string   `json:"code"`
+	Name     string   `json:"name"`
+	Aliases  []string `json:"aliases,omitempty"`
+	Children []*Node  `json:"children,omitempty"`
+}
+
+// Taxonomy is a versioned tree of service categories.
+type Taxonomy struct {
+	Version int64   `json:"version"`
+	Source  string  `json:"source"`
+	Nodes   []*Node `json:"nodes"`
+
+	byCode map[string]*Node
+	parent map[string]string
+	lookup map[string]string
+}
+
+var (
+	taxonomyLock = &sync.RWMutex{}
+	current      = &Taxonomy{Source: "none"}
+)
+
+func init() {
+	current.index()
+}
+
+// index builds the lookup tables of t, rejecting duplicated codes.
+func (t *Taxonomy) index() error {
+	t.byCode = make(map[string]*Node)
+	t.parent = make(map[string]string)
+	t.lookup = make(map[string]string)
+
+	names := make(map[string][]string)
+	var walk func(nodes []*Node, parent string, trail []string) error
+	walk = func(nodes []*Node, parent string, trail []string) error {
+		for _, node := range nodes {
+			if node.Code == "" {
+				return fmt.Errorf("node %q has no code", node.Name)
+			}
+			if _, exists := t.byCode[node.Code]; exists {
+				return fmt.Errorf("duplicated node code %v", node.Code)
+			}
+			t.byCode[node.Code] = node
+			t.parent[node.Code] = parent
+
+			nodePath := append(append([]string{}, trail...), node.Name)
+			t.lookup[normalize(node.Code)] = node.Code
+			t.lookup[normalize(strings.Join(nodePath, ">"))] = node.Code
+			for _, name := range append([]string{node.Name}, node.Aliases...) {
+				names[normalize(name)] = append(names[normalize(name)], node.Code)
+			}
+
+			if err := walk(node.Children, node.Code, nodePath); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if err := walk(t.Nodes, "", nil); err != nil {
+		return err
+	}
+
+	// Bare names only resolve if they are unique, "Emergency" alone is ambiguous
+	for name, codes := range names {
+		if _, exists := t.lookup[name]; !exists && len(codes) == 1 {
+			t.lookup[name] = codes[0]
+		}
+	}
+	return nil
+}
+
+func normalize(s string) string {
+	return strings.ToLower(pathSeparators.ReplaceAllString(strings.TrimSpace(s), ">"))
+}
+
+// Get returns the node with code.
+func (t *Taxonomy) Get(code string) (*Node, bool) {
+	node, exists := t.byCode[code]
+	return node, exists
+}
+
+// Resolve returns the code of the node a classification refers to, be it a
+// code, a path of names like "Home Services > Plumbing" or a unique name.
+func (t *Taxonomy) Resolve(classification string) (string, bool) {
+	code, exists := t.lookup[normalize(classification)]
+	return code, exists
+}
+
+// Path returns the nodes from the root of the tree down to code.
+func (t *Taxonomy) Path(code string) []*Node {
+	var nodes []*Node
+	for code != "" {
+		node, exists := t.byCode[code]
+		if !exists {
+			break
+		}
+		nodes = append([]*Node{node}, nodes...)
+		code = t.parent[code]
+	}
+	return nodes
+}
+
+// Ancestors returns code along with the codes of all of its parents.
+func (t *Taxonomy) Ancestors(code string) []string {
+	var codes []string
+	for _, node := range t.Path(code) {
+		codes = append(codes, node.Code)
+	}
+	return codes
+}
+
+// Within checks whether the classification of a listing falls under the node with code.
+func (t *Taxonomy) Within(classification, code string) bool {
+	resolved, exists := t.Resolve(classification)
+	for exists && resolved != "" {
+		if resolved == code {
+			return true
+		}
+		resolved = t.parent[resolved]
+	}
+	return false
+}
+
+// Current returns the taxonomy in use.
+func Current() *Taxonomy {
+	taxonomyLock.RLock()
+	defer taxonomyLock.RUnlock()
+	return current
+}
+
+// Load loads the taxonomy from the data directory under root if it is newer
+// than the bundled one, otherwise the bundled taxonomy is used.
+func Load(log *roggy.LogPrinter, root string) error {
+	bundled, err := readBundled()
+	if err != nil {
+		return err
+	}
+
+	t := bundled
+	if stored, err := readFile(path.Join(root, taxonomyFile)); err == nil && stored.Version > bundled.Version {
+		t = stored
+	} else if err != nil && !os.IsNotExist(err) {
+		log.Errorf("Ignoring the taxonomy in the data directory: %v", err)
+	}
+
+	taxonomyLock.Lock()
+	current = t
+	taxonomyLock.Unlock()
+	log.Infof("Loaded %v service categories from %v taxonomy version %v", len(t.byCode), t.Source, t.Version)
+	return nil
+}
+
+func parse(b []byte, source string) (*Taxonomy, error) {
+	t := &Taxonomy{}
+	if err := json.Unmarshal(b, t); err != nil {
+		return nil, fmt.Errorf("Failed to parse taxonomy: %v", err)
+	}
+	t.Source = source
+	if err := t.index(); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+func readBundled() (*Taxonomy, error) {
+	box := packr.New("external2", "../external")
+	b, err := box.Find(taxonomyFile)
+	if err != nil {
+		return nil, fmt.Errorf("No bundled taxonomy found: %v", err)
+	}
+	return parse(b, "bundled")
+}
+
+func readFile(file string) (*Taxonomy, error) {
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	return parse(b, file)
+}
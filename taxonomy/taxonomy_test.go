@@ -0,0 +1,59 @@
+package taxonomy
+
+import (
+	"testing"
+)
+
+func TestTaxonomy(t *testing.T) {
+	tax, err := parse([]byte(`{"version": 1, "nodes": [
+		{"code": "home", "name": "Home Services", "children": [
+			{"code": "home.plumbing", "name": "Plumbing", "children": [
+				{"code": "home.plumbing.emergency", "name": "Emergency"}
+			]},
+			{"code": "home.electrical", "name": "Electrical", "aliases": ["Electrician"], "children": [
+				{"code": "home.electrical.emergency", "name": "Emergency"}
+			]}
+		]}
+	]}`), "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resolved := map[string]string{
+		"home.plumbing":                        "home.plumbing",
+		"Home Services > Plumbing > Emergency": "home.plumbing.emergency",
+		"home services/plumbing":               "home.plumbing",
+		"Electrician":                          "home.electrical",
+		"Emergency":                            "",
+		"Gardening":                            "",
+	}
+	for classification, expected := range resolved {
+		if code, _ := tax.Resolve(classification); code != expected {
+			t.Errorf("%v: expected %q, got %q", classification, expected, code)
+		}
+	}
+
+	if !tax.Within("Home Services > Plumbing > Emergency", "home") {
+		t.Errorf("expected an emergency plumber to be within home services")
+	}
+	if tax.Within("Electrician", "home.plumbing") {
+		t.Errorf("expected an electrician not to be within plumbing")
+	}
+	if ancestors := tax.Ancestors("home.plumbing.emergency"); len(ancestors) != 3 || ancestors[0] != "home" {
+		t.Errorf("unexpected ancestors %v", ancestors)
+	}
+
+	if _, err := parse([]byte(`{"nodes": [{"code": "a", "name": "A"}, {"code": "a", "name": "B"}]}`), "test"); err == nil {
+		t.Errorf("expected duplicated codes to be rejected")
+	}
+}
+
+func TestBundledTaxonomy(t *testing.T) {
+	tax, err := readFile("../external/taxonomy.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if code, _ := tax.Resolve("Home Services > Plumbing > Emergency"); code != "home.plumbing.emergency" {
+		t.Errorf("expected the bundled taxonomy to have emergency plumbing, got %q", code)
+	}
+}
@@ -0,0 +1,263 @@
+package tokens
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// ScopeRead allows the read only routes, searching and browsing the stores.
+	ScopeRead = "read"
+	// ScopeRatings allows publishing ratings.
+	ScopeRatings = "ratings"
+	// ScopeAdmin allows every route, including managing the tokens.
+	ScopeAdmin = "admin"
+
+	// Prefix starts every token so they can be told apart from the node's auth cookie.
+	Prefix = "kmz_"
+
+	tokensFile = "tokens.json"
+	saltSize   = 16
+	secretSize = 32
+	idSize     = 8
+)
+
+// Scopes are the scopes a token can be issued with.
+var Scopes = []string{ScopeRead, ScopeRatings, ScopeAdmin}
+
+// Token is an issued API token, only a salted hash of its secret is kept.
+type Token struct {
+	ID      string   `json:"id"`
+	Name    string   `json:"name"`
+	Scopes  []string `json:"scopes"`
+	Created int64    `json:"created"`
+	// Expires is the unix time the token stops working at, 0 if it never does
+	Expires  int64 `json:"expires"`
+	LastUsed int64 `json:"lastUsed"`
+
+	Salt string `json:"salt,omitempty"`
+	Hash string `json:"hash,omitempty"`
+}
+
+// Expired returns whether the token stopped working at now.
+func (t *Token) Expired(now time.Time) bool {
+	return t.Expires != 0 && now.Unix() >= t.Expires
+}
+
+// Allows returns whether the token grants scope, admin tokens grant every scope.
+func (t *Token) Allows(scope string) bool {
+	for _, s := range t.Scopes {
+		if s == scope || s == ScopeAdmin {
+			return true
+		}
+	}
+	return false
+}
+
+// public returns a copy of t without its hash.
+func (t *Token) public() Token {
+	public := *t
+	public.Salt = ""
+	public.Hash = ""
+	return public
+}
+
+// Store keeps the issued tokens in a file of the data directory.
+type Store struct {
+	file   string
+	lock   *sync.Mutex
+	tokens map[string]*Token
+}
+
+// Open loads the tokens of the data directory dataPath, an empty store is returned if there are none yet.
+func Open(dataPath string) (*Store, error) {
+	s := &Store{
+		file:   path.Join(dataPath, tokensFile),
+		lock:   &sync.Mutex{},
+		tokens: make(map[string]*Token),
+	}
+
+	b, err := ioutil.ReadFile(s.file)
+	if os.IsNotExist(err) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	tokens := []*Token{}
+	if err := json.Unmarshal(b, &tokens); err != nil {
+		return nil, fmt.Errorf("failed to read %v: %v", s.file, err)
+	}
+	for _, t := range tokens {
+		s.tokens[t.ID] = t
+	}
+	return s, nil
+}
+
+// Issue creates a token, ttl 0 issues one that never expires. The returned
+// secret is the token to hand to the client, it can't be recovered later.
+func (s *Store) Issue(name string, scopes []string, ttl time.Duration) (*Token, string, error) {
+	if len(scopes) == 0 {
+		return nil, "", fmt.Errorf("a token needs at least one scope")
+	}
+	for _, scope := range scopes {
+		if !validScope(scope) {
+			return nil, "", fmt.Errorf("unknown scope %v", scope)
+		}
+	}
+
+	id, err := randomHex(idSize)
+	if err != nil {
+		return nil, "", err
+	}
+	secret, err := randomHex(secretSize)
+	if err != nil {
+		return nil, "", err
+	}
+	salt, err := randomHex(saltSize)
+	if err != nil {
+		return nil, "", err
+	}
+
+	now := time.Now()
+	t := &Token{
+		ID:      id,
+		Name:    name,
+		Scopes:  scopes,
+		Created: now.Unix(),
+		Salt:    salt,
+		Hash:    hashSecret(salt, secret),
+	}
+	if ttl > 0 {
+		t.Expires = now.Add(ttl).Unix()
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.tokens[id] = t
+	if err := s.save(); err != nil {
+		delete(s.tokens, id)
+		return nil, "", err
+	}
+
+	public := t.public()
+	return &public, Prefix + id + "." + secret, nil
+}
+
+// Verify returns the token raw belongs to, expired and revoked tokens are rejected.
+func (s *Store) Verify(raw string) (*Token, error) {
+	if !strings.HasPrefix(raw, Prefix) {
+		return nil, fmt.Errorf("not an API token")
+	}
+	parts := strings.SplitN(strings.TrimPrefix(raw, Prefix), ".", 2)
+	if len(parts) != 2 {
+		return nil, fmt.Errorf("malformed token")
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	t, exists := s.tokens[parts[0]]
+	if !exists || subtle.ConstantTimeCompare([]byte(hashSecret(t.Salt, parts[1])), []byte(t.Hash)) != 1 {
+		return nil, fmt.Errorf("invalid token")
+	}
+	now := time.Now()
+	if t.Expired(now) {
+		return nil, fmt.Errorf("token expired")
+	}
+
+	// LastUsed is only kept in memory until the store is saved again
+	t.LastUsed = now.Unix()
+	verified := t.public()
+	return &verified, nil
+}
+
+// List returns the issued tokens ordered by creation, expired ones included.
+func (s *Store) List() []Token {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	tokens := []Token{}
+	for _, t := range s.tokens {
+		tokens = append(tokens, t.public())
+	}
+	sort.Slice(tokens, func(i, j int) bool {
+		if tokens[i].Created != tokens[j].Created {
+			return tokens[i].Created < tokens[j].Created
+		}
+		return tokens[i].ID < tokens[j].ID
+	})
+	return tokens
+}
+
+// Revoke deletes the token id, it returns false if there is no such token.
+func (s *Store) Revoke(id string) (bool, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	t, exists := s.tokens[id]
+	if !exists {
+		return false, nil
+	}
+	delete(s.tokens, id)
+	if err := s.save(); err != nil {
+		s.tokens[id] = t
+		return false, err
+	}
+	return true, nil
+}
+
+// save writes the tokens to the store's file, s.lock must be held.
+func (s *Store) save() error {
+	tokens := []*Token{}
+	for _, t := range s.tokens {
+		tokens = append(tokens, t)
+	}
+	b, err := json.MarshalIndent(tokens, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(path.Dir(s.file), os.ModePerm); err != nil {
+		return err
+	}
+	tmp := s.file + ".tmp"
+	if err := ioutil.WriteFile(tmp, b, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.file)
+}
+
+func validScope(scope string) bool {
+	for _, s := range Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+func hashSecret(salt, secret string) string {
+	h := sha256.Sum256([]byte(salt + secret))
+	return hex.EncodeToString(h[:])
+}
+
+func randomHex(size int) (string, error) {
+	b := make([]byte, size)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
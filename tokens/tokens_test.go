@@ -0,0 +1,93 @@
+package tokens
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func tempStore(t *testing.T) (*Store, string, func()) {
+	dir, err := ioutil.TempDir("", "tokens")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := Open(dir)
+	if err != nil {
+		os.RemoveAll(dir)
+		t.Fatal(err)
+	}
+	return s, dir, func() { os.RemoveAll(dir) }
+}
+
+func TestIssueVerifyRevoke(t *testing.T) {
+	s, dir, cleanup := tempStore(t)
+	defer cleanup()
+
+	token, raw, err := s.Issue("ci", []string{ScopeRead}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token.Hash != "" || token.Salt != "" {
+		t.Error("issued token exposes its hash")
+	}
+	if !strings.HasPrefix(raw, Prefix) {
+		t.Errorf("token %q doesn't start with %v", raw, Prefix)
+	}
+
+	b, _ := ioutil.ReadFile(dir + "/" + tokensFile)
+	if strings.Contains(string(b), strings.SplitN(raw, ".", 2)[1]) {
+		t.Error("the secret is stored in plain text")
+	}
+
+	// The tokens survive reopening the store
+	s, err = Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	verified, err := s.Verify(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !verified.Allows(ScopeRead) || verified.Allows(ScopeRatings) {
+		t.Errorf("unexpected scopes %v", verified.Scopes)
+	}
+
+	if _, err := s.Verify(raw + "0"); err == nil {
+		t.Error("tampered token was accepted")
+	}
+
+	if revoked, err := s.Revoke(token.ID); err != nil || !revoked {
+		t.Fatalf("revoke = %v, %v", revoked, err)
+	}
+	if _, err := s.Verify(raw); err == nil {
+		t.Error("revoked token was accepted")
+	}
+}
+
+func TestScopesAndExpiry(t *testing.T) {
+	s, _, cleanup := tempStore(t)
+	defer cleanup()
+
+	if _, _, err := s.Issue("bad", []string{"root"}, 0); err == nil {
+		t.Error("unknown scope was accepted")
+	}
+	if _, _, err := s.Issue("none", nil, 0); err == nil {
+		t.Error("token without scopes was accepted")
+	}
+
+	admin, _, err := s.Issue("admin", []string{ScopeAdmin}, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !admin.Allows(ScopeRatings) || !admin.Allows(ScopeRead) {
+		t.Error("admin token doesn't grant every scope")
+	}
+	if admin.Expired(time.Now()) || !admin.Expired(time.Now().Add(time.Hour*2)) {
+		t.Error("unexpected expiry")
+	}
+	if len(s.List()) != 1 {
+		t.Errorf("expected 1 token, got %v", len(s.List()))
+	}
+}
@@ -0,0 +1,218 @@
+package voyager
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/levigross/grequests"
+
+	"github.com/kimitzu/kimitzu-services/models"
+	"github.com/kimitzu/kimitzu-services/servicestore"
+)
+
+const (
+	// DefaultPresenceTTL is how long the online status of a peer is trusted before checking it again.
+	DefaultPresenceTTL = time.Minute * 10
+
+	presenceWorkers = 4
+)
+
+// PresenceStatus is the last known online status of a peer.
+type PresenceStatus struct {
+	PeerID string `json:"peerID"`
+	Online bool   `json:"online"`
+	// LastSeen is the last time the peer was seen online, 0 if unknown
+	LastSeen  int64 `json:"lastSeen"`
+	CheckedAt int64 `json:"checkedAt"`
+	// Cached is false when the peer was never checked and the status
+	// comes from the last time the crawler reached it
+	Cached bool `json:"cached"`
+}
+
+// PresenceCache keeps the online status of the peers, stale entries are
+// refreshed in the background so lookups never wait on the node.
+type PresenceCache struct {
+	TTL time.Duration
+
+	lock     *sync.RWMutex
+	statuses map[string]PresenceStatus
+	pending  map[string]bool
+	queue    chan string
+	store    *servicestore.MainManagedStorage
+}
+
+// Presence is the presence cache of the daemon, its workers start along with voyager.
+var Presence = NewPresenceCache()
+
+// NewPresenceCache returns an empty PresenceCache.
+func NewPresenceCache() *PresenceCache {
+	return &PresenceCache{
+		TTL:      DefaultPresenceTTL,
+		lock:     &sync.RWMutex{},
+		statuses: make(map[string]PresenceStatus),
+		pending:  make(map[string]bool),
+		queue:    make(chan string, 1000),
+	}
+}
+
+// Run starts the workers checking the queued peers and re-queues the stale entries
+// every TTL until ctx is done, store is used for the peers that were never checked.
+func (p *PresenceCache) Run(ctx context.Context, store *servicestore.MainManagedStorage) {
+	p.lock.Lock()
+	p.store = store
+	p.lock.Unlock()
+
+	check := checkPresence
+	for i := 0; i < presenceWorkers; i++ {
+		go func() {
+			for {
+				select {
+				case peerID := <-p.queue:
+					p.set(check(peerID))
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+	}
+
+	for {
+		select {
+		case <-time.After(p.TTL):
+		case <-ctx.Done():
+			return
+		}
+		p.lock.RLock()
+		stale := []string{}
+		for id, status := range p.statuses {
+			if p.isStale(status) {
+				stale = append(stale, id)
+			}
+		}
+		p.lock.RUnlock()
+
+		for _, id := range stale {
+			p.schedule(id)
+		}
+	}
+}
+
+func (p *PresenceCache) isStale(status PresenceStatus) bool {
+	return time.Since(time.Unix(status.CheckedAt, 0)) > p.TTL
+}
+
+func (p *PresenceCache) set(status PresenceStatus) {
+	p.lock.Lock()
+	p.statuses[status.PeerID] = status
+	delete(p.pending, status.PeerID)
+	p.lock.Unlock()
+}
+
+// schedule queues a peer to be checked unless it already is.
+func (p *PresenceCache) schedule(peerID string) {
+	p.lock.Lock()
+	if p.pending[peerID] {
+		p.lock.Unlock()
+		return
+	}
+	p.pending[peerID] = true
+	p.lock.Unlock()
+
+	select {
+	case p.queue <- peerID:
+	default:
+		// The queue is full, the peer gets picked up again on the next lookup
+		p.lock.Lock()
+		delete(p.pending, peerID)
+		p.lock.Unlock()
+	}
+}
+
+// Status returns the cached status of a peer without blocking, peers that
+// were never checked fall back to the last time the crawler reached them.
+// Stale and unknown peers are checked in the background.
+func (p *PresenceCache) Status(peerID string) PresenceStatus {
+	p.lock.RLock()
+	status, cached := p.statuses[peerID]
+	store := p.store
+	p.lock.RUnlock()
+
+	if cached {
+		if p.isStale(status) {
+			p.schedule(peerID)
+		}
+		return status
+	}
+
+	p.schedule(peerID)
+	status = PresenceStatus{PeerID: peerID}
+	if store != nil {
+		if doc, err := store.PeerData.Get(peerID); err == nil {
+			peer := models.Peer{}
+			if doc.Export(&peer) == nil {
+				status.LastSeen = peer.LastPing
+				status.Online = time.Now().Unix()-peer.LastPing < MaxLastOnline
+			}
+		}
+	}
+	return status
+}
+
+// Check returns the status of a peer, checking it right away if the cached one is stale.
+func (p *PresenceCache) Check(peerID string) PresenceStatus {
+	p.lock.RLock()
+	status, cached := p.statuses[peerID]
+	p.lock.RUnlock()
+
+	if cached && !p.isStale(status) {
+		return status
+	}
+	status = checkPresence(peerID)
+	p.set(status)
+	return status
+}
+
+// Online implements servicestore.Presence.
+func (p *PresenceCache) Online(peerID string) bool {
+	return p.Status(peerID).Online
+}
+
+// checkPresence checks whether a peer is online, tests swap it out to stay off the network.
+var checkPresence = checkNodePresence
+
+// checkNodePresence asks the node whether a peer is online, first through the
+// lastOnline record the peer publishes and then through the node's status check.
+func checkNodePresence(peerid string) PresenceStatus {
+	status := PresenceStatus{PeerID: peerid, CheckedAt: time.Now().Unix(), Cached: true}
+	if peerid == MyPeerID {
+		status.Online = true
+		status.LastSeen = status.CheckedAt
+		return status
+	}
+
+	lastOnline, err := grequests.Get("http://localhost:8100/ipns/"+peerid+"/lastOnline", reqOpt)
+	if err == nil {
+		ts, err := strconv.Atoi(string(lastOnline.Bytes()))
+		if err == nil {
+			status.LastSeen = int64(ts)
+			status.Online = time.Now().Unix()-int64(ts) < MaxLastOnline
+			return status
+		}
+	}
+
+	isOnline, err := grequests.Get("http://localhost:8100/ob/status/"+peerid+"?usecache=false", reqOpt)
+	if err != nil {
+		return status
+	}
+
+	result := make(map[string]string)
+	isOnline.JSON(&result)
+	log.Debug("isPeerOnline: ", result)
+	status.Online = result["status"] == "online"
+	if status.Online {
+		status.LastSeen = status.CheckedAt
+	}
+	return status
+}
@@ -0,0 +1,148 @@
+package voyager
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/kimitzu/kimitzu-services/models"
+	"github.com/kimitzu/kimitzu-services/servicestore"
+)
+
+// stubPresence replaces checkPresence with one reporting every peer online and
+// counting the checks, the returned function restores it.
+func stubPresence() (checks func(peerID string) int, restore func()) {
+	lock := &sync.Mutex{}
+	counts := make(map[string]int)
+	checkPresence = func(peerID string) PresenceStatus {
+		lock.Lock()
+		counts[peerID]++
+		lock.Unlock()
+		now := time.Now().Unix()
+		return PresenceStatus{PeerID: peerID, Online: true, LastSeen: now, CheckedAt: now, Cached: true}
+	}
+	return func(peerID string) int {
+			lock.Lock()
+			defer lock.Unlock()
+			return counts[peerID]
+		}, func() {
+			checkPresence = checkNodePresence
+		}
+}
+
+func TestPresenceStatusFallback(t *testing.T) {
+	dir, err := ioutil.TempDir("", "voyager")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	store := servicestore.InitializeManagedStorage(dir)
+	defer store.Close()
+
+	now := time.Now().Unix()
+	for _, peer := range []models.Peer{{ID: "QmRecent", LastPing: now - 60}, {ID: "QmGone", LastPing: now - MaxLastOnline - 60}} {
+		if _, err := store.PeerData.Insert(peer.ID, peer); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	p := NewPresenceCache()
+	p.store = store
+	cases := []struct {
+		peerID   string
+		online   bool
+		lastSeen int64
+	}{
+		{"QmRecent", true, now - 60},
+		{"QmGone", false, now - MaxLastOnline - 60},
+		{"QmUnknown", false, 0},
+	}
+	for _, c := range cases {
+		status := p.Status(c.peerID)
+		if status.Online != c.online || status.LastSeen != c.lastSeen || status.Cached {
+			t.Errorf("%v: unexpected status %+v", c.peerID, status)
+		}
+	}
+	if len(p.queue) != len(cases) {
+		t.Errorf("expected the %v unchecked peers to be scheduled, got %v", len(cases), len(p.queue))
+	}
+}
+
+func TestPresenceSchedule(t *testing.T) {
+	p := NewPresenceCache()
+	p.schedule("QmA")
+	p.schedule("QmA")
+	if len(p.queue) != 1 {
+		t.Errorf("expected a peer to be queued once, got %v", len(p.queue))
+	}
+
+	// Checked peers can be scheduled again
+	p.set(PresenceStatus{PeerID: "QmA"})
+	p.schedule("QmA")
+	if len(p.queue) != 2 {
+		t.Errorf("expected the checked peer to be queued again, got %v", len(p.queue))
+	}
+
+	// Peers that don't fit in the queue aren't left pending
+	p = NewPresenceCache()
+	p.queue = make(chan string, 1)
+	p.schedule("QmA")
+	p.schedule("QmB")
+	if len(p.queue) != 1 || p.pending["QmB"] {
+		t.Errorf("expected QmB to be dropped, queued %v, pending %v", len(p.queue), p.pending)
+	}
+}
+
+func TestPresenceStale(t *testing.T) {
+	checks, restore := stubPresence()
+	defer restore()
+
+	p := NewPresenceCache()
+	now := time.Now()
+	p.set(PresenceStatus{PeerID: "QmFresh", Online: true, CheckedAt: now.Unix(), Cached: true})
+	p.set(PresenceStatus{PeerID: "QmStale", Online: false, CheckedAt: now.Add(-p.TTL * 2).Unix(), Cached: true})
+
+	// Lookups return the cached status right away and only schedule the stale ones
+	if status := p.Status("QmStale"); status.Online || !status.Cached {
+		t.Errorf("expected the cached status, got %+v", status)
+	}
+	p.Status("QmFresh")
+	if len(p.queue) != 1 || !p.pending["QmStale"] {
+		t.Errorf("expected only QmStale to be scheduled, queued %v, pending %v", len(p.queue), p.pending)
+	}
+
+	// Check refreshes stale entries right away
+	if status := p.Check("QmStale"); !status.Online || checks("QmStale") != 1 {
+		t.Errorf("expected QmStale to be checked, got %+v", status)
+	}
+	if p.Check("QmFresh"); checks("QmFresh") != 0 {
+		t.Error("expected the fresh status to be used")
+	}
+}
+
+func TestPresenceRun(t *testing.T) {
+	checks, restore := stubPresence()
+	defer restore()
+
+	p := NewPresenceCache()
+	p.TTL = time.Millisecond * 10
+	p.set(PresenceStatus{PeerID: "QmStale", CheckedAt: time.Now().Add(-time.Hour).Unix()})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go p.Run(ctx, nil)
+
+	deadline := time.Now().Add(time.Second)
+	for checks("QmStale") == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("the stale entry wasn't re-queued")
+		}
+		time.Sleep(time.Millisecond * 5)
+	}
+	if !p.Status("QmStale").Online {
+		t.Error("expected the refreshed status to be cached")
+	}
+}
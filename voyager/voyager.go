@@ -5,6 +5,7 @@
 package voyager
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -12,17 +13,25 @@ import (
 	"path"
 	"path/filepath"
 	"strconv"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/levigross/grequests"
 	"github.com/nokusukun/particles/roggy"
 
+	"github.com/kimitzu/kimitzu-services/health"
 	"github.com/kimitzu/kimitzu-services/models"
 	"github.com/kimitzu/kimitzu-services/servicestore"
 )
 
 const (
 	MaxLastOnline = 259200
+
+	pingInterval      = time.Minute * 30
+	nodeRetryInterval = time.Second * 5
+	// stallTimeout is how long the crawler can go without activity before it's reported down
+	stallTimeout = time.Minute * 10
 )
 
 var (
@@ -31,12 +40,15 @@ var (
 	log        *roggy.LogPrinter
 	store      *servicestore.MainManagedStorage
 	MyPeerID   string
+
+	// lastActivity is when the crawler last fetched or digested a peer, in Unix nanoseconds
+	lastActivity int64
 )
 
 var reqOpt = &grequests.RequestOptions{RequestTimeout: 70 * time.Second}
 var maxClosest = make(chan int, 5)
 
-func findClosestPeers(peer string, peerlist chan<- string) {
+func findClosestPeers(ctx context.Context, peer string, peerlist chan<- string) {
 	// This makes sure that the findClosestPeers doesn't overfill the requests
 	// by limiting it to 5 concurrent calls.
 	log.Debug(fmt.Sprintf("Retrieving closest peers for %v", peer))
@@ -50,7 +62,10 @@ func findClosestPeers(peer string, peerlist chan<- string) {
 		err = json.Unmarshal([]byte(resp.String()), &listJSON)
 		if err == nil {
 			for _, peer := range listJSON {
-				peerlist <- peer
+				select {
+				case peerlist <- peer:
+				case <-ctx.Done():
+				}
 			}
 		}
 	}
@@ -63,22 +78,32 @@ func findClosestPeers(peer string, peerlist chan<- string) {
 	}
 }
 
-func findPeers(peerlist chan<- string) {
+func findPeers(ctx context.Context, peerlist chan<- string) {
 	for {
 		log.Debug("Looking for peers...")
 		resp, err := grequests.Get("http://localhost:8100/ob/peers", reqOpt)
 		if err != nil {
 			log.Error("Can't Load OpenBazaar Peers")
-			continue
+		} else {
+			active()
+			var listJSON []string
+			json.Unmarshal([]byte(resp.String()), &listJSON)
+			for _, peer := range listJSON {
+				select {
+				case peerlist <- peer:
+				case <-ctx.Done():
+					return
+				}
+				maxClosest <- 1
+				go findClosestPeers(ctx, peer, peerlist)
+			}
 		}
-		var listJSON []string
-		json.Unmarshal([]byte(resp.String()), &listJSON)
-		for _, peer := range listJSON {
-			peerlist <- peer
-			maxClosest <- 1
-			go findClosestPeers(peer, peerlist)
+
+		select {
+		case <-time.After(time.Second * 5):
+		case <-ctx.Done():
+			return
 		}
-		time.Sleep(time.Second * 5)
 	}
 }
 
@@ -133,6 +158,7 @@ func clearListings(peer string) error {
 		}
 	}
 	store.Listings.FlushSE()
+	store.MarkChanged()
 	return nil
 }
 
@@ -162,6 +188,10 @@ func DigestPeer(peer string, store *servicestore.MainManagedStorage) (*models.Pe
 		}
 	}
 
+	// The custom fields of the profile are indexed once and copied into the
+	// listings so profile filters don't have to look up the peer per listing
+	fields := servicestore.IndexProfileFields(peerJSON)
+
 	// Removes all of the old listings from this particular peer
 	clearListings(peer)
 	for _, listing := range peerListings {
@@ -212,6 +242,12 @@ func DigestPeer(peer string, store *servicestore.MainManagedStorage) (*models.Pe
 		}
 		json.Unmarshal(oldListingDat, &classListing)
 
+		// Fill in the missing coordinates and zip code so the listing shows up in radius searches
+		store.ResolveLocation(&classListing.Location)
+		// Price the listing in whole units of its currency, queries convert it with the current rates
+		store.NormalizePrice(&classListing)
+		classListing.VendorFields = fields
+
 		// Check if the listing hash already exists and update it instead of inserting a new one.
 		existing := store.Listings.Search(classListing.Hash)
 		if existing.Count == 1 {
@@ -227,31 +263,51 @@ func DigestPeer(peer string, store *servicestore.MainManagedStorage) (*models.Pe
 
 	log.Verbose("Committing Listings", peerJSON["name"])
 	store.Listings.Commit()
+	store.MarkChanged()
 	log.Verbose(" id  > ", peerJSON["name"], len(peerListings))
 	return &models.Peer{
 		ID:       peer,
 		RawMap:   peerJSON,
-		LastPing: time.Now().Unix()}, nil
+		LastPing: time.Now().Unix(),
+		Fields:   fields}, nil
 }
 
 func GetSelfPeerID() string {
+	id, _ := selfPeerID()
+	return id
+}
+
+// selfPeerID returns the peer ID of the node, empty if it has no profile yet.
+// The error is set when the node can't be reached.
+func selfPeerID() (string, error) {
 	rdata, err := grequests.Get("http://localhost:8100/ob/profile/", reqOpt)
 	if err != nil {
-		return ""
+		return "", err
 	}
 	data := make(map[string]interface{})
 	json.Unmarshal(rdata.Bytes(), &data)
 	_, nonexist := data["success"]
 	if !nonexist {
-		return data["peerID"].(string)
+		id, _ := data["peerID"].(string)
+		return id, nil
 	}
-	return ""
+	return "", nil
 }
 
-func DigestService(peerStream chan string, store_ *servicestore.MainManagedStorage) {
+// DigestService digests the peers sent on peerStream until ctx is done.
+func DigestService(ctx context.Context, peerStream chan string, store_ *servicestore.MainManagedStorage) {
 	store = store_
-	for peer := range peerStream {
+	for {
+		var peer string
+		select {
+		case peer = <-peerStream:
+		case <-ctx.Done():
+			log.Debug("Digesting stopped")
+			return
+		}
+
 		log.Debug("Recieved peer...")
+		active()
 		if val, exists := retryPeers[peer]; exists && val >= 5 {
 			continue
 		}
@@ -272,107 +328,217 @@ func DigestService(peerStream chan string, store_ *servicestore.MainManagedStora
 			//store.PMap[peer] = peerObjID
 			store.Listings.Commit()
 			store.PeerData.Commit()
+			store.MarkChanged()
 		} else {
 			log.Debug("Peer alreaday exists: " + peer)
 		}
 		log.Debug("Getting peer from peerStream...")
 	}
-	log.Error("Digesting stopped")
 }
 
+// IsPeerOnline checks whether a peer is online, the answer is cached for Presence.TTL.
 func IsPeerOnline(peerid string) bool {
-	if peerid == MyPeerID {
-		return true
-	}
+	return Presence.Check(peerid).Online
+}
 
-	lastOnline, err := grequests.Get("http://localhost:8100/ipns/"+peerid+"/lastOnline", reqOpt)
-	if err == nil {
-		ts, err := strconv.Atoi(string(lastOnline.Bytes()))
-		if err == nil {
-			if time.Now().Unix()-int64(ts) < 259200 {
-				return true
-			} else {
-				return false
-			}
-		}
-	}
+// Crawler is the voyager service, it crawls the peers known to the OpenBazaar node for
+// their listings and refreshes the indexed peers every 30 minutes.
+type Crawler struct {
+	Log   *roggy.LogPrinter
+	Store *servicestore.MainManagedStorage
 
-	isOnline, err := grequests.Get("http://localhost:8100/ob/status/"+peerid+"?usecache=false", reqOpt)
-	if err != nil {
-		return false
-	}
+	cancel  context.CancelFunc
+	running *sync.WaitGroup
+	ready   chan struct{}
+	started int32
+}
 
-	result := make(map[string]string)
-	isOnline.JSON(&result)
-	log.Debug("isPeerOnline: ", result)
-	return result["status"] == "online"
+// NewCrawler returns a crawler of store.
+func NewCrawler(log *roggy.LogPrinter, store *servicestore.MainManagedStorage) *Crawler {
+	return &Crawler{Log: log, Store: store, running: &sync.WaitGroup{}, ready: make(chan struct{})}
 }
 
-// RunVoyagerService - Starts the voyager service. Handles the crawling of the nodes for the listings.
-func RunVoyagerService(logP *roggy.LogPrinter, store *servicestore.MainManagedStorage) {
-	log = logP
+func (c *Crawler) Name() string {
+	return "voyager"
+}
+
+// Start indexes the stored peers and starts crawling once the OpenBazaar node can be reached.
+func (c *Crawler) Start(ctx context.Context) error {
+	log = c.Log
 	log.Info("Starting Voyager Service")
 	peerStream = make(chan string, 1000)
 	retryPeers = make(map[string]int)
+	store = c.Store
+	ctx, c.cancel = context.WithCancel(ctx)
+	atomic.StoreInt32(&c.started, 1)
 
-	MyPeerID = GetSelfPeerID()
-	if MyPeerID != "" {
-		peerStream <- MyPeerID
-	}
+	ensureDir(path.Join(c.Store.StorePath, "images", ".test"))
 
-	ensureDir(path.Join(store.StorePath, "images", ".test"))
-	go findPeers(peerStream)
-
-	peers := store.PeerData.Search("")
+	peers := c.Store.PeerData.Search("")
 
 	log.Debug("Creating PeerMap")
 	for _, doc := range peers.Documents {
 		interfpeer := models.Peer{}
 		doc.Export(&interfpeer)
 		// store.PMap[interfpeer.ID] = doc.ID
-		store.PMapSet(interfpeer.ID, doc.ID)
+		c.Store.PMapSet(interfpeer.ID, doc.ID)
 	}
 
-	// Digests found peers
-	log.Debug("Starting Digest Service")
-	go DigestService(peerStream, store)
+	// Keeps the online status of the peers
+	c.goRun(func() { Presence.Run(ctx, c.Store) })
+	c.Store.Presence = Presence
 
-	// Occasionally ping the peers
-	go func() {
+	c.goRun(func() {
+		if !c.waitForNode(ctx) {
+			return
+		}
+		if MyPeerID != "" {
+			peerStream <- MyPeerID
+		}
+		active()
+		close(c.ready)
+
+		c.goRun(func() { findPeers(ctx, peerStream) })
+
+		// Digests found peers
+		log.Debug("Starting Digest Service")
+		c.goRun(func() { DigestService(ctx, peerStream, c.Store) })
+
+		// Occasionally ping the peers
 		log.Debug("Starting Ping Service")
-		for {
-			peers := store.PeerData.Search("")
-			for _, peerD := range peers.Documents {
-				peer := models.Peer{}
-				_ = peerD.Export(&peer)
-
-				if peer.ID == "" {
-					log.Error(fmt.Sprintf("Failed to load peer from database: %v", peerD.ID))
-				}
+		c.ping(ctx)
+	})
+	return nil
+}
 
-				log.Verbose(fmt.Sprintf("Pinging %v", peer.ID))
+// Ready is closed once the node was reached and the crawling started.
+func (c *Crawler) Ready() <-chan struct{} {
+	return c.ready
+}
 
-				if IsPeerOnline(peer.ID) {
-					log.Debug(fmt.Sprintln("Refreshing peer", peer.ID))
-					d, err := DigestPeer(peer.ID, store)
-					if err != nil {
-						log.Error(fmt.Sprintln("Failed to refresh ", peer.ID, err))
-					} else {
-						d.LastPing = time.Now().Unix()
-						_ = store.PeerData.Update(peer.ID, d)
-					}
+// Stop stops crawling, waiting for the peers being digested, and commits the stores.
+func (c *Crawler) Stop(ctx context.Context) error {
+	atomic.StoreInt32(&c.started, 0)
+	if c.cancel != nil {
+		c.cancel()
+	}
 
-					log.Debug(fmt.Sprintln("Finished refreshing", peer.ID))
+	done := make(chan struct{})
+	go func() {
+		c.running.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-ctx.Done():
+		log.Error("Gave up waiting for the peers being digested")
+	}
+
+	if err := c.Store.Listings.Commit(); err != nil {
+		return err
+	}
+	return c.Store.PeerData.Commit()
+}
+
+// HealthCheck reports the crawler down while it isn't running, waits for the
+// OpenBazaar node or has been idle for longer than stallTimeout.
+func (c *Crawler) HealthCheck() health.Check {
+	return health.Check{Name: "voyager", Probe: func(ctx context.Context) (health.Details, error) {
+		if atomic.LoadInt32(&c.started) == 0 {
+			return nil, fmt.Errorf("the crawler isn't running")
+		}
+		select {
+		case <-c.ready:
+		default:
+			return health.Details{"ready": false}, fmt.Errorf("waiting for the OpenBazaar node")
+		}
 
-				} else if (time.Now().Unix() - peer.LastPing) > MaxLastOnline {
-					log.Debug(fmt.Sprintln("Disposing Peer ", peer.ID, "\nDeadline: ", time.Now().Unix(), peer.LastPing, time.Now().Unix()-peer.LastPing))
-					_ = clearListings(peer.ID)
+		last := time.Unix(0, atomic.LoadInt64(&lastActivity))
+		details := health.Details{"ready": true, "lastActivity": last.UTC().Format(time.RFC3339)}
+		if idle := time.Since(last); idle > stallTimeout {
+			return details, fmt.Errorf("no activity for %v", idle.Round(time.Second))
+		}
+		return details, nil
+	}}
+}
+
+// active records activity of the crawler.
+func active() {
+	atomic.StoreInt64(&lastActivity, time.Now().UnixNano())
+}
+
+func (c *Crawler) goRun(f func()) {
+	c.running.Add(1)
+	go func() {
+		defer c.running.Done()
+		f()
+	}()
+}
+
+// waitForNode waits until the OpenBazaar node answers, it returns false if ctx is done first.
+func (c *Crawler) waitForNode(ctx context.Context) bool {
+	for attempt := 0; ; attempt++ {
+		id, err := selfPeerID()
+		if err == nil {
+			MyPeerID = id
+			return true
+		}
+		if attempt == 0 {
+			log.Info("Waiting for the OpenBazaar node")
+		}
+
+		select {
+		case <-time.After(nodeRetryInterval):
+		case <-ctx.Done():
+			return false
+		}
+	}
+}
+
+// ping refreshes the online peers and disposes of the listings of the ones
+// offline for longer than MaxLastOnline.
+func (c *Crawler) ping(ctx context.Context) {
+	for {
+		peers := c.Store.PeerData.Search("")
+		for _, peerD := range peers.Documents {
+			if ctx.Err() != nil {
+				return
+			}
+
+			peer := models.Peer{}
+			_ = peerD.Export(&peer)
+
+			if peer.ID == "" {
+				log.Error(fmt.Sprintf("Failed to load peer from database: %v", peerD.ID))
+			}
+
+			log.Verbose(fmt.Sprintf("Pinging %v", peer.ID))
+			active()
+
+			if IsPeerOnline(peer.ID) {
+				log.Debug(fmt.Sprintln("Refreshing peer", peer.ID))
+				d, err := DigestPeer(peer.ID, c.Store)
+				if err != nil {
+					log.Error(fmt.Sprintln("Failed to refresh ", peer.ID, err))
+				} else {
+					d.LastPing = time.Now().Unix()
+					_ = c.Store.PeerData.Update(peer.ID, d)
 				}
+
+				log.Debug(fmt.Sprintln("Finished refreshing", peer.ID))
+
+			} else if (time.Now().Unix() - peer.LastPing) > MaxLastOnline {
+				log.Debug(fmt.Sprintln("Disposing Peer ", peer.ID, "\nDeadline: ", time.Now().Unix(), peer.LastPing, time.Now().Unix()-peer.LastPing))
+				_ = clearListings(peer.ID)
 			}
-			time.Sleep(time.Minute * 30)
 		}
-	}()
 
+		select {
+		case <-time.After(pingInterval):
+		case <-ctx.Done():
+			return
+		}
+	}
 }
 
 func ensureDir(fileName string) {